@@ -0,0 +1,143 @@
+package pass
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// AccessLogEntry describes a request served by the Proxy, for an access log.
+type AccessLogEntry struct {
+	Time      time.Time     // When the request arrived
+	ClientIP  string        // As resolved by the ClientIPResolver
+	Method    string        // Request method
+	URI       string        // Request URI, as sent by the client
+	Proto     string        // Request protocol, such as "HTTP/1.1"
+	Status    int           // Response status code
+	Bytes     int           // Size of the response body
+	Duration  time.Duration // Time taken to serve the request
+	Upstream  string        // Identifier of the Upstream the request was routed to, if any
+	UserAgent string        // User-Agent header of the request
+	Referer   string        // Referer header of the request
+}
+
+// AccessLogFormat writes an AccessLogEntry, including a trailing newline, to
+// an access log.
+type AccessLogFormat func(w io.Writer, e AccessLogEntry) error
+
+// CommonLogFormat is an AccessLogFormat that writes entries in the Common Log
+// Format, followed by the Upstream's identifier, or "-" when no route matched.
+func CommonLogFormat(w io.Writer, e AccessLogEntry) error {
+	upstream := e.Upstream
+	if upstream == "" {
+		upstream = "-"
+	}
+	_, err := fmt.Fprintf(w, "%s - - [%s] %q %d %d %s\n",
+		e.ClientIP,
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method+" "+e.URI+" "+e.Proto,
+		e.Status,
+		e.Bytes,
+		upstream,
+	)
+	return err
+}
+
+// JSONLogFormat is an AccessLogFormat that writes entries as JSON objects, one
+// per line. The duration is in milliseconds.
+func JSONLogFormat(w io.Writer, e AccessLogEntry) error {
+	return json.NewEncoder(w).Encode(struct {
+		Time       time.Time `json:"time"`
+		ClientIP   string    `json:"client_ip"`
+		Method     string    `json:"method"`
+		URI        string    `json:"uri"`
+		Proto      string    `json:"proto"`
+		Status     int       `json:"status"`
+		Bytes      int       `json:"bytes"`
+		DurationMS float64   `json:"duration_ms"`
+		Upstream   string    `json:"upstream,omitempty"`
+		UserAgent  string    `json:"user_agent,omitempty"`
+		Referer    string    `json:"referer,omitempty"`
+	}{
+		Time:       e.Time,
+		ClientIP:   e.ClientIP,
+		Method:     e.Method,
+		URI:        e.URI,
+		Proto:      e.Proto,
+		Status:     e.Status,
+		Bytes:      e.Bytes,
+		DurationMS: float64(e.Duration) / float64(time.Millisecond),
+		Upstream:   e.Upstream,
+		UserAgent:  e.UserAgent,
+		Referer:    e.Referer,
+	})
+}
+
+// accessLog is the configuration given to WithAccessLog and
+// WithUpstreamAccessLog. Entries are written whole, so a writer can be shared
+// by concurrent requests.
+type accessLog struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format AccessLogFormat
+}
+
+func newAccessLog(w io.Writer, format AccessLogFormat) *accessLog {
+	if format == nil {
+		format = CommonLogFormat
+	}
+	return &accessLog{w: w, format: format}
+}
+
+func (l *accessLog) write(e AccessLogEntry) {
+	var buf bytes.Buffer
+	if err := l.format(&buf, e); err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(buf.Bytes())
+}
+
+// logAccess serves a request with next and writes it to the access log of the
+// Upstream it was routed to, or else the Proxy's access log. The request's
+// context must be tracking the matched Upstream.
+func logAccess(next http.Handler, cfg mountConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		upstream, _ := MatchedUpstream(r.Context())
+		l, ok := cfg.upstreamAccessLogs[upstream]
+		if !ok {
+			l = cfg.accessLog
+		}
+		if l == nil {
+			return
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		l.write(AccessLogEntry{
+			Time:      start,
+			ClientIP:  cfg.clientIP(r),
+			Method:    r.Method,
+			URI:       r.RequestURI,
+			Proto:     r.Proto,
+			Status:    status,
+			Bytes:     ww.BytesWritten(),
+			Duration:  time.Since(start),
+			Upstream:  upstream,
+			UserAgent: r.UserAgent(),
+			Referer:   r.Referer(),
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package pass
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestAccessLog(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(destination.URL),
+			"secondary": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	var global, secondary bytes.Buffer
+	proxy, err := New(m,
+		WithAccessLog(&global, nil),
+		WithUpstreamAccessLog("secondary", &secondary, JSONLogFormat),
+	)
+	require.NoError(t, err)
+
+	serve := func(path string) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("User-Agent", "test")
+		proxy.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	serve("/widgets?page=2")
+	serve("/missing")
+	lines := regexp.MustCompile(`(?m)^192\.0\.2\.1 - - \[[^\]]+\] "([^"]+)" (\d+) (\d+) (\S+)$`).FindAllStringSubmatch(global.String(), -1)
+	require.Len(t, lines, 2, global.String())
+	require.Equal(t, []string{"GET /widgets?page=2 HTTP/1.1", "201", "7", "primary"}, lines[0][1:])
+	require.Equal(t, []string{"GET /missing HTTP/1.1", "404", "19", "-"}, lines[1][1:])
+	require.Zero(t, secondary.Len())
+
+	// Requests to the Upstream with its own log aren't written to the
+	// global one.
+	global.Reset()
+	serve("/gadgets")
+	require.Zero(t, global.Len())
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(secondary.Bytes(), &entry))
+	require.Equal(t, "GET", entry["method"])
+	require.Equal(t, "/gadgets", entry["uri"])
+	require.Equal(t, float64(http.StatusCreated), entry["status"])
+	require.Equal(t, "secondary", entry["upstream"])
+	require.Equal(t, "test", entry["user_agent"])
+
+	_, err = New(m, WithUpstreamAccessLog("missing", &secondary, nil))
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+}
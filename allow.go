@@ -0,0 +1,84 @@
+package pass
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// serveOptions answers an OPTIONS request that no route declares with 204 No
+// Content and an Allow header listing the methods routes accept for its path.
+// It reports false if the request isn't for OPTIONS or no route matches its
+// path.
+func (rt *routing) serveOptions(w http.ResponseWriter, r *http.Request) bool {
+	if !rt.autoOptions || r.Method != http.MethodOptions {
+		return false
+	}
+	allowed := rt.allowedMethods(r)
+	if len(allowed) == 0 {
+		return false
+	}
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+// allowedMethods returns the methods routes accept for the request's path, in
+// the order of methods. Request conditions, such as the host, are taken into
+// account. OPTIONS is included whenever another method is, since it's
+// answered by serveOptions. A request for "*" gets every method the Manifest
+// declares.
+func (rt *routing) allowedMethods(r *http.Request) []string {
+	var allowed []string
+	for _, method := range methods {
+		if method == http.MethodOptions {
+			continue
+		}
+		if r.URL.Path == "*" {
+			if rt.declaresMethod(method) {
+				allowed = append(allowed, method)
+			}
+			continue
+		}
+
+		// Routing starts afresh for each method, rather than from the
+		// router's state for the original request.
+		var m RouteMatch
+		ctx := context.WithValue(r.Context(), chi.RouteCtxKey, nil)
+		pr := r.Clone(context.WithValue(ctx, matchOnlyKey{}, &m))
+		pr.Method = method
+		rt.router.ServeHTTP(&discardResponseWriter{header: http.Header{}}, pr)
+		if m.Upstream != "" {
+			allowed = append(allowed, method)
+		}
+	}
+	if len(allowed) > 0 {
+		allowed = append(allowed, http.MethodOptions)
+	}
+	return allowed
+}
+
+// declaresMethod reports whether any route is registered for the method.
+func (rt *routing) declaresMethod(method string) bool {
+	for key := range rt.candidates {
+		m := key[:strings.IndexByte(key, ' ')]
+		if m == method || m == anyMethod {
+			return true
+		}
+	}
+	return false
+}
+
+// serveMethodNotAllowed answers a request for a path whose routes don't accept
+// its method, unless it's an OPTIONS request serveOptions can answer.
+func (rt *routing) serveMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value(matchOnlyKey{}).(*RouteMatch); ok {
+		return
+	}
+	if rt.serveOptions(w, r) {
+		return
+	}
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,94 @@
+package pass
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestAutoOptions(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "true")
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/auto_options.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithAutoOptions())
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	options := func(t *testing.T, path string) *http.Response {
+		req, err := http.NewRequest(http.MethodOptions, server.URL+path, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("methods across upstreams", func(t *testing.T) {
+		resp := options(t, "/widgets")
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "GET, POST, PUT, OPTIONS", resp.Header.Get("Allow"))
+		require.Empty(t, resp.Header.Get("X-Upstream"))
+	})
+
+	t.Run("parameterized path", func(t *testing.T) {
+		resp := options(t, "/widgets/1")
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "DELETE, OPTIONS", resp.Header.Get("Allow"))
+	})
+
+	t.Run("declared options", func(t *testing.T) {
+		resp := options(t, "/gadgets")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "true", resp.Header.Get("X-Upstream"))
+	})
+
+	t.Run("unknown path", func(t *testing.T) {
+		resp := options(t, "/unknown")
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Allow"))
+	})
+
+	t.Run("other methods", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPatch, server.URL+"/widgets", nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+
+	t.Run("asterisk", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "*", nil))
+		require.Equal(t, http.StatusNoContent, w.Code)
+		require.Equal(t, "GET, POST, PUT, DELETE, OPTIONS", w.Header().Get("Allow"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		req, err := http.NewRequest(http.MethodOptions, server.URL+"/widgets", nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+}
@@ -0,0 +1,60 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrInvalidAuth is returned when an Upstream's auth block has an unknown type
+// or is missing the credentials its type needs.
+var ErrInvalidAuth = fmt.Errorf("invalid upstream auth")
+
+// Values for UpstreamAuth.Type.
+const (
+	UpstreamAuthBasic  = "basic"  // HTTP Basic authentication with a username and password
+	UpstreamAuthBearer = "bearer" // A bearer token
+)
+
+// UpstreamAuth is the credentials the Proxy sends to an Upstream with every
+// request, in the Authorization header. Any Authorization header sent by the
+// client is replaced. Use interpolation, such as from passutil.EnvEvalContext,
+// to keep the credentials themselves out of the manifest.
+type UpstreamAuth struct {
+	Type     string `hcl:"type"`              // "basic" or "bearer"
+	Username string `hcl:"username,optional"` // Username for basic authentication
+	Password string `hcl:"password,optional"` // Password for basic authentication
+	Token    string `hcl:"token,optional"`    // Token for bearer authentication
+}
+
+// validate verifies that the credentials needed for the type are present.
+func (a UpstreamAuth) validate(identifier string) error {
+	switch a.Type {
+	case UpstreamAuthBasic:
+		if a.Username == "" {
+			return fmt.Errorf("%w: %q: basic auth needs a username", ErrInvalidAuth, identifier)
+		}
+	case UpstreamAuthBearer:
+		if a.Token == "" {
+			return fmt.Errorf("%w: %q: bearer auth needs a token", ErrInvalidAuth, identifier)
+		}
+	default:
+		return fmt.Errorf("%w: %q: unknown type %q", ErrInvalidAuth, identifier, a.Type)
+	}
+	return nil
+}
+
+// authorize returns a RequestModifier that adds the credentials to outgoing
+// requests, or nil if there are none.
+func authorize(a *UpstreamAuth) RequestModifier {
+	if a == nil {
+		return nil
+	}
+	return func(r *http.Request) {
+		switch a.Type {
+		case UpstreamAuthBasic:
+			r.SetBasicAuth(a.Username, a.Password)
+		case UpstreamAuthBearer:
+			r.Header.Set("Authorization", "Bearer "+a.Token)
+		}
+	}
+}
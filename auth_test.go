@@ -0,0 +1,74 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestUpstreamAuth(t *testing.T) {
+	var received string
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get("Authorization")
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+			"password":    cty.StringVal("hunter2"),
+			"token":       cty.StringVal("s3cr3t"),
+		},
+	}
+	m, err := LoadManifest("testdata/auth.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name   string
+		path   string
+		client string
+		want   string
+	}{
+		{"basic", "/basic", "", "Basic cHJveHk6aHVudGVyMg=="},
+		{"bearer", "/bearer", "", "Bearer s3cr3t"},
+		{"replaces client credentials", "/bearer", "Bearer client", "Bearer s3cr3t"},
+		{"none", "/open", "Bearer client", "Bearer client"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			require.NoError(t, err)
+			if tt.client != "" {
+				req.Header.Set("Authorization", tt.client)
+			}
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, tt.want, received)
+			require.Empty(t, resp.Header.Get("Authorization"))
+		})
+	}
+}
+
+func TestInvalidUpstreamAuth(t *testing.T) {
+	_, err := LoadManifest("testdata/invalid_auth.hcl", nil)
+	require.True(t, errors.Is(err, ErrInvalidAuth))
+
+	m, err := LoadManifest("testdata/basic.hcl", nil)
+	require.NoError(t, err)
+	m.Upstreams[0].Auth = &UpstreamAuth{Type: UpstreamAuthBearer}
+	require.True(t, errors.Is(m.Validate(), ErrInvalidAuth))
+}
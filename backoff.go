@@ -0,0 +1,79 @@
+package pass
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Defaults for the fields of the BackoffStrategy implementations.
+const (
+	DefaultBackoffBase       = 100 * time.Millisecond
+	DefaultBackoffMax        = 5 * time.Second
+	DefaultBackoffMultiplier = 2.0
+)
+
+// BackoffStrategy determines how long to wait before retrying a request.
+type BackoffStrategy interface {
+	// Backoff returns the delay before a retry. The first retry is attempt 1.
+	Backoff(attempt int) time.Duration
+}
+
+// ConstantBackoff waits the same amount of time before every retry.
+type ConstantBackoff struct {
+	Delay time.Duration // Defaults to DefaultBackoffBase
+}
+
+// Backoff implements BackoffStrategy.
+func (b ConstantBackoff) Backoff(attempt int) time.Duration {
+	if b.Delay <= 0 {
+		return DefaultBackoffBase
+	}
+	return b.Delay
+}
+
+// ExponentialBackoff multiplies the delay by the multiplier after every retry,
+// up to a maximum.
+type ExponentialBackoff struct {
+	Base       time.Duration // Delay before the first retry. Defaults to DefaultBackoffBase.
+	Max        time.Duration // Defaults to DefaultBackoffMax
+	Multiplier float64       // Defaults to DefaultBackoffMultiplier
+}
+
+// Backoff implements BackoffStrategy.
+func (b ExponentialBackoff) Backoff(attempt int) time.Duration {
+	base, max, multiplier := b.Base, b.Max, b.Multiplier
+	if base <= 0 {
+		base = DefaultBackoffBase
+	}
+	if max <= 0 {
+		max = DefaultBackoffMax
+	}
+	if multiplier < 1 {
+		multiplier = DefaultBackoffMultiplier
+	}
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	d := float64(base) * math.Pow(multiplier, float64(attempt-1))
+	if d > float64(max) {
+		return max
+	}
+	return time.Duration(d)
+}
+
+// ExponentialJitterBackoff waits a random amount of time between zero and the
+// delay ExponentialBackoff would wait ("full jitter"). This keeps clients that
+// failed at the same time from retrying in lockstep.
+type ExponentialJitterBackoff struct {
+	Base       time.Duration // Defaults to DefaultBackoffBase
+	Max        time.Duration // Defaults to DefaultBackoffMax
+	Multiplier float64       // Defaults to DefaultBackoffMultiplier
+}
+
+// Backoff implements BackoffStrategy.
+func (b ExponentialJitterBackoff) Backoff(attempt int) time.Duration {
+	d := ExponentialBackoff(b).Backoff(attempt)
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
@@ -0,0 +1,52 @@
+package pass
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	b := ConstantBackoff{Delay: 50 * time.Millisecond}
+	for attempt := 1; attempt <= 5; attempt++ {
+		require.Equal(t, 50*time.Millisecond, b.Backoff(attempt))
+	}
+	require.Equal(t, DefaultBackoffBase, ConstantBackoff{}.Backoff(1))
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff{Base: 10 * time.Millisecond, Max: 100 * time.Millisecond, Multiplier: 3}
+	expect := []time.Duration{
+		10 * time.Millisecond,
+		30 * time.Millisecond,
+		90 * time.Millisecond,
+		100 * time.Millisecond,
+		100 * time.Millisecond,
+	}
+	for i, d := range expect {
+		require.Equal(t, d, b.Backoff(i+1), "attempt %d", i+1)
+	}
+
+	defaults := ExponentialBackoff{}
+	require.Equal(t, DefaultBackoffBase, defaults.Backoff(1))
+	require.Equal(t, 2*DefaultBackoffBase, defaults.Backoff(2))
+	require.Equal(t, DefaultBackoffMax, defaults.Backoff(100))
+}
+
+func TestExponentialJitterBackoff(t *testing.T) {
+	b := ExponentialJitterBackoff{Base: 10 * time.Millisecond, Max: 100 * time.Millisecond}
+	ceilings := []time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		80 * time.Millisecond,
+		100 * time.Millisecond,
+	}
+	for i, ceiling := range ceilings {
+		for n := 0; n < 100; n++ {
+			d := b.Backoff(i + 1)
+			require.True(t, d >= 0 && d <= ceiling, "attempt %d: %s not in [0, %s]", i+1, d, ceiling)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package pass
+
+import (
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+// Balancer chooses which of an Upstream's destinations a request is proxied
+// to. It's given the destinations currently receiving traffic, in the order
+// they're declared, and returns one of them. See WithUpstreamBalancer.
+type Balancer interface {
+	Pick(destinations []*url.URL, r *http.Request) *url.URL
+}
+
+// DoneBalancer is a Balancer that's told when each request it picked a
+// destination for has been served, such as to count the requests in flight.
+type DoneBalancer interface {
+	Balancer
+	Done(destination *url.URL, r *http.Request)
+}
+
+// RoundRobinBalancer returns a Balancer that picks each destination in turn.
+func RoundRobinBalancer() Balancer {
+	return &roundRobin{}
+}
+
+type roundRobin struct {
+	next uint64 // Accessed atomically
+}
+
+func (b *roundRobin) Pick(destinations []*url.URL, _ *http.Request) *url.URL {
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return destinations[n%uint64(len(destinations))]
+}
+
+// RandomBalancer returns a Balancer that picks a destination at random, with
+// equal odds.
+func RandomBalancer() Balancer {
+	return random{}
+}
+
+type random struct{}
+
+func (random) Pick(destinations []*url.URL, _ *http.Request) *url.URL {
+	return destinations[rand.Intn(len(destinations))]
+}
+
+// LeastConnBalancer returns a Balancer that picks the destination with the
+// fewest requests in flight, preferring the first declared when there's a tie.
+func LeastConnBalancer() DoneBalancer {
+	return &leastConn{inFlight: map[string]int{}}
+}
+
+type leastConn struct {
+	mu       sync.Mutex
+	inFlight map[string]int // Keyed by destination URL
+}
+
+func (b *leastConn) Pick(destinations []*url.URL, _ *http.Request) *url.URL {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var best *url.URL
+	min := -1
+	for _, d := range destinations {
+		if n := b.inFlight[d.String()]; min < 0 || n < min {
+			best, min = d, n
+		}
+	}
+	b.inFlight[best.String()]++
+	return best
+}
+
+func (b *leastConn) Done(destination *url.URL, _ *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := destination.String()
+	if b.inFlight[key] <= 1 {
+		delete(b.inFlight, key)
+		return
+	}
+	b.inFlight[key]--
+}
@@ -0,0 +1,170 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func balancerDestinations(t *testing.T, raw ...string) []*url.URL {
+	var urls []*url.URL
+	for _, s := range raw {
+		u, err := url.Parse(s)
+		require.NoError(t, err)
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+func TestRoundRobinBalancer(t *testing.T) {
+	dests := balancerDestinations(t, "http://a.local", "http://b.local", "http://c.local")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	b := RoundRobinBalancer()
+	for i := 0; i < 9; i++ {
+		require.Equal(t, dests[i%3], b.Pick(dests, r))
+	}
+}
+
+func TestRandomBalancer(t *testing.T) {
+	dests := balancerDestinations(t, "http://a.local", "http://b.local", "http://c.local")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	b := RandomBalancer()
+	counts := map[*url.URL]int{}
+	for i := 0; i < 3000; i++ {
+		counts[b.Pick(dests, r)]++
+	}
+	for _, d := range dests {
+		require.InDelta(t, 1000, counts[d], 150, d.String())
+	}
+}
+
+func TestLeastConnBalancer(t *testing.T) {
+	dests := balancerDestinations(t, "http://a.local", "http://b.local", "http://c.local")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	b := LeastConnBalancer()
+
+	// Requests in flight spread across the destinations.
+	require.Equal(t, dests[0], b.Pick(dests, r))
+	require.Equal(t, dests[1], b.Pick(dests, r))
+	require.Equal(t, dests[2], b.Pick(dests, r))
+	require.Equal(t, dests[0], b.Pick(dests, r))
+
+	// The destination that finishes its requests gets the next one.
+	b.Done(dests[2], r)
+	require.Equal(t, dests[2], b.Pick(dests, r))
+	b.Done(dests[1], r)
+	b.Done(dests[2], r)
+	require.Equal(t, dests[1], b.Pick(dests, r))
+	require.Equal(t, dests[2], b.Pick(dests, r))
+}
+
+type countingBalancer struct {
+	Balancer
+	done int
+}
+
+func (b *countingBalancer) Done(*url.URL, *http.Request) { b.done++ }
+
+func TestUpstreamBalancer(t *testing.T) {
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("blue"))
+	}))
+	defer blue.Close()
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("green"))
+	}))
+	defer green.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"blue":  cty.StringVal(blue.URL),
+			"green": cty.StringVal(green.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/split.hcl", ectx)
+	require.NoError(t, err)
+
+	b := &countingBalancer{Balancer: RoundRobinBalancer()}
+	proxy, err := New(m, WithUpstreamBalancer("accounts", b))
+	require.NoError(t, err)
+
+	serve := func() string {
+		r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	// Green has no weight, so it isn't offered to the balancer.
+	require.Equal(t, "blue", serve())
+	require.Equal(t, "blue", serve())
+
+	require.NoError(t, proxy.SetSplit("accounts", map[string]int{"blue": 1, "green": 1}))
+	first, second := serve(), serve()
+	require.ElementsMatch(t, []string{"blue", "green"}, []string{first, second})
+	require.Equal(t, first, serve())
+	require.Equal(t, 5, b.done)
+
+	_, err = New(m, WithUpstreamBalancer("missing", b))
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+}
+
+// BenchmarkDestinations compares the cost of proxying to an Upstream with a
+// single destination, which skips the split, against one that chooses between
+// destinations, to guard the single-destination case against regressions.
+func BenchmarkDestinations(b *testing.B) {
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal("http://destination.local"),
+		},
+	}
+	m, err := LoadManifest("testdata/single_destination.hcl", ectx)
+	require.NoError(b, err)
+
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       http.NoBody,
+			Request:    r,
+		}, nil
+	})
+
+	benchmarks := []struct {
+		name string
+		path string
+		opts []MountOption
+	}{
+		{"destination attribute", "/single", nil},
+		{"one destination block", "/block", nil},
+		{"weighted split", "/split", nil},
+		{"balancer", "/block", []MountOption{WithUpstreamBalancer("block", RoundRobinBalancer())}},
+	}
+	for _, bb := range benchmarks {
+		b.Run(bb.name, func(b *testing.B) {
+			proxy, err := New(m, append([]MountOption{WithTransport(transport)}, bb.opts...)...)
+			require.NoError(b, err)
+			r := httptest.NewRequest(http.MethodGet, bb.path, nil)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				w := httptest.NewRecorder()
+				proxy.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					b.Fatalf("unexpected status %d", w.Code)
+				}
+			}
+		})
+	}
+}
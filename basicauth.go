@@ -0,0 +1,28 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// basicAuth is HTTP Basic Authentication configuration for an Upstream.
+type basicAuth struct {
+	realm    string
+	validate func(user, pass string) bool
+}
+
+// requireBasicAuth is middleware that rejects requests without valid HTTP
+// Basic Authentication credentials.
+func requireBasicAuth(auth basicAuth) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, pass, ok := r.BasicAuth()
+			if !ok || !auth.validate(user, pass) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", auth.realm))
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
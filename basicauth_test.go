@@ -0,0 +1,86 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestUpstreamBasicAuth(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	validate := func(user, pass string) bool {
+		return user == "admin" && pass == "secret"
+	}
+	var middlewareCalled bool
+	mw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middlewareCalled = true
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	proxy, err := New(m,
+		WithUpstreamBasicAuth("accounts", "internal", validate),
+		WithUpstreamMiddleware("accounts", mw),
+	)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	t.Run("missing credentials", func(t *testing.T) {
+		middlewareCalled = false
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.Equal(t, `Basic realm="internal"`, resp.Header.Get("WWW-Authenticate"))
+		require.False(t, middlewareCalled)
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		middlewareCalled = false
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/accounts", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "wrong")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.Equal(t, `Basic realm="internal"`, resp.Header.Get("WWW-Authenticate"))
+		require.False(t, middlewareCalled)
+	})
+
+	t.Run("valid credentials", func(t *testing.T) {
+		middlewareCalled = false
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/accounts", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "secret")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("WWW-Authenticate"))
+		require.True(t, middlewareCalled)
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		_, err := New(m, WithUpstreamBasicAuth("doesnt-exist", "internal", validate))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+}
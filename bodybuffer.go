@@ -0,0 +1,100 @@
+package pass
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// bodyBufferMemory is the largest request body WithBufferRequestBody keeps in
+// memory. Larger bodies are spooled to a temporary file.
+const bodyBufferMemory = 1 << 20
+
+// bufferRequestBody is middleware that reads request bodies of up to max bytes
+// before they're proxied and sets GetBody, so retries and fallbacks can replay
+// them. Larger bodies are streamed as usual and can't be replayed.
+func bufferRequestBody(max int64, cfg mountConfig) func(http.Handler) http.Handler {
+	memory := max
+	if memory > bodyBufferMemory {
+		memory = bodyBufferMemory
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody || r.ContentLength > max {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			buf, err := ioutil.ReadAll(io.LimitReader(r.Body, memory+1))
+			if err != nil {
+				serveError(w, r, cfg, err, http.StatusBadRequest)
+				return
+			}
+			if int64(len(buf)) <= memory {
+				setBufferedBody(r, bytes.NewReader(buf), int64(len(buf)))
+				next.ServeHTTP(w, r)
+				return
+			}
+			if memory == max {
+				// Too large to buffer; send what was read ahead of the rest of
+				// the body.
+				r.Body = readCloser{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			f, err := ioutil.TempFile("", "pass-body-")
+			if err != nil {
+				serveError(w, r, cfg, err, http.StatusInternalServerError)
+				return
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			n, err := io.Copy(f, io.MultiReader(bytes.NewReader(buf), io.LimitReader(r.Body, max-int64(len(buf))+1)))
+			if err != nil {
+				serveError(w, r, cfg, err, http.StatusBadRequest)
+				return
+			}
+			if n > max {
+				r.Body = readCloser{io.MultiReader(io.NewSectionReader(f, 0, n), r.Body), r.Body}
+				next.ServeHTTP(w, r)
+				return
+			}
+			setBufferedBody(r, io.NewSectionReader(f, 0, n), n)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setBufferedBody replaces a request's body with one read from buffered, which
+// holds n bytes, and lets GetBody read it again from the start.
+func setBufferedBody(r *http.Request, buffered io.ReaderAt, n int64) {
+	r.Body.Close()
+	r.ContentLength = n
+	if n == 0 {
+		r.Body = http.NoBody
+		return
+	}
+	r.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(io.NewSectionReader(buffered, 0, n)), nil
+	}
+	r.Body, _ = r.GetBody()
+}
+
+// rewind resets the body of a request that's being replayed, if it was
+// buffered.
+func rewind(r *http.Request) error {
+	if r.GetBody == nil || r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	body, err := r.GetBody()
+	if err != nil {
+		return err
+	}
+	r.Body = body
+	return nil
+}
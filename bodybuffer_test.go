@@ -0,0 +1,116 @@
+package pass
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestBufferRequestBody(t *testing.T) {
+	var received []byte
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(destination.URL),
+			"secondary": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		max      int64
+		size     int
+		status   int
+		attempts int32
+	}{
+		{"replayed from memory", 1 << 10, 512, http.StatusOK, 3},
+		{"replayed from temporary file", 4 << 20, 2 << 20, http.StatusOK, 3},
+		{"too large to replay", 1 << 10, 2 << 10, http.StatusBadGateway, 1},
+		{"too large for temporary file", 2 << 20, 3 << 20, http.StatusBadGateway, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = nil
+
+			// Fails the first two attempts after consuming the body.
+			var attempts int32
+			transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				if atomic.AddInt32(&attempts, 1) < 3 {
+					ioutil.ReadAll(r.Body)
+					r.Body.Close()
+					return nil, fmt.Errorf("broken transport")
+				}
+				return http.DefaultTransport.RoundTrip(r)
+			})
+
+			proxy, err := New(m,
+				WithTransport(transport),
+				WithRetries(2),
+				WithBufferRequestBody(tt.max),
+			)
+			require.NoError(t, err)
+			server := httptest.NewServer(proxy)
+			defer server.Close()
+			client := &http.Client{Timeout: 5 * time.Second}
+
+			body := bytes.Repeat([]byte("a"), tt.size)
+			resp, err := client.Post(server.URL+"/widgets", "text/plain", bytes.NewReader(body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, tt.status, resp.StatusCode)
+			require.Equal(t, tt.attempts, atomic.LoadInt32(&attempts))
+			if tt.status == http.StatusOK {
+				require.Equal(t, body, received)
+			}
+		})
+	}
+}
+
+func TestBufferRequestBodyFallback(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer primary.Close()
+	var received []byte
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer secondary.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(primary.URL),
+			"secondary": cty.StringVal(secondary.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m,
+		WithUpstreamFallback("primary", "secondary"),
+		WithBufferRequestBody(1<<10),
+	)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPost, "/widgets", bytes.NewBufferString("payload"))
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "payload", string(received))
+}
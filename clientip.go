@@ -0,0 +1,31 @@
+package pass
+
+import (
+	"net"
+	"net/http"
+)
+
+// ClientIPResolver returns the IP address of the client that made a request.
+type ClientIPResolver func(*http.Request) string
+
+// RemoteAddrClientIP is the default ClientIPResolver. It returns the IP address
+// the request's connection came from. Behind a load balancer that speaks the
+// PROXY protocol, serve the Proxy from a listener that decodes it, such as
+// github.com/pires/go-proxyproto's, and RemoteAddr will be the client's address
+// rather than the load balancer's.
+func RemoteAddrClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// stripForwarded removes the headers that reveal the client's address. Setting
+// X-Forwarded-For to nil, rather than deleting it, stops httputil.ReverseProxy
+// from adding it back.
+func stripForwarded(r *http.Request) {
+	r.Header["X-Forwarded-For"] = nil
+	r.Header.Del("X-Real-IP")
+	r.Header.Del("Forwarded")
+}
@@ -0,0 +1,131 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRemoteAddrClientIP(t *testing.T) {
+	tests := []struct {
+		remoteAddr string
+		ip         string
+	}{
+		{"203.0.113.7:4321", "203.0.113.7"},
+		{"[2001:db8::1]:4321", "2001:db8::1"},
+		{"203.0.113.7", "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remoteAddr
+		require.Equal(t, tt.ip, RemoteAddrClientIP(r), tt.remoteAddr)
+	}
+}
+
+func TestClientIPResolver(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	var captured *RouteInfo
+	observe := func(r *http.Request, info *RouteInfo) {
+		captured = info
+	}
+
+	t.Run("default", func(t *testing.T) {
+		proxy, err := New(m, WithObserveFunction(observe))
+		require.NoError(t, err)
+
+		// A listener that decodes the PROXY protocol sets RemoteAddr to the
+		// client's address.
+		r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+		r.RemoteAddr = "198.51.100.23:50000"
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "198.51.100.23", captured.ClientIP)
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		forwarded := func(r *http.Request) string {
+			if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+				return strings.TrimSpace(strings.Split(xff, ",")[0])
+			}
+			return RemoteAddrClientIP(r)
+		}
+		proxy, err := New(m, WithObserveFunction(observe), WithClientIPResolver(forwarded))
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+		r.RemoteAddr = "10.0.0.1:50000"
+		r.Header.Set("X-Forwarded-For", "198.51.100.23, 10.0.0.1")
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "198.51.100.23", captured.ClientIP)
+	})
+}
+
+func TestStripForwardedFor(t *testing.T) {
+	var received http.Header
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+			"password":    cty.StringVal("hunter2"),
+			"token":       cty.StringVal("s3cr3t"),
+		},
+	}
+	m, err := LoadManifest("testdata/auth.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m,
+		WithStripForwardedFor("open"),
+		WithRequestModifier(func(r *http.Request) {
+			r.Header.Set("X-Real-IP", "198.51.100.23")
+		}),
+	)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	send := func(path string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Forwarded-For", "198.51.100.23")
+		req.Header.Set("Forwarded", "for=198.51.100.23")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	send("/open")
+	for _, h := range []string{"X-Forwarded-For", "X-Real-IP", "Forwarded"} {
+		require.Empty(t, received.Values(h), h)
+	}
+
+	send("/basic")
+	require.Equal(t, "198.51.100.23, 127.0.0.1", received.Get("X-Forwarded-For"))
+	require.Equal(t, "198.51.100.23", received.Get("X-Real-IP"))
+
+	_, err = New(m, WithStripForwardedFor("missing"))
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+}
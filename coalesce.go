@@ -0,0 +1,156 @@
+package pass
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// coalesceKeyHeaders are the request headers, besides the method, host and
+// URL, that must match for requests to be coalesced, since responses commonly
+// vary by them.
+var coalesceKeyHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language"}
+
+// DefaultCoalesceTimeout is the deadline given to a shared upstream request
+// when the request that started it has none.
+const DefaultCoalesceTimeout = 30 * time.Second
+
+// coalesce is middleware that shares one upstream request between concurrent,
+// identical requests that can be shared: GETs without credentials that don't
+// forbid cached responses. Shared responses are buffered in full.
+//
+// The shared request runs on a context detached from the request that started
+// it, so that request's client going away doesn't fail the others. Each client
+// stops waiting when its own request is canceled or times out.
+func coalesce(g *singleflight.Group, identifier string, cfg mountConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !coalescable(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var started bool
+			ch := g.DoChan(coalesceKey(identifier, r), func() (interface{}, error) {
+				started = true
+				return sharedRequest(next, r), nil
+			})
+			select {
+			case res := <-ch:
+				resp := res.Val.(*recordedResponse)
+				if resp.panicked != nil {
+					panic(resp.panicked)
+				}
+				// Cookies are meant for the client that started the request.
+				resp.writeTo(w, !started)
+			case <-r.Context().Done():
+				err := r.Context().Err()
+				if err == context.Canceled {
+					serveError(w, r, cfg, fmt.Errorf("%w: %v", ErrClientDisconnected, err), http.StatusBadGateway)
+					return
+				}
+				serveGatewayError(w, r, cfg, err, http.StatusGatewayTimeout)
+			}
+		})
+	}
+}
+
+// sharedRequest serves a copy of r on a detached context, recording the
+// response. It keeps r's deadline, or is given DefaultCoalesceTimeout if r has
+// none. A panic is recorded rather than left to crash the process, since
+// the request is served on its own goroutine.
+func sharedRequest(next http.Handler, r *http.Request) (rec *recordedResponse) {
+	rec = &recordedResponse{header: http.Header{}}
+	defer func() {
+		if v := recover(); v != nil {
+			rec.panicked = v
+		}
+	}()
+
+	deadline, ok := r.Context().Deadline()
+	if !ok {
+		deadline = time.Now().Add(DefaultCoalesceTimeout)
+	}
+	ctx, cancel := context.WithDeadline(detachedContext{r.Context()}, deadline)
+	defer cancel()
+	next.ServeHTTP(rec, r.Clone(ctx))
+	return rec
+}
+
+// detachedContext carries a context's values, but not its deadline or
+// cancellation.
+type detachedContext struct{ context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+// coalescable reports whether a request's response can be shared with other
+// clients.
+func coalescable(r *http.Request) bool {
+	if r.Method != http.MethodGet || (r.Body != nil && r.Body != http.NoBody) {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+		return false
+	}
+	cc := strings.ToLower(r.Header.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-cache") && !strings.Contains(cc, "no-store") &&
+		!strings.Contains(r.Header.Get("Pragma"), "no-cache")
+}
+
+// coalesceKey identifies the requests that can share a response.
+func coalesceKey(identifier string, r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(identifier + "\n" + r.Host + "\n" + r.URL.String())
+	for _, h := range coalesceKeyHeaders {
+		b.WriteString("\n" + strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+// recordedResponse is an http.ResponseWriter that records a response so it
+// can be written to several clients.
+type recordedResponse struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	panicked interface{} // Value the handler panicked with, if it did
+}
+
+func (rr *recordedResponse) Header() http.Header { return rr.header }
+
+func (rr *recordedResponse) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	return rr.body.Write(b)
+}
+
+func (rr *recordedResponse) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+}
+
+// writeTo writes the recorded response to w, without its Set-Cookie headers
+// if they belong to another client.
+func (rr *recordedResponse) writeTo(w http.ResponseWriter, dropCookies bool) {
+	for k, vs := range rr.header {
+		if dropCookies && k == "Set-Cookie" {
+			continue
+		}
+		w.Header()[k] = append([]string(nil), vs...)
+	}
+	status := rr.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(rr.body.Bytes())
+}
@@ -0,0 +1,207 @@
+package pass
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRequestCoalescing(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Header().Set("X-Widget", "1")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("widget"))
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(destination.URL),
+			"secondary": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithRequestCoalescing("primary"))
+	require.NoError(t, err)
+
+	// Fires n concurrent requests and releases the destination once they've
+	// had time to arrive.
+	fire := func(n int, header http.Header) []*httptest.ResponseRecorder {
+		atomic.StoreInt32(&hits, 0)
+		var wg sync.WaitGroup
+		recorders := make([]*httptest.ResponseRecorder, n)
+		for i := range recorders {
+			recorders[i] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(w *httptest.ResponseRecorder) {
+				defer wg.Done()
+				r := httptest.NewRequest(http.MethodGet, "/widgets?page=1", nil)
+				for k, vs := range header {
+					r.Header[k] = vs
+				}
+				proxy.ServeHTTP(w, r)
+			}(recorders[i])
+		}
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&hits) > 0 }, time.Second, time.Millisecond)
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		release = make(chan struct{})
+		return recorders
+	}
+
+	t.Run("coalesced", func(t *testing.T) {
+		for _, w := range fire(20, nil) {
+			require.Equal(t, http.StatusAccepted, w.Code)
+			require.Equal(t, "1", w.Header().Get("X-Widget"))
+			require.Equal(t, "widget", w.Body.String())
+		}
+		require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("with credentials", func(t *testing.T) {
+		fire(5, http.Header{"Authorization": {"Bearer token"}})
+		require.Equal(t, int32(5), atomic.LoadInt32(&hits))
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		_, err := New(m, WithRequestCoalescing("missing"))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+}
+
+func TestRequestCoalescingLeaderCanceled(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		w.Write([]byte("widget"))
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(destination.URL),
+			"secondary": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	var errs []error
+	var mu sync.Mutex
+	proxy, err := New(m,
+		WithRequestCoalescing("primary"),
+		WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+			w.WriteHeader(http.StatusBadGateway)
+		}),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := httptest.NewRecorder()
+	leaderDone := make(chan struct{})
+	go func() {
+		defer close(leaderDone)
+		proxy.ServeHTTP(leader, httptest.NewRequest(http.MethodGet, "/widgets", nil).WithContext(ctx))
+	}()
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&hits) == 1 }, time.Second, time.Millisecond)
+
+	waiter := httptest.NewRecorder()
+	waiterDone := make(chan struct{})
+	go func() {
+		defer close(waiterDone)
+		proxy.ServeHTTP(waiter, httptest.NewRequest(http.MethodGet, "/widgets", nil))
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The leader's client goes away while the upstream request is in flight.
+	// It stops waiting, but the request carries on for the waiter.
+	cancel()
+	select {
+	case <-leaderDone:
+	case <-time.After(time.Second):
+		t.Fatal("canceled request still waiting")
+	}
+	require.Equal(t, http.StatusBadGateway, leader.Code)
+	mu.Lock()
+	require.Len(t, errs, 1)
+	require.True(t, errors.Is(errs[0], ErrClientDisconnected))
+	mu.Unlock()
+
+	close(release)
+	<-waiterDone
+	require.Equal(t, http.StatusOK, waiter.Code)
+	require.Equal(t, "widget", waiter.Body.String())
+	require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestRequestCoalescingCookies(t *testing.T) {
+	var hits int32
+	release := make(chan struct{})
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		<-release
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc"})
+		w.Write([]byte("widget"))
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(destination.URL),
+			"secondary": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithRequestCoalescing("primary"))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 10)
+	for i := range recorders {
+		recorders[i] = httptest.NewRecorder()
+		wg.Add(1)
+		go func(w *httptest.ResponseRecorder) {
+			defer wg.Done()
+			proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/widgets", nil))
+		}(recorders[i])
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&hits) > 0 }, time.Second, time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&hits))
+
+	// Only the client whose request reached the upstream gets the cookie.
+	var cookies int
+	for _, w := range recorders {
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "widget", w.Body.String())
+		if w.Header().Get("Set-Cookie") != "" {
+			cookies++
+		}
+	}
+	require.Equal(t, 1, cookies)
+}
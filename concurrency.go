@@ -0,0 +1,64 @@
+package pass
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// ErrConcurrencyLimit is passed to the ErrorHandler when a request isn't
+// proxied because its Upstream already has the maximum number of requests in
+// flight.
+var ErrConcurrencyLimit = fmt.Errorf("upstream concurrency limit reached")
+
+// limitConcurrency is middleware that caps the number of requests in flight to
+// an Upstream using sem as a semaphore. Requests over the limit are answered
+// with 503 Service Unavailable if they can't get a slot within
+// cfg.concurrencyWait.
+func limitConcurrency(sem chan struct{}, cfg mountConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !acquire(r.Context(), sem, cfg.concurrencyWait) {
+				serveError(w, r, cfg, ErrConcurrencyLimit, http.StatusServiceUnavailable)
+				return
+			}
+			defer func() { <-sem }()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// acquire takes a slot in the semaphore, waiting up to wait for one to free up.
+func acquire(ctx context.Context, sem chan struct{}, wait time.Duration) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// InFlight returns the number of requests currently being proxied to an
+// Upstream.
+func (p *Proxy) InFlight(identifier string) (int, error) {
+	state, ok := p.current().upstreams[identifier]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownUpstream, identifier)
+	}
+	return int(atomic.LoadInt64(&state.inFlight)), nil
+}
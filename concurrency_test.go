@@ -0,0 +1,132 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	arrived := make(chan struct{})
+	release := make(chan struct{})
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Block") != "" {
+			arrived <- struct{}{}
+			<-release
+		}
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	// block sends a request that holds its concurrency slot until release is
+	// signaled.
+	block := func(url string) <-chan int {
+		status := make(chan int, 1)
+		go func() {
+			req, _ := http.NewRequest(http.MethodGet, url+"/accounts", nil)
+			req.Header.Set("Block", "true")
+			resp, err := client.Do(req)
+			if err != nil {
+				status <- 0
+				return
+			}
+			status <- resp.StatusCode
+		}()
+		<-arrived
+		return status
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		proxy, err := New(m, WithUpstreamConcurrencyLimit("accounts", 1))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		status := block(server.URL)
+
+		n, err := proxy.InFlight("accounts")
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		release <- struct{}{}
+		require.Equal(t, http.StatusOK, <-status)
+
+		resp, err = client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		n, err = proxy.InFlight("accounts")
+		require.NoError(t, err)
+		require.Equal(t, 0, n)
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		proxy, err := New(m,
+			WithUpstreamConcurrencyLimit("accounts", 1),
+			WithConcurrencyLimitWait(500*time.Millisecond),
+		)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		status := block(server.URL)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			release <- struct{}{}
+		}()
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, http.StatusOK, <-status)
+	})
+
+	t.Run("error handler", func(t *testing.T) {
+		var capturedErr error
+		errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusTeapot)
+			capturedErr = err
+		}
+
+		proxy, err := New(m,
+			WithUpstreamConcurrencyLimit("accounts", 1),
+			WithErrorHandler(errorHandler),
+		)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		status := block(server.URL)
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTeapot, resp.StatusCode)
+		require.Equal(t, ErrConcurrencyLimit, capturedErr)
+
+		release <- struct{}{}
+		require.Equal(t, http.StatusOK, <-status)
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		_, err := New(m, WithUpstreamConcurrencyLimit("doesnt-exist", 1))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+}
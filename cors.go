@@ -0,0 +1,129 @@
+package pass
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig is Cross-Origin Resource Sharing configuration for an Upstream.
+type CORSConfig struct {
+	AllowedOrigins   []string      // Origins permitted to make requests. "*" permits any origin.
+	AllowedMethods   []string      // Methods permitted in requests. Defaults to the methods of the Upstream's routes.
+	AllowedHeaders   []string      // Headers permitted in requests
+	AllowCredentials bool          // Permit requests that include credentials
+	MaxAge           time.Duration // How long the results of a preflight request can be cached
+}
+
+// cors is middleware that applies a CORSConfig to an Upstream's routes.
+// Preflight requests are answered directly rather than being proxied.
+type cors struct {
+	cfg     CORSConfig
+	methods string
+	headers string
+}
+
+func newCORS(cfg CORSConfig, u Upstream) *cors {
+	methods := upperMethods(cfg.AllowedMethods)
+	if len(methods) == 0 {
+		methods = routeMethods(u)
+	}
+	return &cors{
+		cfg:     cfg,
+		methods: strings.Join(methods, ", "),
+		headers: strings.Join(cfg.AllowedHeaders, ", "),
+	}
+}
+
+// routeMethods returns the unique methods declared by an Upstream's routes in
+// the order they're declared.
+func routeMethods(u Upstream) []string {
+	var methods []string
+	seen := map[string]bool{}
+	for _, rt := range u.Routes {
+		for _, m := range rt.Methods {
+			if !seen[m] {
+				seen[m] = true
+				methods = append(methods, m)
+			}
+		}
+	}
+	return methods
+}
+
+func (c *cors) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if preflight {
+			w.Header().Add("Vary", "Origin")
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			if c.allowOrigin(w, origin) && c.allowMethod(r.Header.Get("Access-Control-Request-Method")) {
+				w.Header().Set("Access-Control-Allow-Methods", c.methods)
+				if c.headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", c.headers)
+				}
+				if c.cfg.MaxAge > 0 {
+					w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.cfg.MaxAge/time.Second)))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if origin != "" {
+			w.Header().Add("Vary", "Origin")
+			c.allowOrigin(w, origin)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowOrigin sets the headers permitting the origin, if it's allowed.
+func (c *cors) allowOrigin(w http.ResponseWriter, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, o := range c.cfg.AllowedOrigins {
+		if o != "*" && o != origin {
+			continue
+		}
+		if o == "*" && !c.cfg.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if c.cfg.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		return true
+	}
+	return false
+}
+
+func (c *cors) allowMethod(method string) bool {
+	for _, m := range strings.Split(c.methods, ", ") {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMethod(route Route, method string) bool {
+	for _, m := range route.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// methodNotAllowed answers OPTIONS requests that aren't preflights on routes
+// that don't declare OPTIONS themselves.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusMethodNotAllowed)
+}
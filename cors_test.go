@@ -0,0 +1,109 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestUpstreamCORS(t *testing.T) {
+	var proxied bool
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = true
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	validate := func(user, pass string) bool {
+		return user == "admin" && pass == "secret"
+	}
+	proxy, err := New(m,
+		WithUpstreamCORS("accounts", CORSConfig{
+			AllowedOrigins:   []string{"https://app.example.com"},
+			AllowedHeaders:   []string{"Authorization", "Content-Type"},
+			AllowCredentials: true,
+			MaxAge:           10 * time.Minute,
+		}),
+		WithUpstreamBasicAuth("accounts", "internal", validate),
+	)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	preflight := func(t *testing.T, origin, method string) *http.Response {
+		req, err := http.NewRequest(http.MethodOptions, server.URL+"/accounts", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", method)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		proxied = false
+		resp := preflight(t, "https://app.example.com", http.MethodGet)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "GET", resp.Header.Get("Access-Control-Allow-Methods"))
+		require.Equal(t, "Authorization, Content-Type", resp.Header.Get("Access-Control-Allow-Headers"))
+		require.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+		require.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+		require.False(t, proxied)
+	})
+
+	t.Run("preflight disallowed origin", func(t *testing.T) {
+		resp := preflight(t, "https://evil.example.com", http.MethodGet)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+		require.Empty(t, resp.Header.Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("preflight disallowed method", func(t *testing.T) {
+		resp := preflight(t, "https://app.example.com", http.MethodDelete)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("options without preflight", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodOptions, server.URL+"/accounts", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", "secret")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+
+	t.Run("actual request", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/accounts", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "https://app.example.com")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		_, err := New(m, WithUpstreamCORS("doesnt-exist", CORSConfig{}))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+}
@@ -0,0 +1,41 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrInvalidSunset is returned when a route's sunset isn't a date or an RFC
+// 3339 timestamp.
+var ErrInvalidSunset = fmt.Errorf("invalid sunset")
+
+// parseSunset parses a route's sunset, which is either a date, taken as
+// midnight UTC, or an RFC 3339 timestamp.
+func parseSunset(s string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// deprecate is middleware that tells clients a route is deprecated with the
+// Deprecation header, and when it will stop working with the Sunset header
+// (RFC 8594).
+func deprecate(route Route) func(http.Handler) http.Handler {
+	var sunset string
+	if t, err := parseSunset(route.Sunset); err == nil {
+		sunset = t.UTC().Format(http.TimeFormat)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route.Deprecated {
+				w.Header().Set("Deprecation", "true")
+			}
+			if sunset != "" {
+				w.Header().Set("Sunset", sunset)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDeprecation(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/deprecation.hcl", ectx)
+	require.NoError(t, err)
+	require.True(t, m.Upstreams[0].Routes[0].Deprecated)
+	require.Equal(t, "2025-01-01", m.Upstreams[0].Routes[0].Sunset)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name        string
+		path        string
+		deprecation string
+		sunset      string
+	}{
+		{"deprecated with sunset", "/v1/widgets", "true", "Wed, 01 Jan 2025 00:00:00 GMT"},
+		{"deprecated", "/v1/gadgets", "true", ""},
+		{"current", "/v2/widgets", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tt.path)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, tt.deprecation, resp.Header.Get("Deprecation"))
+			require.Equal(t, tt.sunset, resp.Header.Get("Sunset"))
+		})
+	}
+}
+
+func TestParseSunset(t *testing.T) {
+	sunset, err := parseSunset("2025-06-30T12:00:00+02:00")
+	require.NoError(t, err)
+	require.Equal(t, "Mon, 30 Jun 2025 10:00:00 GMT", sunset.UTC().Format(http.TimeFormat))
+
+	m := &Manifest{}
+	err = m.AddUpstream(Upstream{
+		Identifier:  "widgets",
+		Destination: "http://widgets.local",
+		Routes:      []Route{{Methods: []string{http.MethodGet}, Path: "/widgets", Sunset: "next year"}},
+	})
+	require.True(t, errors.Is(err, ErrInvalidSunset))
+}
@@ -0,0 +1,201 @@
+package pass
+
+import (
+	"net/url"
+	"path"
+	"sort"
+	"time"
+)
+
+// redacted replaces secrets in a ProxyDescription.
+const redacted = "REDACTED"
+
+// ProxyDescription is a snapshot of a Proxy's effective configuration, once its
+// options and the Manifest's defaults are applied. Secrets are redacted, so it
+// can be served, such as on a debug endpoint. See Proxy.Describe.
+type ProxyDescription struct {
+	Root                string                `json:"root"`
+	KeepTrailingSlashes bool                  `json:"keep_trailing_slashes"`
+	ImplicitHead        bool                  `json:"implicit_head"`
+	RecoverPanics       bool                  `json:"recover_panics"`
+	MaxHeaderBytes      int                   `json:"max_header_bytes"`
+	Retries             int                   `json:"retries"`
+	BufferBodyMax       int64                 `json:"buffer_body_max"`
+	StreamingUploads    bool                  `json:"streaming_uploads"`
+	PrefixRedirect      bool                  `json:"prefix_redirect"`
+	RejectBodyMethods   []string              `json:"reject_body_methods,omitempty"`
+	RequestIDHeader     string                `json:"request_id_header,omitempty"`
+	MiddlewareOrder     []string              `json:"middleware_order"`
+	Middleware          int                   `json:"middleware"` // Global middleware
+	Upstreams           []UpstreamDescription `json:"upstreams"`
+}
+
+// UpstreamDescription is the effective configuration of an Upstream. Durations
+// are in milliseconds.
+type UpstreamDescription struct {
+	Identifier              string                   `json:"identifier"`
+	Prefix                  string                   `json:"prefix"`
+	StripPrefix             bool                     `json:"strip_prefix"`
+	Destinations            []DestinationDescription `json:"destinations,omitempty"`
+	Redirect                string                   `json:"redirect,omitempty"`
+	Routes                  int                      `json:"routes"`
+	Protocol                string                   `json:"protocol,omitempty"`
+	Host                    string                   `json:"host,omitempty"`
+	TimeoutMS               int64                    `json:"timeout_ms"`
+	FlushIntervalMS         int64                    `json:"flush_interval_ms"`
+	DialTimeoutMS           int                      `json:"dial_timeout_ms"`
+	TLSHandshakeTimeoutMS   int                      `json:"tls_handshake_timeout_ms"`
+	ResponseHeaderTimeoutMS int                      `json:"response_header_timeout_ms"`
+	SlowThresholdMS         int                      `json:"slow_threshold_ms"`
+	MaxHeaderBytes          int                      `json:"max_header_bytes"`
+	ConcurrencyLimit        int                      `json:"concurrency_limit,omitempty"`
+	Auth                    *UpstreamAuth            `json:"auth,omitempty"`
+	BasicAuth               bool                     `json:"basic_auth"`
+	CORS                    bool                     `json:"cors"`
+	Fallback                string                   `json:"fallback,omitempty"`
+	Shadow                  string                   `json:"shadow,omitempty"`
+	ShadowFraction          float64                  `json:"shadow_fraction,omitempty"`
+	Balancer                bool                     `json:"balancer"`
+	StickySessions          bool                     `json:"sticky_sessions"`
+	Middleware              MiddlewareCounts         `json:"middleware"`
+	Enabled                 bool                     `json:"enabled"`
+}
+
+// DestinationDescription is one of an Upstream's destinations. Credentials in
+// its URL are redacted.
+type DestinationDescription struct {
+	Identifier string `json:"identifier,omitempty"`
+	URL        string `json:"url"`
+	Weight     int    `json:"weight,omitempty"`
+}
+
+// MiddlewareCounts are the number of middleware registered for an Upstream's
+// routes at each MiddlewareLayer, other than the global layer. Route
+// middleware is counted across all of the Upstream's routes.
+type MiddlewareCounts struct {
+	Annotation int `json:"annotation"`
+	Upstream   int `json:"upstream"`
+	Route      int `json:"route"`
+}
+
+// Describe returns a snapshot of the Proxy's effective configuration.
+func (p *Proxy) Describe() ProxyDescription {
+	rt := p.current()
+	cfg := rt.cfg
+
+	d := ProxyDescription{
+		Root:                rootOrSlash(rt.root),
+		KeepTrailingSlashes: cfg.keepTrailingSlashes,
+		ImplicitHead:        cfg.implicitHead,
+		RecoverPanics:       cfg.recoverPanics,
+		MaxHeaderBytes:      cfg.maxHeaderBytes,
+		Retries:             cfg.retries,
+		BufferBodyMax:       cfg.bufferBodyMax,
+		StreamingUploads:    cfg.streamUploads,
+		PrefixRedirect:      cfg.prefixRedirect,
+		RequestIDHeader:     cfg.requestIDHeader,
+		Middleware:          len(cfg.middleware),
+		Upstreams:           []UpstreamDescription{},
+	}
+	for m := range cfg.bodilessMethods {
+		d.RejectBodyMethods = append(d.RejectBodyMethods, m)
+	}
+	sort.Strings(d.RejectBodyMethods)
+	for _, l := range cfg.middlewareOrder {
+		d.MiddlewareOrder = append(d.MiddlewareOrder, l.String())
+	}
+	for _, u := range rt.manifest.Upstreams {
+		d.Upstreams = append(d.Upstreams, describeUpstream(rt, u, cfg))
+	}
+	return d
+}
+
+// describeUpstream returns the effective configuration of the Upstream.
+func describeUpstream(rt *routing, u Upstream, cfg mountConfig) UpstreamDescription {
+	prefix := rootOrSlash(path.Join(rt.root, u.PrefixPath))
+	d := UpstreamDescription{
+		Identifier:              u.Identifier,
+		Prefix:                  prefix,
+		StripPrefix:             u.StripsPrefix(),
+		Routes:                  len(u.Routes),
+		Protocol:                u.Protocol,
+		Host:                    u.Host,
+		TimeoutMS:               durationMS(time.Duration(u.TimeoutMS) * time.Millisecond),
+		FlushIntervalMS:         durationMS(u.FlushInterval()),
+		DialTimeoutMS:           u.DialTimeoutMS,
+		TLSHandshakeTimeoutMS:   u.TLSHandshakeTimeoutMS,
+		ResponseHeaderTimeoutMS: u.ResponseHeaderTimeoutMS,
+		SlowThresholdMS:         u.SlowThresholdMS,
+		ConcurrencyLimit:        cfg.concurrencyLimits[u.Identifier],
+		Enabled:                 rt.upstreams[u.Identifier].enabled(),
+	}
+	d.MaxHeaderBytes, _ = maxHeaderBytes(u, cfg)
+
+	switch {
+	case u.Redirect != nil:
+		d.Redirect = u.Redirect.To
+	case u.Destination != "":
+		d.Destinations = []DestinationDescription{{URL: redactURL(u.Destination)}}
+	default:
+		for _, dest := range u.Destinations {
+			d.Destinations = append(d.Destinations, DestinationDescription{
+				Identifier: dest.Identifier,
+				URL:        redactURL(dest.URL),
+				Weight:     dest.Weight,
+			})
+		}
+	}
+	if u.Auth != nil {
+		auth := *u.Auth
+		if auth.Password != "" {
+			auth.Password = redacted
+		}
+		if auth.Token != "" {
+			auth.Token = redacted
+		}
+		d.Auth = &auth
+	}
+
+	_, d.BasicAuth = cfg.basicAuth[u.Identifier]
+	_, d.CORS = cfg.cors[u.Identifier]
+	_, d.Balancer = cfg.balancers[u.Identifier]
+	_, d.StickySessions = cfg.sticky[u.Identifier]
+	d.Fallback = cfg.fallbacks[u.Identifier]
+	if s, ok := cfg.shadows[u.Identifier]; ok {
+		d.Shadow, d.ShadowFraction = s.identifier, s.fraction
+	}
+
+	for _, am := range cfg.annotationMws {
+		if _, ok := u.Annotations[am.key]; ok {
+			d.Middleware.Annotation++
+		}
+	}
+	d.Middleware.Upstream = len(cfg.upstreamMiddleware[u.Identifier])
+	for _, rm := range cfg.routeMiddleware {
+		if rm.upstream == u.Identifier {
+			d.Middleware.Route += len(rm.stack)
+		}
+	}
+	return d
+}
+
+// redactURL replaces the password in a URL, if it has one.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return u.String()
+}
+
+// durationMS returns d in milliseconds, keeping negative values, which disable
+// some settings, as -1.
+func durationMS(d time.Duration) int64 {
+	if d < 0 {
+		return -1
+	}
+	return d.Milliseconds()
+}
@@ -0,0 +1,229 @@
+package pass
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ManifestDiff describes the changes between two Manifests, such as for
+// auditing reloads. An Upstream that's only modified can be applied on its own
+// with Proxy.ReplaceUpstream.
+type ManifestDiff struct {
+	Fields      []string       // Manifest attributes that changed, by HCL name, such as "prefix_path"
+	Annotations AnnotationDiff // Changes to the Manifest's annotations
+	Added       []string       // Identifiers of Upstreams only in the new Manifest
+	Removed     []string       // Identifiers of Upstreams only in the old Manifest
+	Modified    []UpstreamDiff // Upstreams in both Manifests that changed
+}
+
+// UpstreamDiff describes the changes to an Upstream present in both Manifests.
+// A changed route is reported as the old route removed and the new one added.
+type UpstreamDiff struct {
+	Identifier    string
+	Fields        []string       // Attributes and blocks that changed, other than routes and annotations, such as "destination"
+	Annotations   AnnotationDiff // Changes to the Upstream's annotations
+	AddedRoutes   []Route        // Routes only in the new Upstream
+	RemovedRoutes []Route        // Routes only in the old Upstream
+}
+
+// AnnotationDiff describes the changes to a set of annotations, by key.
+type AnnotationDiff struct {
+	Added   []string
+	Removed []string
+	Changed []string
+}
+
+// Diff returns the changes that turn m into other. A nil Manifest is treated as
+// empty.
+func (m *Manifest) Diff(other *Manifest) ManifestDiff {
+	if m == nil {
+		m = &Manifest{}
+	}
+	if other == nil {
+		other = &Manifest{}
+	}
+
+	d := ManifestDiff{
+		Fields:      changedFields(*m, *other, "annotations", "upstream"),
+		Annotations: diffAnnotations(m.Annotations, other.Annotations),
+	}
+
+	old := map[string]Upstream{}
+	for _, u := range m.Upstreams {
+		old[u.Identifier] = u
+	}
+	current := map[string]bool{}
+	for _, u := range other.Upstreams {
+		current[u.Identifier] = true
+		prev, ok := old[u.Identifier]
+		if !ok {
+			d.Added = append(d.Added, u.Identifier)
+			continue
+		}
+		if ud := diffUpstream(prev, u); !ud.empty() {
+			d.Modified = append(d.Modified, ud)
+		}
+	}
+	for _, u := range m.Upstreams {
+		if !current[u.Identifier] {
+			d.Removed = append(d.Removed, u.Identifier)
+		}
+	}
+	return d
+}
+
+// Empty reports whether the Manifests were the same.
+func (d ManifestDiff) Empty() bool {
+	return len(d.Fields) == 0 && d.Annotations.Empty() &&
+		len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// String summarizes the changes on a single line, for logging.
+func (d ManifestDiff) String() string {
+	if d.Empty() {
+		return "no changes"
+	}
+
+	var parts []string
+	if len(d.Fields) > 0 {
+		parts = append(parts, fmt.Sprintf("changed %s", strings.Join(d.Fields, ", ")))
+	}
+	if !d.Annotations.Empty() {
+		parts = append(parts, fmt.Sprintf("annotations %s", d.Annotations))
+	}
+	if len(d.Added) > 0 {
+		parts = append(parts, fmt.Sprintf("added upstreams %s", strings.Join(d.Added, ", ")))
+	}
+	if len(d.Removed) > 0 {
+		parts = append(parts, fmt.Sprintf("removed upstreams %s", strings.Join(d.Removed, ", ")))
+	}
+	for _, u := range d.Modified {
+		parts = append(parts, fmt.Sprintf("modified upstream %s (%s)", u.Identifier, u))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// diffUpstream compares two versions of an Upstream.
+func diffUpstream(a, b Upstream) UpstreamDiff {
+	d := UpstreamDiff{
+		Identifier:  b.Identifier,
+		Fields:      changedFields(a, b, "annotations", "route"),
+		Annotations: diffAnnotations(a.Annotations, b.Annotations),
+	}
+	for _, r := range b.Routes {
+		if !containsRoute(a.Routes, r) {
+			d.AddedRoutes = append(d.AddedRoutes, r)
+		}
+	}
+	for _, r := range a.Routes {
+		if !containsRoute(b.Routes, r) {
+			d.RemovedRoutes = append(d.RemovedRoutes, r)
+		}
+	}
+	return d
+}
+
+func (d UpstreamDiff) empty() bool {
+	return len(d.Fields) == 0 && d.Annotations.Empty() &&
+		len(d.AddedRoutes) == 0 && len(d.RemovedRoutes) == 0
+}
+
+// String summarizes the changes to the Upstream.
+func (d UpstreamDiff) String() string {
+	parts := append([]string{}, d.Fields...)
+	if !d.Annotations.Empty() {
+		parts = append(parts, fmt.Sprintf("annotations %s", d.Annotations))
+	}
+	for _, r := range d.AddedRoutes {
+		parts = append(parts, fmt.Sprintf("+route %s %s", strings.Join(r.Methods, ","), r.Path))
+	}
+	for _, r := range d.RemovedRoutes {
+		parts = append(parts, fmt.Sprintf("-route %s %s", strings.Join(r.Methods, ","), r.Path))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func containsRoute(routes []Route, r Route) bool {
+	for _, candidate := range routes {
+		if reflect.DeepEqual(candidate, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffAnnotations compares two sets of annotations. Keys are sorted.
+func diffAnnotations(a, b map[string]string) AnnotationDiff {
+	var d AnnotationDiff
+	for k, v := range b {
+		prev, ok := a[k]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, k)
+		case prev != v:
+			d.Changed = append(d.Changed, k)
+		}
+	}
+	for k := range a {
+		if _, ok := b[k]; !ok {
+			d.Removed = append(d.Removed, k)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	return d
+}
+
+// Empty reports whether the annotations were the same.
+func (d AnnotationDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// String summarizes the changed keys, such as "+owner -team ~tier".
+func (d AnnotationDiff) String() string {
+	var parts []string
+	for _, k := range d.Added {
+		parts = append(parts, "+"+k)
+	}
+	for _, k := range d.Removed {
+		parts = append(parts, "-"+k)
+	}
+	for _, k := range d.Changed {
+		parts = append(parts, "~"+k)
+	}
+	return strings.Join(parts, " ")
+}
+
+// changedFields returns the HCL names of the fields that differ between two
+// values of the same struct type. The label and the named fields are skipped.
+func changedFields(a, b interface{}, skip ...string) []string {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	t := va.Type()
+
+	var changed []string
+fields:
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("hcl")
+		name := strings.Split(tag, ",")[0]
+		if f.PkgPath != "" || name == "" {
+			continue
+		}
+		for _, s := range skip {
+			if name == s {
+				continue fields
+			}
+		}
+		// The destination attribute and blocks share a name.
+		if n := len(changed); n > 0 && changed[n-1] == name {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
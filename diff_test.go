@@ -0,0 +1,79 @@
+package pass
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestDiff(t *testing.T) {
+	accounts := Upstream{
+		Identifier:  "accounts",
+		Destination: "http://accounts.local",
+		Annotations: map[string]string{"owner": "identity", "tier": "1"},
+		Routes: []Route{
+			{Methods: []string{"GET"}, Path: "/accounts"},
+			{Methods: []string{"POST"}, Path: "/accounts"},
+		},
+	}
+	widgets := Upstream{
+		Identifier:  "widgets",
+		Destination: "http://widgets.local",
+		Routes:      []Route{{Methods: []string{"GET"}, Path: "/widgets"}},
+	}
+	base := &Manifest{Upstreams: []Upstream{accounts}}
+
+	t.Run("unchanged", func(t *testing.T) {
+		d := base.Diff(&Manifest{Upstreams: []Upstream{accounts}})
+		require.True(t, d.Empty())
+		require.Equal(t, "no changes", d.String())
+	})
+
+	t.Run("added", func(t *testing.T) {
+		d := base.Diff(&Manifest{Upstreams: []Upstream{accounts, widgets}})
+		require.Equal(t, ManifestDiff{Added: []string{"widgets"}}, d)
+		require.Equal(t, "added upstreams widgets", d.String())
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		d := base.Diff(&Manifest{})
+		require.Equal(t, ManifestDiff{Removed: []string{"accounts"}}, d)
+		require.Equal(t, d, base.Diff(nil))
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		modified := accounts
+		modified.Destination = "http://accounts-v2.local"
+		modified.TimeoutMS = 500
+		modified.Annotations = map[string]string{"owner": "platform", "region": "us"}
+		modified.Routes = []Route{
+			{Methods: []string{"GET"}, Path: "/accounts"},
+			{Methods: []string{"PUT"}, Path: "/accounts"},
+		}
+
+		d := base.Diff(&Manifest{
+			PrefixPath:  "/api",
+			Annotations: map[string]string{"version": "2"},
+			Upstreams:   []Upstream{modified},
+		})
+		require.Equal(t, ManifestDiff{
+			Fields:      []string{"prefix_path"},
+			Annotations: AnnotationDiff{Added: []string{"version"}},
+			Modified: []UpstreamDiff{{
+				Identifier: "accounts",
+				Fields:     []string{"destination", "timeout_ms"},
+				Annotations: AnnotationDiff{
+					Added:   []string{"region"},
+					Removed: []string{"tier"},
+					Changed: []string{"owner"},
+				},
+				AddedRoutes:   []Route{{Methods: []string{"PUT"}, Path: "/accounts"}},
+				RemovedRoutes: []Route{{Methods: []string{"POST"}, Path: "/accounts"}},
+			}},
+		}, d)
+		require.Equal(t,
+			"changed prefix_path; annotations +version; modified upstream accounts (destination, timeout_ms, annotations +region -tier ~owner, +route PUT /accounts, -route POST /accounts)",
+			d.String(),
+		)
+	})
+}
@@ -0,0 +1,101 @@
+package pass
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUpstreamDrained is passed to the ErrorHandler when a request in flight to
+// an Upstream is canceled because Proxy.DrainUpstream's grace period ran out.
+var ErrUpstreamDrained = fmt.Errorf("upstream drained")
+
+// drainPollInterval is how often Proxy.DrainUpstream checks whether an
+// Upstream's requests have finished.
+const drainPollInterval = 10 * time.Millisecond
+
+// cancelable is a request in flight that can be canceled by a drain.
+type cancelable struct {
+	cancel  context.CancelFunc
+	aborted int32 // Accessed atomically
+}
+
+// cancelableKey is the context key for a request's *cancelable.
+type cancelableKey struct{}
+
+// inFlightRequests are the requests in flight to an Upstream.
+type inFlightRequests struct {
+	mu       sync.Mutex
+	requests map[*cancelable]struct{}
+}
+
+// add registers a request, returning a copy that's canceled by abort and a
+// function to call once it's finished.
+func (f *inFlightRequests) add(r *http.Request) (*http.Request, func()) {
+	ctx, cancel := context.WithCancel(r.Context())
+	c := &cancelable{cancel: cancel}
+
+	f.mu.Lock()
+	if f.requests == nil {
+		f.requests = map[*cancelable]struct{}{}
+	}
+	f.requests[c] = struct{}{}
+	f.mu.Unlock()
+
+	done := func() {
+		f.mu.Lock()
+		delete(f.requests, c)
+		f.mu.Unlock()
+		cancel()
+	}
+	return r.WithContext(context.WithValue(ctx, cancelableKey{}, c)), done
+}
+
+// abort cancels every request in flight.
+func (f *inFlightRequests) abort() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.requests {
+		atomic.StoreInt32(&c.aborted, 1)
+		c.cancel()
+	}
+}
+
+// drained reports whether the request was canceled by a drain.
+func drained(ctx context.Context) bool {
+	c, ok := ctx.Value(cancelableKey{}).(*cancelable)
+	return ok && atomic.LoadInt32(&c.aborted) == 1
+}
+
+// DrainUpstream takes an Upstream out of rotation, as with SetUpstreamEnabled,
+// and waits for the requests in flight to it to finish. If ctx is done first,
+// the remaining requests are canceled, answered as for ErrUpstreamDrained, and
+// ctx's error is returned. The Upstream stays disabled until it's enabled with
+// SetUpstreamEnabled.
+func (p *Proxy) DrainUpstream(ctx context.Context, identifier string) error {
+	state, ok := p.current().upstreams[identifier]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownUpstream, identifier)
+	}
+	atomic.StoreInt32(&state.disabled, 1)
+
+	// Wait out requests that were let through before the Upstream was
+	// disabled but aren't counted yet.
+	state.admit.Lock()
+	state.admit.Unlock()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for atomic.LoadInt64(&state.inFlight) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			state.requests.abort()
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package pass
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestDrainUpstream(t *testing.T) {
+	release := make(chan struct{})
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	// Serves a request in the background, once it's in flight.
+	serve := func(t *testing.T, proxy *Proxy) <-chan int {
+		codes := make(chan int, 1)
+		go func() {
+			r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+		require.Eventually(t, func() bool {
+			n, _ := proxy.InFlight("accounts")
+			return n == 1
+		}, time.Second, time.Millisecond)
+		return codes
+	}
+
+	t.Run("waits for requests in flight", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+		codes := serve(t, proxy)
+
+		drained := make(chan error, 1)
+		go func() {
+			drained <- proxy.DrainUpstream(context.Background(), "accounts")
+		}()
+
+		// New requests aren't proxied once the upstream starts draining.
+		require.Eventually(t, func() bool {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			r := httptest.NewRequest(http.MethodGet, "/accounts", nil).WithContext(ctx)
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			return w.Code == http.StatusServiceUnavailable
+		}, time.Second, time.Millisecond)
+		select {
+		case <-drained:
+			t.Fatal("drain returned with a request in flight")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		release <- struct{}{}
+		require.Equal(t, http.StatusOK, <-codes)
+		require.NoError(t, <-drained)
+	})
+
+	t.Run("cancels requests after the grace period", func(t *testing.T) {
+		var handled error
+		proxy, err := New(m, WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		require.NoError(t, err)
+		codes := serve(t, proxy)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err = proxy.DrainUpstream(ctx, "accounts")
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+		require.Equal(t, http.StatusServiceUnavailable, <-codes)
+		require.True(t, errors.Is(handled, ErrUpstreamDrained))
+	})
+
+	t.Run("request picking a destination as the drain begins", func(t *testing.T) {
+		var proxied int32
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&proxied, 1)
+		})
+		blue := httptest.NewServer(handler)
+		defer blue.Close()
+		green := httptest.NewServer(handler)
+		defer green.Close()
+		ectx := &hcl.EvalContext{
+			Variables: map[string]cty.Value{
+				"blue":  cty.StringVal(blue.URL),
+				"green": cty.StringVal(green.URL),
+			},
+		}
+		m, err := LoadManifest("testdata/split.hcl", ectx)
+		require.NoError(t, err)
+
+		b := &blockingBalancer{
+			Balancer: RoundRobinBalancer(),
+			picking:  make(chan struct{}),
+			release:  make(chan struct{}),
+		}
+		proxy, err := New(m, WithUpstreamBalancer("accounts", b))
+		require.NoError(t, err)
+
+		codes := make(chan int, 1)
+		go func() {
+			r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+		<-b.picking
+
+		drained := make(chan error, 1)
+		go func() {
+			drained <- proxy.DrainUpstream(context.Background(), "accounts")
+		}()
+		select {
+		case <-drained:
+			t.Fatal("drain returned while a request was picking a destination")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// The request was let through before the drain began, so it's
+		// served, and the drain waits for it.
+		close(b.release)
+		require.NoError(t, <-drained)
+		require.Equal(t, int32(1), atomic.LoadInt32(&proxied))
+		require.Equal(t, http.StatusOK, <-codes)
+
+		// Nothing reaches the backend once the drain has returned.
+		r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		require.Equal(t, int32(1), atomic.LoadInt32(&proxied))
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+		err = proxy.DrainUpstream(context.Background(), "missing")
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+}
+
+// blockingBalancer holds each request in Pick until it's released.
+type blockingBalancer struct {
+	Balancer
+	picking chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBalancer) Pick(destinations []*url.URL, r *http.Request) *url.URL {
+	b.picking <- struct{}{}
+	<-b.release
+	return b.Balancer.Pick(destinations, r)
+}
@@ -0,0 +1,53 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// errorLogger receives errors as a message and structured key-value pairs. It's
+// satisfied by *slog.Logger; see WithErrorLogger.
+type errorLogger interface {
+	Error(msg string, args ...interface{})
+}
+
+// logUpstreamError logs an error from proxying a request to an Upstream. The
+// structured logger from WithErrorLogger is preferred over the one from
+// WithErrorLog.
+func logUpstreamError(cfg mountConfig, identifier string, r *http.Request, msg string, err error, args ...interface{}) {
+	if l := cfg.errorLogger; l != nil {
+		args = append([]interface{}{
+			"upstream", identifier,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"error", err,
+		}, args...)
+		l.Error(msg, args...)
+		return
+	}
+
+	var extra strings.Builder
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&extra, " %v=%q", args[i], fmt.Sprint(args[i+1]))
+	}
+	cfg.errorLog.Printf("%s: upstream %q: %s %s: %v%s", msg, identifier, r.Method, r.URL.Path, err, extra.String())
+}
+
+// logShadowError logs an error replaying a request to a shadow Upstream. The
+// client isn't affected, so it's only logged at debug level, and only if the
+// structured logger from WithErrorLogger has one.
+func logShadowError(cfg mountConfig, identifier string, r *http.Request, err error) {
+	l, ok := cfg.errorLogger.(interface {
+		Debug(msg string, args ...interface{})
+	})
+	if !ok {
+		return
+	}
+	l.Debug("shadow request failed",
+		"upstream", identifier,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"error", err,
+	)
+}
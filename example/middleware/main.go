@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/brettbuddin/pass"
+	"github.com/brettbuddin/pass/passutil"
 )
 
 func main() {
@@ -52,7 +53,7 @@ func run() error {
 	if err != nil {
 		return err
 	}
-	return http.ListenAndServe(":8080", proxy)
+	return passutil.Serve(proxy, ":8080")
 }
 
 func middleware(name string) func(http.Handler) http.Handler {
@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/brettbuddin/pass"
+	"github.com/brettbuddin/pass/passutil"
 	"go.uber.org/zap"
 )
 
@@ -56,5 +57,5 @@ func run() error {
 	if err != nil {
 		return err
 	}
-	return http.ListenAndServe(":8080", proxy)
+	return passutil.Serve(proxy, ":8080")
 }
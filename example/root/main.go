@@ -3,10 +3,10 @@ package main
 import (
 	"flag"
 	"fmt"
-	"net/http"
 	"os"
 
 	"github.com/brettbuddin/pass"
+	"github.com/brettbuddin/pass/passutil"
 )
 
 func main() {
@@ -37,5 +37,5 @@ func run() error {
 	if err != nil {
 		return err
 	}
-	return http.ListenAndServe(":8080", proxy)
+	return passutil.Serve(proxy, ":8080")
 }
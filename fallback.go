@@ -0,0 +1,76 @@
+package pass
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// errFallback is returned by the ResponseModifier of an Upstream with a fallback
+// when the Upstream responds with a server error, so the error handler can hand
+// the request to the fallback.
+var errFallback = fmt.Errorf("upstream server error")
+
+// fallbackKey is the context key for the function that serves a request from
+// an Upstream's fallback.
+type fallbackKey struct{}
+
+// fallbackFunc serves a request from a fallback Upstream. It reports false if
+// the fallback isn't available.
+type fallbackFunc func(http.ResponseWriter) bool
+
+// withFallback is middleware that lets failed requests be served by the
+// fallback Upstream instead. Only requests that can be replayed are eligible.
+func (rt *routing) withFallback(fallback string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !replayable(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The fallback's own failures aren't handed to another fallback.
+			fr := r.WithContext(context.WithValue(r.Context(), fallbackKey{}, fallbackFunc(nil)))
+			serve := fallbackFunc(func(w http.ResponseWriter) bool {
+				served := false
+				rt.upstreams[fallback].track(fr, func(fr *http.Request) {
+					if rewind(fr) != nil {
+						return
+					}
+					dest, err := rt.pickers[fallback](w, fr)
+					if err != nil {
+						return
+					}
+					if info := routeInfoFrom(fr.Context()); info != nil {
+						info.ServedBy = fallback
+						info.UpstreamHost = dest.url
+						info.UpstreamDestination = dest.identifier
+						info.UpstreamURL = dest.targetURL(fr.URL).String()
+					}
+					dest.serve(dest.proxy, w, fr)
+					served = true
+				})
+				return served
+			})
+
+			ctx := context.WithValue(r.Context(), fallbackKey{}, serve)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// fallbackFrom returns the function that serves a request from its Upstream's
+// fallback, or nil if there isn't one.
+func fallbackFrom(ctx context.Context) fallbackFunc {
+	serve, _ := ctx.Value(fallbackKey{}).(fallbackFunc)
+	return serve
+}
+
+// triggerFallback is a ResponseModifier that fails responses with server errors
+// if the request can be served by a fallback.
+func triggerFallback(resp *http.Response) error {
+	if resp.StatusCode >= http.StatusInternalServerError && fallbackFrom(resp.Request.Context()) != nil {
+		return fmt.Errorf("%w: %s", errFallback, resp.Status)
+	}
+	return nil
+}
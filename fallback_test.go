@@ -0,0 +1,116 @@
+package pass
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestUpstreamFallback(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secondary " + r.URL.Path))
+	}))
+	defer secondary.Close()
+	unreachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	unreachable.Close()
+
+	load := func(t *testing.T, primary string) *Manifest {
+		ectx := &hcl.EvalContext{
+			Variables: map[string]cty.Value{
+				"primary":   cty.StringVal(primary),
+				"secondary": cty.StringVal(secondary.URL),
+			},
+		}
+		m, err := LoadManifest("testdata/fallback.hcl", ectx)
+		require.NoError(t, err)
+		return m
+	}
+
+	for name, primary := range map[string]string{
+		"server error": failing.URL,
+		"unreachable":  unreachable.URL,
+	} {
+		primary := primary
+		t.Run(name, func(t *testing.T) {
+			var captured *RouteInfo
+			observe := func(r *http.Request, info *RouteInfo) {
+				captured = info
+			}
+			proxy, err := New(load(t, primary), WithUpstreamFallback("primary", "secondary"), WithObserveFunction(observe))
+			require.NoError(t, err)
+			server := httptest.NewServer(proxy)
+			defer server.Close()
+			client := &http.Client{Timeout: 1 * time.Second}
+
+			resp, err := client.Get(server.URL + "/widgets")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			b, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, "secondary /widgets", string(b))
+			require.Equal(t, "primary", captured.UpstreamIdentifier)
+			require.Equal(t, "secondary", captured.ServedBy)
+			require.Equal(t, secondary.URL, captured.UpstreamHost)
+		})
+	}
+
+	t.Run("not idempotent", func(t *testing.T) {
+		proxy, err := New(load(t, failing.URL), WithUpstreamFallback("primary", "secondary"))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Post(server.URL+"/widgets", "text/plain", strings.NewReader("body"))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	})
+
+	t.Run("fallback disabled", func(t *testing.T) {
+		proxy, err := New(load(t, failing.URL), WithUpstreamFallback("primary", "secondary"))
+		require.NoError(t, err)
+		require.NoError(t, proxy.SetUpstreamEnabled("secondary", false))
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/widgets")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	})
+
+	t.Run("without fallback", func(t *testing.T) {
+		proxy, err := New(load(t, failing.URL))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/widgets")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		_, err := New(load(t, failing.URL), WithUpstreamFallback("primary", "missing"))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+
+		_, err = New(load(t, failing.URL), WithUpstreamFallback("missing", "secondary"))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+
+		_, err = New(load(t, failing.URL), WithUpstreamFallback("primary", "primary"))
+		require.Error(t, err)
+	})
+}
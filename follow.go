@@ -0,0 +1,47 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DefaultMaxUpstreamRedirects is the number of redirects followed for an
+// Upstream set up with WithUpstreamFollowRedirects, unless changed with
+// WithMaxUpstreamRedirects.
+const DefaultMaxUpstreamRedirects = 10
+
+// ErrTooManyRedirects is passed to the ErrorHandler when an Upstream that's
+// followed redirects more times than WithMaxUpstreamRedirects allows.
+var ErrTooManyRedirects = fmt.Errorf("too many upstream redirects")
+
+// followRedirects is an http.RoundTripper that follows the redirects of the
+// base transport's responses, up to max of them, and returns the final
+// response.
+type followRedirects struct {
+	base http.RoundTripper
+	max  int
+}
+
+func (t *followRedirects) RoundTrip(r *http.Request) (*http.Response, error) {
+	client := &http.Client{
+		Transport: t.base,
+		CheckRedirect: func(_ *http.Request, via []*http.Request) error {
+			if len(via) > t.max {
+				return fmt.Errorf("%w: stopped after %d", ErrTooManyRedirects, t.max)
+			}
+			return nil
+		},
+	}
+
+	// The request was received by the Proxy, but clients can't send requests
+	// with a RequestURI.
+	out := *r
+	out.RequestURI = ""
+	resp, err := client.Do(&out)
+	if err != nil {
+		// The last response is returned along with a CheckRedirect error, but
+		// its body is already closed.
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,93 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestFollowRedirects(t *testing.T) {
+	// Redirects /widgets to /widgets?hop=1 and so on, in a loop unless the
+	// final hop is given.
+	var hops int32
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hops, 1)
+		hop, _ := strconv.Atoi(r.URL.Query().Get("hop"))
+		final, err := strconv.Atoi(r.Header.Get("X-Final-Hop"))
+		if err != nil || hop < final {
+			http.Redirect(w, r, "/widgets?hop="+strconv.Itoa(hop+1), http.StatusFound)
+			return
+		}
+		w.Write([]byte("hop " + strconv.Itoa(hop)))
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(destination.URL),
+			"secondary": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	var handled error
+	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	proxy, err := New(m,
+		WithUpstreamFollowRedirects("primary"),
+		WithMaxUpstreamRedirects(3),
+		WithErrorHandler(errorHandler),
+	)
+	require.NoError(t, err)
+
+	serve := func(path, finalHop string) *httptest.ResponseRecorder {
+		atomic.StoreInt32(&hops, 0)
+		handled = nil
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if finalHop != "" {
+			r.Header.Set("X-Final-Hop", finalHop)
+		}
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("within limit", func(t *testing.T) {
+		w := serve("/widgets", "3")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "hop 3", w.Body.String())
+		require.NoError(t, handled)
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		w := serve("/widgets", "")
+		require.Equal(t, http.StatusBadGateway, w.Code)
+		require.True(t, errors.Is(handled, ErrTooManyRedirects))
+		require.Equal(t, int32(4), atomic.LoadInt32(&hops))
+	})
+
+	t.Run("passed through by default", func(t *testing.T) {
+		w := serve("/gadgets", "")
+		require.Equal(t, http.StatusFound, w.Code)
+		require.Equal(t, "/widgets?hop=1", w.Header().Get("Location"))
+		require.Equal(t, int32(1), atomic.LoadInt32(&hops))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := New(m, WithUpstreamFollowRedirects("missing"))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+
+		_, err = New(m, WithMaxUpstreamRedirects(-1))
+		require.Error(t, err)
+	})
+}
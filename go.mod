@@ -9,5 +9,6 @@ require (
 	github.com/stretchr/testify v1.6.1
 	github.com/zclconf/go-cty v1.2.0
 	go.uber.org/zap v1.16.0
+	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
 	honnef.co/go/tools v0.1.2 // indirect
 )
@@ -0,0 +1,122 @@
+package pass
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// gRPC-Web content types, and the gRPC content type they're translated to.
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+	grpcContentType        = "application/grpc"
+)
+
+// grpcWebTrailerFlag marks the frame that carries a gRPC-Web response's
+// trailers.
+const grpcWebTrailerFlag = 0x80
+
+// grpcWebKey is the context key marking a request that was translated from
+// gRPC-Web, so its response is translated back.
+type grpcWebKey struct{}
+
+// translateGRPCWeb is middleware that turns gRPC-Web requests into gRPC
+// requests. Messages are framed the same way in both protocols, so only the
+// headers change. Requests that aren't gRPC-Web are passed through untouched.
+func translateGRPCWeb(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ct := r.Header.Get("Content-Type")
+		if !strings.HasPrefix(ct, grpcWebContentType) || strings.HasPrefix(ct, grpcWebTextContentType) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), grpcWebKey{}, true))
+		r.Header = r.Header.Clone()
+		r.Header.Set("Content-Type", grpcContentType+strings.TrimPrefix(ct, grpcWebContentType))
+		r.Header.Set("Te", "trailers")
+		r.Header.Del("X-Grpc-Web")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// grpcWebResponse is a ResponseModifier that turns the gRPC response to a
+// translated request back into a gRPC-Web response. The trailers are sent as
+// a final frame of the body, since browsers can't read HTTP trailers.
+func grpcWebResponse(resp *http.Response) error {
+	if translated, _ := resp.Request.Context().Value(grpcWebKey{}).(bool); !translated {
+		return nil
+	}
+
+	ct := resp.Header.Get("Content-Type")
+	if strings.HasPrefix(ct, grpcContentType) {
+		resp.Header.Set("Content-Type", grpcWebContentType+strings.TrimPrefix(ct, grpcContentType))
+	}
+
+	// The trailer frame changes the length of the body. The trailers are only
+	// known once the body has been read, and are filled in again then.
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Trailer = nil
+	resp.Body = &grpcWebBody{ReadCloser: resp.Body, resp: resp}
+	return nil
+}
+
+// grpcWebBody appends a response's trailers to its body as a gRPC-Web trailer
+// frame.
+type grpcWebBody struct {
+	io.ReadCloser
+	resp    *http.Response
+	trailer *bytes.Reader
+}
+
+func (b *grpcWebBody) Read(p []byte) (int, error) {
+	if b.trailer != nil {
+		return b.trailer.Read(p)
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if err != io.EOF {
+		return n, err
+	}
+
+	// Take the trailers so they aren't also sent as HTTP trailers.
+	b.trailer = bytes.NewReader(grpcWebTrailerFrame(b.resp.Trailer))
+	b.resp.Trailer = nil
+	if n > 0 {
+		return n, nil
+	}
+	return b.trailer.Read(p)
+}
+
+// grpcWebTrailerFrame encodes trailers as a gRPC-Web trailer frame. It returns
+// nothing if there are no trailers, as in a trailers-only response where they
+// were sent as headers.
+func grpcWebTrailerFrame(trailer http.Header) []byte {
+	if len(trailer) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(trailer))
+	for k := range trailer {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var block bytes.Buffer
+	for _, k := range keys {
+		for _, v := range trailer[k] {
+			block.WriteString(strings.ToLower(k) + ": " + v + "\r\n")
+		}
+	}
+
+	frame := make([]byte, 5, 5+block.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(block.Len()))
+	return append(frame, block.Bytes()...)
+}
@@ -0,0 +1,139 @@
+package pass
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// grpcFrame frames a message the way gRPC and gRPC-Web do.
+func grpcFrame(flag byte, msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+// readGRPCFrame reads a single frame from r.
+func readGRPCFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	header := make([]byte, 5)
+	_, err := io.ReadFull(r, header)
+	require.NoError(t, err)
+	msg := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	_, err = io.ReadFull(r, msg)
+	require.NoError(t, err)
+	return header[0], msg
+}
+
+func TestGRPCWeb(t *testing.T) {
+	// The backend speaks gRPC over HTTP/2, echoing the message it's sent.
+	backend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.Header.Get("Content-Type") != "application/grpc+proto" || r.Header.Get("Te") != "trailers" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		_, msg := readGRPCFrame(t, r.Body)
+
+		w.Header().Set("Content-Type", "application/grpc+proto")
+		if string(msg) == "" {
+			// gRPC servers answer a call that fails before any message is
+			// sent with a trailers-only response: the status is in the
+			// headers and there's no body.
+			w.Header().Set("Grpc-Status", "3")
+			w.Header().Set("Grpc-Message", "name required")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Write(grpcFrame(0, append([]byte("hello, "), msg...)))
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "OK")
+	}))
+	backend.EnableHTTP2 = true
+	backend.StartTLS()
+	defer backend.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(backend.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/grpc_web.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithTransport(backend.Client().Transport))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	t.Run("unary call", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/helloworld.Greeter/SayHello", bytes.NewReader(grpcFrame(0, []byte("world"))))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		req.Header.Set("X-Grpc-Web", "1")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/grpc-web+proto", resp.Header.Get("Content-Type"))
+
+		flag, msg := readGRPCFrame(t, resp.Body)
+		require.Equal(t, byte(0), flag)
+		require.Equal(t, "hello, world", string(msg))
+
+		flag, trailer := readGRPCFrame(t, resp.Body)
+		require.Equal(t, byte(grpcWebTrailerFlag), flag)
+		require.Equal(t, "grpc-message: OK\r\ngrpc-status: 0\r\n", string(trailer))
+
+		rest, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Empty(t, rest)
+		require.Empty(t, resp.Trailer.Get("Grpc-Status"))
+	})
+
+	t.Run("trailers only", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/helloworld.Greeter/SayHello", bytes.NewReader(grpcFrame(0, nil)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/grpc-web+proto")
+		req.Header.Set("X-Grpc-Web", "1")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/grpc-web+proto", resp.Header.Get("Content-Type"))
+		require.Equal(t, "3", resp.Header.Get("Grpc-Status"))
+		require.Equal(t, "name required", resp.Header.Get("Grpc-Message"))
+
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Empty(t, body)
+	})
+
+	t.Run("text not translated", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/helloworld.Greeter/SayHello", bytes.NewReader(nil))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/grpc-web-text")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+	})
+
+	t.Run("invalid protocol", func(t *testing.T) {
+		_, err := LoadManifest("testdata/invalid_protocol.hcl", nil)
+		require.True(t, errors.Is(err, ErrInvalidProtocol))
+	})
+}
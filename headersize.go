@@ -0,0 +1,56 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ErrHeaderTooLarge is passed to the ErrorHandler when a request's headers are
+// larger than the limit given to WithMaxHeaderBytes.
+var ErrHeaderTooLarge = fmt.Errorf("request headers too large")
+
+// AnnotationMaxHeaderBytes is the Upstream annotation that overrides the limit
+// given to WithMaxHeaderBytes for the Upstream's routes. Its value is a number
+// of bytes.
+const AnnotationMaxHeaderBytes = "pass/max-header-bytes"
+
+// maxHeaderBytes returns the limit on the size of headers in requests to the
+// Upstream, or zero if there's no limit.
+func maxHeaderBytes(u Upstream, cfg mountConfig) (int, error) {
+	v, ok := u.Annotations[AnnotationMaxHeaderBytes]
+	if !ok {
+		return cfg.maxHeaderBytes, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("upstream %q: invalid %s annotation: %q", u.Identifier, AnnotationMaxHeaderBytes, v)
+	}
+	return n, nil
+}
+
+// limitHeaderBytes is middleware that rejects requests whose headers, counted
+// as they're written on the wire, are larger than max bytes.
+func limitHeaderBytes(max int, cfg mountConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if headerBytes(r) > max {
+				serveError(w, r, cfg, ErrHeaderTooLarge, http.StatusRequestHeaderFieldsTooLarge)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// headerBytes returns the size of a request's headers, including Host, in the
+// form "Name: value\r\n".
+func headerBytes(r *http.Request) int {
+	n := len("Host: \r\n") + len(r.Host)
+	for k, vs := range r.Header {
+		for _, v := range vs {
+			n += len(k) + len(": \r\n") + len(v)
+		}
+	}
+	return n
+}
@@ -0,0 +1,62 @@
+package pass
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestMaxHeaderBytes(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/max_header_bytes.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithMaxHeaderBytes(1024))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name   string
+		path   string
+		size   int
+		status int
+	}{
+		{"small headers", "/widgets", 100, http.StatusOK},
+		{"oversized headers", "/widgets", 2048, http.StatusRequestHeaderFieldsTooLarge},
+		{"limit lifted by annotation", "/uploads", 2048, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			require.NoError(t, err)
+			req.Header.Set("X-Padding", strings.Repeat("a", tt.size))
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	t.Run("invalid annotation", func(t *testing.T) {
+		m, err := LoadManifest("testdata/max_header_bytes.hcl", ectx)
+		require.NoError(t, err)
+		m.Upstreams[1].Annotations[AnnotationMaxHeaderBytes] = "lots"
+		_, err = New(m)
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,397 @@
+package pass
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrInvalidHealthCheck is returned when an Upstream's health block has a
+// malformed URL or a negative setting.
+var ErrInvalidHealthCheck = fmt.Errorf("invalid health check")
+
+// Defaults for the unset settings of a HealthCheck.
+const (
+	DefaultHealthCheckInterval = 10 * time.Second
+	DefaultHealthCheckTimeout  = 2 * time.Second
+	DefaultHealthyThreshold    = 2
+	DefaultUnhealthyThreshold  = 3
+)
+
+// ErrNoHealthyDestinations is passed to the ErrorHandler when a request is
+// routed to an Upstream that isn't healthy, or none of whose destinations is,
+// unless WithNoHealthyDestinations says otherwise.
+var ErrNoHealthyDestinations = fmt.Errorf("no healthy destinations")
+
+// NoHealthyDestinationsMode is how requests routed to an Upstream that isn't
+// healthy are handled. See WithNoHealthyDestinations.
+type NoHealthyDestinationsMode int
+
+// Modes for handling requests routed to an Upstream that isn't healthy.
+const (
+	NoHealthyReturn503        NoHealthyDestinationsMode = iota // Respond with 503 Service Unavailable
+	NoHealthyServeStale                                        // Proxy to the Upstream's destinations anyway
+	NoHealthyFallbackUpstream                                  // Serve from the fallback given to WithUpstreamFallback, or respond with 503
+)
+
+// serveUnhealthy handles a request routed to an Upstream that isn't healthy
+// according to the mode. It reports false if the request should be proxied
+// to the Upstream as usual.
+func serveUnhealthy(w http.ResponseWriter, r *http.Request, cfg mountConfig) bool {
+	switch cfg.noHealthy {
+	case NoHealthyServeStale:
+		return false
+	case NoHealthyFallbackUpstream:
+		if serve := fallbackFrom(r.Context()); serve != nil && serve(w) {
+			return true
+		}
+	}
+	serveError(w, r, cfg, ErrNoHealthyDestinations, http.StatusServiceUnavailable)
+	return true
+}
+
+// healthReconcileInterval bounds how long RunHealthChecks takes to notice
+// Upstreams added or changed by a reload.
+const healthReconcileInterval = 1 * time.Second
+
+// HealthCheck is how the Proxy actively checks an Upstream's health. The URL
+// can be absolute, independent of the Upstream's destinations, so it can point
+// at a sidecar or a separate port; its result applies to the Upstream as a
+// whole. It can instead be a path, such as "/healthz", which is checked on
+// each of the Upstream's destinations, and whose results apply to each one. A
+// check passes when the URL responds with a 2xx or 3xx status within the
+// timeout.
+type HealthCheck struct {
+	URL                string `hcl:"url"`                          // URL to GET, or a path to GET from each destination
+	IntervalMS         int    `hcl:"interval_ms,optional"`         // Time between checks in milliseconds. Defaults to 10s.
+	TimeoutMS          int    `hcl:"timeout_ms,optional"`          // Limit on each check in milliseconds. Defaults to 2s.
+	HealthyThreshold   int    `hcl:"healthy_threshold,optional"`   // Consecutive passes to become healthy. Defaults to 2.
+	UnhealthyThreshold int    `hcl:"unhealthy_threshold,optional"` // Consecutive failures to become unhealthy. Defaults to 3.
+}
+
+// validate verifies the URL is absolute or a path and the settings aren't
+// negative.
+func (h HealthCheck) validate(identifier string) error {
+	u, err := url.Parse(h.URL)
+	absolute := err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	if !absolute && !h.perDestination() {
+		return fmt.Errorf("%w: %q: url must be an absolute http or https URL, or a path: %q", ErrInvalidHealthCheck, identifier, h.URL)
+	}
+	for _, v := range []int{h.IntervalMS, h.TimeoutMS, h.HealthyThreshold, h.UnhealthyThreshold} {
+		if v < 0 {
+			return fmt.Errorf("%w: %q: negative setting %d", ErrInvalidHealthCheck, identifier, v)
+		}
+	}
+	return nil
+}
+
+// perDestination reports whether the URL is a path to check on each
+// destination.
+func (h HealthCheck) perDestination() bool {
+	u, err := url.Parse(h.URL)
+	return err == nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/")
+}
+
+func (h HealthCheck) interval() time.Duration {
+	if h.IntervalMS == 0 {
+		return DefaultHealthCheckInterval
+	}
+	return time.Duration(h.IntervalMS) * time.Millisecond
+}
+
+func (h HealthCheck) timeout() time.Duration {
+	if h.TimeoutMS == 0 {
+		return DefaultHealthCheckTimeout
+	}
+	return time.Duration(h.TimeoutMS) * time.Millisecond
+}
+
+func (h HealthCheck) healthyThreshold() int {
+	if h.HealthyThreshold == 0 {
+		return DefaultHealthyThreshold
+	}
+	return h.HealthyThreshold
+}
+
+func (h HealthCheck) unhealthyThreshold() int {
+	if h.UnhealthyThreshold == 0 {
+		return DefaultUnhealthyThreshold
+	}
+	return h.UnhealthyThreshold
+}
+
+// destinationHealth records which of an Upstream's destinations have been
+// reported unhealthy, by identifier.
+type destinationHealth struct {
+	count int32 // Accessed atomically; the number unhealthy, so most requests skip the lock
+
+	mu        sync.RWMutex
+	unhealthy map[string]bool
+}
+
+func (h *destinationHealth) set(identifier string, healthy bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if healthy {
+		delete(h.unhealthy, identifier)
+	} else {
+		if h.unhealthy == nil {
+			h.unhealthy = map[string]bool{}
+		}
+		h.unhealthy[identifier] = true
+	}
+	atomic.StoreInt32(&h.count, int32(len(h.unhealthy)))
+}
+
+// healthy reports whether a destination hasn't been reported unhealthy.
+func (h *destinationHealth) healthy(identifier string) bool {
+	if atomic.LoadInt32(&h.count) == 0 {
+		return true
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return !h.unhealthy[identifier]
+}
+
+// anyHealthy reports whether any of the destinations hasn't been reported
+// unhealthy. It's true when there are none, such as for an Upstream that
+// redirects.
+func (h *destinationHealth) anyHealthy(dests []*destinationProxy) bool {
+	if len(dests) == 0 || atomic.LoadInt32(&h.count) == 0 {
+		return true
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, d := range dests {
+		if !h.unhealthy[d.identifier] {
+			return true
+		}
+	}
+	return false
+}
+
+// healthTarget is what the result of a check is recorded against: one of an
+// Upstream's destinations, or the Upstream as a whole.
+type healthTarget struct {
+	state       *upstreamState
+	destination string
+	upstream    bool
+}
+
+func (t healthTarget) set(healthy bool) {
+	if !t.upstream {
+		t.state.health.set(t.destination, healthy)
+		return
+	}
+	var unhealthy int32
+	if !healthy {
+		unhealthy = 1
+	}
+	atomic.StoreInt32(&t.state.unhealthy, unhealthy)
+}
+
+// healthProbe is a check to make of a healthTarget.
+type healthProbe struct {
+	target healthTarget
+	url    string
+	client *http.Client
+}
+
+// healthProbes returns the checks to make of an Upstream with a health block:
+// one of the URL if it's absolute, or one of each destination if it's a path.
+// Transports are taken from the routing, so the checks follow reloads.
+func (rt *routing) healthProbes(u Upstream) []healthProbe {
+	state := rt.upstreams[u.Identifier]
+	if !u.Health.perDestination() {
+		return []healthProbe{{
+			target: healthTarget{state: state, upstream: true},
+			url:    u.Health.URL,
+			client: healthClient(rt.cfg.transport),
+		}}
+	}
+
+	path, err := url.Parse(u.Health.URL)
+	if err != nil {
+		return nil
+	}
+	var probes []healthProbe
+	for _, d := range rt.destinations[u.Identifier] {
+		probes = append(probes, healthProbe{
+			target: healthTarget{state: state, destination: d.identifier},
+			url:    d.targetURL(path).String(),
+			client: healthClient(d.transport),
+		})
+	}
+	return probes
+}
+
+// healthClient returns a client for checks that doesn't follow redirects.
+func healthClient(transport http.RoundTripper) *http.Client {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// healthChecker tracks the checks of one healthTarget. It's only touched by
+// the RunHealthChecks goroutine.
+type healthChecker struct {
+	check     HealthCheck
+	next      time.Time
+	running   bool
+	successes int
+	failures  int
+}
+
+type healthResult struct {
+	target  healthTarget
+	checker *healthChecker
+	passed  bool
+}
+
+// record counts a check's result and updates the target's health once a
+// threshold is reached.
+func (c *healthChecker) record(target healthTarget, passed bool) {
+	if passed {
+		c.successes++
+		c.failures = 0
+		if c.successes >= c.check.healthyThreshold() {
+			target.set(true)
+		}
+		return
+	}
+	c.failures++
+	c.successes = 0
+	if c.failures >= c.check.unhealthyThreshold() {
+		target.set(false)
+	}
+}
+
+// RunHealthChecks checks the health of every Upstream with a health block,
+// recording the results as SetUpstreamHealthy or SetDestinationHealthy would,
+// until ctx is done. Upstreams added, changed or removed by reloads are picked
+// up as it runs.
+func (p *Proxy) RunHealthChecks(ctx context.Context) {
+	checkers := map[healthTarget]*healthChecker{}
+	results := make(chan healthResult)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case res := <-results:
+			res.checker.running = false
+			if checkers[res.target] == res.checker {
+				res.checker.record(res.target, res.passed)
+			}
+		case <-timer.C:
+		}
+
+		rt := p.current()
+		now := time.Now()
+		wait := healthReconcileInterval
+		current := map[healthTarget]bool{}
+		for _, u := range rt.manifest.Upstreams {
+			if u.Health == nil {
+				continue
+			}
+			for _, probe := range rt.healthProbes(u) {
+				current[probe.target] = true
+
+				c, ok := checkers[probe.target]
+				if !ok || c.check != *u.Health {
+					c = &healthChecker{check: *u.Health}
+					checkers[probe.target] = c
+				}
+				if c.running {
+					continue
+				}
+				if !now.Before(c.next) {
+					c.running = true
+					c.next = now.Add(c.check.interval())
+					go func(probe healthProbe, c *healthChecker) {
+						res := healthResult{probe.target, c, probeHealth(ctx, probe.client, probe.url, c.check.timeout())}
+						select {
+						case results <- res:
+						case <-ctx.Done():
+						}
+					}(probe, c)
+					continue
+				}
+				if d := c.next.Sub(now); d < wait {
+					wait = d
+				}
+			}
+		}
+		for target := range checkers {
+			if !current[target] {
+				delete(checkers, target)
+				// Destinations that are no longer checked, such as
+				// those removed by a reload, don't stay unhealthy.
+				if !target.upstream {
+					target.set(true)
+				}
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// probeHealth performs a single check.
+func probeHealth(ctx context.Context, client *http.Client, url string, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
+
+// UpstreamHealthy reports whether an Upstream is currently healthy: enabled,
+// not reported unhealthy by its health checks or SetUpstreamHealthy, and with
+// at least one destination that hasn't been reported unhealthy either.
+func (p *Proxy) UpstreamHealthy(identifier string) (bool, error) {
+	rt := p.current()
+	if _, ok := rt.upstreams[identifier]; !ok {
+		return false, fmt.Errorf("%w: %q", ErrUnknownUpstream, identifier)
+	}
+	return rt.healthy(identifier), nil
+}
+
+// DestinationHealthy reports whether one of an Upstream's destinations hasn't
+// been reported unhealthy by its health checks or SetDestinationHealthy.
+// Destinations are identified as with SetSplit; that of the destination
+// attribute has the empty identifier.
+func (p *Proxy) DestinationHealthy(upstream, destination string) (bool, error) {
+	state, err := p.current().destinationState(upstream, destination)
+	if err != nil {
+		return false, err
+	}
+	return state.health.healthy(destination), nil
+}
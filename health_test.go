@@ -0,0 +1,287 @@
+package pass
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRunHealthChecks(t *testing.T) {
+	var failing int32
+	health := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" || atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer health.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"health": cty.StringVal(health.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/health.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go proxy.RunHealthChecks(ctx)
+
+	healthy := func(id string) bool {
+		ok, err := proxy.UpstreamHealthy(id)
+		require.NoError(t, err)
+		return ok
+	}
+
+	require.True(t, proxy.Ready())
+
+	atomic.StoreInt32(&failing, 1)
+	require.Eventually(t, func() bool { return !healthy("accounts") }, time.Second, 5*time.Millisecond)
+	require.False(t, proxy.Ready())
+	require.True(t, healthy("unchecked"))
+
+	atomic.StoreInt32(&failing, 0)
+	require.Eventually(t, func() bool { return healthy("accounts") }, time.Second, 5*time.Millisecond)
+	require.True(t, proxy.Ready())
+
+	_, err = proxy.UpstreamHealthy("missing")
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+}
+
+func TestRunDestinationHealthChecks(t *testing.T) {
+	var blueFailing, greenFailing int32
+	destination := func(failing *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/healthz" || atomic.LoadInt32(failing) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+	}
+	blue, green := destination(&blueFailing), destination(&greenFailing)
+	defer blue.Close()
+	defer green.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"blue":  cty.StringVal(blue.URL),
+			"green": cty.StringVal(green.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/destination_health.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go proxy.RunHealthChecks(ctx)
+
+	healthy := func(dest string) bool {
+		ok, err := proxy.DestinationHealthy("accounts", dest)
+		require.NoError(t, err)
+		return ok
+	}
+	upstreamHealthy := func() bool {
+		ok, err := proxy.UpstreamHealthy("accounts")
+		require.NoError(t, err)
+		return ok
+	}
+
+	// Each destination is checked on its own, and the Upstream stays healthy
+	// while any of them is.
+	atomic.StoreInt32(&blueFailing, 1)
+	require.Eventually(t, func() bool { return !healthy("blue") }, time.Second, 5*time.Millisecond)
+	require.True(t, healthy("green"))
+	require.True(t, upstreamHealthy())
+	require.True(t, proxy.Ready())
+
+	atomic.StoreInt32(&greenFailing, 1)
+	require.Eventually(t, func() bool { return !healthy("green") }, time.Second, 5*time.Millisecond)
+	require.False(t, upstreamHealthy())
+	require.False(t, proxy.Ready())
+
+	atomic.StoreInt32(&blueFailing, 0)
+	require.Eventually(t, func() bool { return healthy("blue") }, time.Second, 5*time.Millisecond)
+	require.True(t, upstreamHealthy())
+
+	_, err = proxy.DestinationHealthy("accounts", "missing")
+	require.True(t, errors.Is(err, ErrUnknownDestination))
+	_, err = proxy.DestinationHealthy("missing", "blue")
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+}
+
+func TestHealthCheckThresholds(t *testing.T) {
+	state := &upstreamState{}
+	target := healthTarget{state: state, upstream: true}
+	c := &healthChecker{check: HealthCheck{HealthyThreshold: 2, UnhealthyThreshold: 3}}
+
+	c.record(target, false)
+	c.record(target, false)
+	require.True(t, state.healthy())
+	c.record(target, false)
+	require.False(t, state.healthy())
+
+	c.record(target, true)
+	require.False(t, state.healthy())
+	c.record(target, true)
+	require.True(t, state.healthy())
+}
+
+func TestInvalidHealthCheck(t *testing.T) {
+	_, err := LoadManifest("testdata/invalid_health.hcl", nil)
+	require.True(t, errors.Is(err, ErrInvalidHealthCheck))
+
+	m, err := LoadManifest("testdata/basic.hcl", nil)
+	require.NoError(t, err)
+	m.Upstreams[0].Health = &HealthCheck{URL: "http://health.local", IntervalMS: -1}
+	require.True(t, errors.Is(m.Validate(), ErrInvalidHealthCheck))
+}
+
+func TestNoHealthyDestinations(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "primary")
+	}))
+	defer primary.Close()
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "secondary")
+	}))
+	defer secondary.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(primary.URL),
+			"secondary": cty.StringVal(secondary.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/no_healthy.hcl", ectx)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		options  []MountOption
+		status   int
+		servedBy string
+		err      error
+	}{
+		{"default", nil, http.StatusServiceUnavailable, "", ErrNoHealthyDestinations},
+		{"return 503", []MountOption{WithNoHealthyDestinations(NoHealthyReturn503)}, http.StatusServiceUnavailable, "", ErrNoHealthyDestinations},
+		{"serve stale", []MountOption{WithNoHealthyDestinations(NoHealthyServeStale)}, http.StatusOK, "primary", nil},
+		{"fallback upstream", []MountOption{WithNoHealthyDestinations(NoHealthyFallbackUpstream), WithUpstreamFallback("primary", "secondary")}, http.StatusOK, "secondary", nil},
+		{"no fallback upstream", []MountOption{WithNoHealthyDestinations(NoHealthyFallbackUpstream)}, http.StatusServiceUnavailable, "", ErrNoHealthyDestinations},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled error
+			handler := WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				handled = err
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+			proxy, err := New(m, append(tt.options, handler)...)
+			require.NoError(t, err)
+			server := httptest.NewServer(proxy)
+			defer server.Close()
+			client := &http.Client{Timeout: 1 * time.Second}
+
+			resp, err := client.Get(server.URL + "/widgets")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, "primary", resp.Header.Get("X-Served-By"))
+
+			require.NoError(t, proxy.SetUpstreamHealthy("primary", false))
+			resp, err = client.Get(server.URL + "/widgets")
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+			require.Equal(t, tt.servedBy, resp.Header.Get("X-Served-By"))
+			if tt.err != nil {
+				require.True(t, errors.Is(handled, tt.err))
+			} else {
+				require.NoError(t, handled)
+			}
+		})
+	}
+}
+
+func TestNoHealthyDestinationsMixed(t *testing.T) {
+	destination := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Served-By", name)
+		}))
+	}
+	blue, green := destination("blue"), destination("green")
+	defer blue.Close()
+	defer green.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"blue":  cty.StringVal(blue.URL),
+			"green": cty.StringVal(green.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/destination_health.hcl", ectx)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		options []MountOption
+		stale   bool
+	}{
+		{"weighted", nil, false},
+		{"balancer", []MountOption{WithUpstreamBalancer("accounts", RoundRobinBalancer())}, false},
+		{"serve stale", []MountOption{WithNoHealthyDestinations(NoHealthyServeStale)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled error
+			handler := WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				handled = err
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})
+			proxy, err := New(m, append(tt.options, handler)...)
+			require.NoError(t, err)
+
+			serve := func() *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts", nil))
+				return w
+			}
+
+			// While one destination is unhealthy, the other takes every
+			// request and the mode doesn't apply.
+			require.NoError(t, proxy.SetDestinationHealthy("accounts", "blue", false))
+			for i := 0; i < 20; i++ {
+				w := serve()
+				require.Equal(t, http.StatusOK, w.Code)
+				require.Equal(t, "green", w.Header().Get("X-Served-By"))
+			}
+			require.NoError(t, handled)
+
+			// Once both are, it does.
+			require.NoError(t, proxy.SetDestinationHealthy("accounts", "green", false))
+			w := serve()
+			if tt.stale {
+				require.Equal(t, http.StatusOK, w.Code)
+				require.NoError(t, handled)
+			} else {
+				require.Equal(t, http.StatusServiceUnavailable, w.Code)
+				require.True(t, errors.Is(handled, ErrNoHealthyDestinations))
+			}
+
+			require.NoError(t, proxy.SetDestinationHealthy("accounts", "blue", true))
+			w = serve()
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, "blue", w.Header().Get("X-Served-By"))
+		})
+	}
+}
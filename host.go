@@ -0,0 +1,109 @@
+package pass
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// ErrInvalidHost is returned when a host pattern can't be parsed.
+var ErrInvalidHost = fmt.Errorf("invalid host pattern")
+
+// hostPattern matches the Host of requests against a pattern such as
+// "{tenant}.api.example.com". Each parameter matches a single label unless it
+// gives its own regular expression, as in "{tenant:[a-z]+}.api.example.com".
+type hostPattern struct {
+	re *regexp.Regexp
+}
+
+// compileHost parses a host pattern. It returns nil if the pattern is empty.
+func compileHost(pattern string) (*hostPattern, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	var expr strings.Builder
+	expr.WriteString("(?i)^")
+	rest := pattern
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			expr.WriteString(regexp.QuoteMeta(rest))
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: %q: unclosed parameter", ErrInvalidHost, pattern)
+		}
+		end += start
+
+		name, param := rest[start+1:end], `[^.]+`
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name, param = name[:i], name[i+1:]
+		}
+		if name == "" || param == "" {
+			return nil, fmt.Errorf("%w: %q: empty parameter", ErrInvalidHost, pattern)
+		}
+		expr.WriteString(regexp.QuoteMeta(rest[:start]))
+		expr.WriteString("(?P<" + name + ">" + param + ")")
+		rest = rest[end+1:]
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %s", ErrInvalidHost, pattern, err)
+	}
+	return &hostPattern{re: re}, nil
+}
+
+// match reports whether the host, which may include a port, matches the
+// pattern, and returns the values of its parameters.
+func (h *hostPattern) match(host string) (map[string]string, bool) {
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	m := h.re.FindStringSubmatch(host)
+	if m == nil {
+		return nil, false
+	}
+	var params map[string]string
+	for i, name := range h.re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if params == nil {
+			params = map[string]string{}
+		}
+		params[name] = m[i]
+	}
+	return params, true
+}
+
+// hostParamsKey is the context key for the parameters captured from a
+// request's Host.
+type hostParamsKey struct{}
+
+// withHostParams is middleware that stores the parameters captured from the
+// request's Host in its context.
+func withHostParams(h *hostPattern) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			params, _ := h.match(r.Host)
+			ctx := context.WithValue(r.Context(), hostParamsKey{}, params)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// HostParams returns the parameters captured from the request's Host by the
+// host pattern of the route that matched it, or nil if it has none. It can be
+// used by middleware given to WithUpstreamMiddleware; the parameters are also
+// in RouteInfo.HostParams.
+func HostParams(r *http.Request) map[string]string {
+	params, _ := r.Context().Value(hostParamsKey{}).(map[string]string)
+	return params
+}
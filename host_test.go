@@ -0,0 +1,82 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestHostRouting(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/host.hcl", ectx)
+	require.NoError(t, err)
+
+	var (
+		observed   *RouteInfo
+		middleware map[string]string
+	)
+	observe := func(r *http.Request, info *RouteInfo) {
+		observed = info
+	}
+	mw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			middleware = HostParams(r)
+			next.ServeHTTP(w, r)
+		})
+	}
+	proxy, err := New(m, WithObserveFunction(observe), WithUpstreamMiddleware("tenants", mw))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		host     string
+		path     string
+		status   int
+		upstream string
+		params   map[string]string
+	}{
+		{"tenant", "acme.api.example.com", "/widgets", http.StatusOK, "tenants", map[string]string{"tenant": "acme"}},
+		{"tenant with port", "Acme.API.example.com:8080", "/widgets", http.StatusOK, "tenants", map[string]string{"tenant": "Acme"}},
+		{"literal host", "admin.example.com", "/widgets", http.StatusOK, "admin", nil},
+		{"route host", "acme.eu.api.example.com", "/regions", http.StatusOK, "tenants", map[string]string{"tenant": "acme", "region": "eu"}},
+		{"route host mismatch", "acme.ap.api.example.com", "/regions", http.StatusNotFound, "", nil},
+		{"nested subdomain", "a.b.api.example.com", "/widgets", http.StatusNotFound, "", nil},
+		{"unknown host", "example.com", "/widgets", http.StatusNotFound, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observed, middleware = nil, nil
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				require.True(t, observed.Unmatched)
+				return
+			}
+			require.Equal(t, tt.upstream, observed.UpstreamIdentifier)
+			require.Equal(t, tt.params, observed.HostParams)
+			if tt.upstream == "tenants" {
+				require.Equal(t, tt.params, middleware)
+			}
+		})
+	}
+}
+
+func TestInvalidHost(t *testing.T) {
+	_, err := LoadManifest("testdata/invalid_host.hcl", nil)
+	require.True(t, errors.Is(err, ErrInvalidHost))
+}
@@ -0,0 +1,127 @@
+package pass
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// localsSchema picks the locals blocks out of a manifest's body.
+var localsSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{Type: "locals"}},
+}
+
+// parseManifestFile parses a manifest file, as HCL unless it's JSON, and
+// evaluates its locals blocks. It returns the rest of the file's body along
+// with an EvalContext where the locals can be referenced as local.NAME.
+func parseManifestFile(filename string, ectx *hcl.EvalContext) (hcl.Body, *hcl.EvalContext, hcl.Diagnostics) {
+	parser := hclparse.NewParser()
+	var (
+		file  *hcl.File
+		diags hcl.Diagnostics
+	)
+	if filepath.Ext(filename) == ".json" {
+		file, diags = parser.ParseJSONFile(filename)
+	} else {
+		file, diags = parser.ParseHCLFile(filename)
+	}
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+
+	content, body, diags := file.Body.PartialContent(localsSchema)
+	if diags.HasErrors() {
+		return nil, nil, diags
+	}
+	if len(content.Blocks) == 0 {
+		return body, ectx, nil
+	}
+
+	pending := hcl.Attributes{}
+	for _, block := range content.Blocks {
+		attrs, diags := block.Body.JustAttributes()
+		if diags.HasErrors() {
+			return nil, nil, diags
+		}
+		for name, attr := range attrs {
+			if _, ok := pending[name]; ok {
+				return nil, nil, hcl.Diagnostics{{
+					Severity: hcl.DiagError,
+					Summary:  "Duplicate local value",
+					Detail:   fmt.Sprintf("A local value named %q was already defined.", name),
+					Subject:  attr.NameRange.Ptr(),
+				}}
+			}
+			pending[name] = attr
+		}
+	}
+
+	if ectx == nil {
+		ectx = &hcl.EvalContext{}
+	}
+	child := ectx.NewChild()
+	locals := map[string]cty.Value{}
+
+	// Locals can refer to each other, so each is evaluated once the locals it
+	// refers to have been.
+	for len(pending) > 0 {
+		progress := false
+		for _, name := range sortedAttributeNames(pending) {
+			attr := pending[name]
+			if !localsReady(attr.Expr, locals) {
+				continue
+			}
+			child.Variables = map[string]cty.Value{"local": cty.ObjectVal(locals)}
+			v, diags := attr.Expr.Value(child)
+			if diags.HasErrors() {
+				return nil, nil, diags
+			}
+			locals[name] = v
+			delete(pending, name)
+			progress = true
+		}
+		if !progress {
+			names := sortedAttributeNames(pending)
+			return nil, nil, hcl.Diagnostics{{
+				Severity: hcl.DiagError,
+				Summary:  "Unresolvable local values",
+				Detail:   fmt.Sprintf("The local values %s refer to each other or to local values that don't exist.", strings.Join(names, ", ")),
+				Subject:  pending[names[0]].Range.Ptr(),
+			}}
+		}
+	}
+	child.Variables = map[string]cty.Value{"local": cty.ObjectVal(locals)}
+	return body, child, nil
+}
+
+// localsReady reports whether every local value an expression refers to has
+// been evaluated.
+func localsReady(expr hcl.Expression, locals map[string]cty.Value) bool {
+	for _, traversal := range expr.Variables() {
+		if traversal.RootName() != "local" || len(traversal) < 2 {
+			continue
+		}
+		attr, ok := traversal[1].(hcl.TraverseAttr)
+		if !ok {
+			continue
+		}
+		if _, ok := locals[attr.Name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedAttributeNames(attrs hcl.Attributes) []string {
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,62 @@
+package pass
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// rewriteRedirects returns a ResponseModifier that rewrites Location headers
+// referring to the destination so that they point back through the Proxy. The
+// destination's base path is replaced with the prefix the route is mounted
+// under. Locations on other hosts, and relative references that don't start
+// with a slash, are left alone since the client already resolves them
+// correctly.
+func rewriteRedirects(dest *url.URL, prefix string) ResponseModifier {
+	return func(resp *http.Response) error {
+		location := resp.Header.Get("Location")
+		if location == "" {
+			return nil
+		}
+		loc, err := url.Parse(location)
+		if err != nil {
+			return nil
+		}
+
+		switch {
+		case loc.Host != "":
+			if !strings.EqualFold(loc.Host, dest.Host) {
+				return nil
+			}
+		case !strings.HasPrefix(loc.Path, "/"):
+			return nil
+		}
+
+		p := loc.Path
+		if base := strings.TrimSuffix(dest.Path, "/"); base != "" {
+			if p != base && !strings.HasPrefix(p, base+"/") {
+				return nil
+			}
+			p = strings.TrimPrefix(p, base)
+		}
+
+		rewritten := &url.URL{
+			Path:     joinPath(prefix, p),
+			RawQuery: loc.RawQuery,
+			Fragment: loc.Fragment,
+		}
+		resp.Header.Set("Location", rewritten.String())
+		return nil
+	}
+}
+
+// joinPath joins a prefix and path like path.Join, but keeps a trailing slash
+// on the path.
+func joinPath(prefix, p string) string {
+	joined := path.Join("/", prefix, p)
+	if strings.HasSuffix(p, "/") && joined != "/" {
+		joined += "/"
+	}
+	return joined
+}
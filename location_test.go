@@ -0,0 +1,64 @@
+package pass
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRewriteRedirects(t *testing.T) {
+	var destination *httptest.Server
+	destination = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("redirect") {
+		case "absolute":
+			w.Header().Set("Location", destination.URL+"/accounts/1?tab=profile")
+		case "relative":
+			w.Header().Set("Location", "/accounts/2?tab=billing")
+		case "foreign":
+			w.Header().Set("Location", "https://login.example.com/authorize?next=%2Faccounts")
+		}
+		w.WriteHeader(http.StatusMovedPermanently)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithRoot("/api"), WithRewriteRedirects())
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{
+		Timeout: 1 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	tests := []struct {
+		redirect string
+		location string
+	}{
+		{"absolute", "/api/accounts/1?tab=profile"},
+		{"relative", "/api/accounts/2?tab=billing"},
+		{"foreign", "https://login.example.com/authorize?next=%2Faccounts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.redirect, func(t *testing.T) {
+			resp, err := client.Get(server.URL + "/api/accounts?redirect=" + tt.redirect)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+			require.Equal(t, tt.location, resp.Header.Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaintenanceContentType is the Content-Type of maintenance responses
+// if one isn't specified with WithMaintenanceContentType.
+const DefaultMaintenanceContentType = "text/plain; charset=utf-8"
+
+// maintenance holds the response to serve while in maintenance mode. It's
+// safe to change while requests are being served.
+type maintenance struct {
+	v atomic.Value // *maintenanceResponse; nil when not in maintenance
+}
+
+type maintenanceResponse struct {
+	body       []byte
+	retryAfter time.Duration
+}
+
+func (m *maintenance) set(body []byte, retryAfter time.Duration) {
+	var resp *maintenanceResponse
+	if body != nil {
+		resp = &maintenanceResponse{body: body, retryAfter: retryAfter}
+	}
+	m.v.Store(resp)
+}
+
+func (m *maintenance) response() *maintenanceResponse {
+	resp, _ := m.v.Load().(*maintenanceResponse)
+	return resp
+}
+
+// serveMaintenance is middleware that answers requests with the maintenance
+// response, if the Upstream or the whole Proxy is in maintenance, instead of
+// proxying them. The Upstream's maintenance response takes precedence.
+func serveMaintenance(global, upstream *maintenance, contentType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			resp := upstream.response()
+			if resp == nil {
+				resp = global.response()
+			}
+			if resp == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", contentType)
+			if resp.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(int(resp.retryAfter.Round(time.Second)/time.Second)))
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write(resp.body)
+		})
+	}
+}
+
+// SetMaintenance puts an Upstream, or the whole Proxy if the identifier is
+// empty, into maintenance mode. Requests routed to it are answered with 503
+// Service Unavailable and the body rather than being proxied, with a
+// Retry-After header if retryAfter is positive. A nil body takes it out of
+// maintenance mode. Maintenance mode survives reloads.
+func (p *Proxy) SetMaintenance(identifier string, body []byte, retryAfter time.Duration) error {
+	rt := p.current()
+	if identifier == "" {
+		rt.maintenance.set(body, retryAfter)
+		return nil
+	}
+
+	state, ok := rt.upstreams[identifier]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownUpstream, identifier)
+	}
+	state.maintenance.set(body, retryAfter)
+	return nil
+}
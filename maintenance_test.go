@@ -0,0 +1,93 @@
+package pass
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestMaintenance(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "upstream")
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"stable": cty.StringVal(destination.URL),
+			"beta":   cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/match_headers.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithMaintenanceContentType("application/json"))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := client.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(b)
+	}
+
+	t.Run("upstream", func(t *testing.T) {
+		require.NoError(t, proxy.SetMaintenance("stable", []byte(`{"status":"maintenance"}`), 2*time.Minute))
+
+		resp, body := get("/widgets")
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		require.Equal(t, "120", resp.Header.Get("Retry-After"))
+		require.Equal(t, `{"status":"maintenance"}`, body)
+
+		// Other upstreams are unaffected.
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/previews", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Beta", "true")
+		resp, err = client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		require.NoError(t, proxy.SetMaintenance("stable", nil, 0))
+		resp, body = get("/widgets")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "upstream", body)
+	})
+
+	t.Run("whole proxy", func(t *testing.T) {
+		require.NoError(t, proxy.SetMaintenance("", []byte("back soon"), 0))
+
+		resp, body := get("/widgets")
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Retry-After"))
+		require.Equal(t, "back soon", body)
+
+		// Maintenance mode survives reloads.
+		require.NoError(t, proxy.Reload(m))
+		resp, _ = get("/widgets")
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		require.NoError(t, proxy.SetMaintenance("", nil, 0))
+		resp, _ = get("/widgets")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		err := proxy.SetMaintenance("doesnt-exist", []byte("back soon"), 0)
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+}
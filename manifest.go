@@ -1,16 +1,79 @@
 package pass
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/hcl/v2"
-	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2/gohcl"
 )
 
 // ErrDuplicateUpstreamIdentifier is returned when there more than one Upstream
 // in a Manifest with the same identifier.
 var ErrDuplicateUpstreamIdentifier = fmt.Errorf("duplicate upstream identifier")
 
+// ErrInconsistentManifest is returned when the files of a manifest directory
+// declare different values for the same manifest-level attribute.
+var ErrInconsistentManifest = fmt.Errorf("inconsistent manifest")
+
+// ErrInvalidTimeout is returned when an Upstream or Route has a negative
+// timeout or slow request threshold.
+var ErrInvalidTimeout = fmt.Errorf("invalid timeout")
+
+// ErrInvalidRoute is returned by Proxy.ReplaceUpstream, and reported as a
+// warning by Manifest.Validate, when a Route has no methods and so receives no
+// traffic.
+var ErrInvalidRoute = fmt.Errorf("invalid route")
+
+// ErrInvalidRouteMatch is returned when a Route's match attribute isn't one of
+// the supported values.
+var ErrInvalidRouteMatch = fmt.Errorf("invalid route match")
+
+// ErrMissingDestination is returned when an Upstream specifies neither a
+// destination attribute, any destination blocks nor a redirect block.
+var ErrMissingDestination = fmt.Errorf("missing destination")
+
+// ErrConflictingDestination is returned when an Upstream specifies both a
+// destination attribute and destination blocks.
+var ErrConflictingDestination = fmt.Errorf("destination attribute conflicts with destination blocks")
+
+// ErrConflictingRedirect is returned when an Upstream specifies both a redirect
+// block and a destination.
+var ErrConflictingRedirect = fmt.Errorf("redirect conflicts with destination")
+
+// ErrInvalidRedirect is returned when an Upstream's redirect block has no target
+// or a status code that isn't a redirection.
+var ErrInvalidRedirect = fmt.Errorf("invalid redirect")
+
+// ErrDuplicateDestinationIdentifier is returned when there is more than one
+// Destination in an Upstream with the same identifier.
+var ErrDuplicateDestinationIdentifier = fmt.Errorf("duplicate destination identifier")
+
+// ErrInvalidWeights is returned when destination weights are negative or don't
+// add up to a positive total.
+var ErrInvalidWeights = fmt.Errorf("invalid destination weights")
+
+// ErrInvalidProtocol is returned when an Upstream's protocol attribute isn't one
+// of the supported values.
+var ErrInvalidProtocol = fmt.Errorf("invalid protocol")
+
+// ErrInvalidFlushInterval is returned when an Upstream's flush_interval isn't a
+// valid duration.
+var ErrInvalidFlushInterval = fmt.Errorf("invalid flush interval")
+
+// ErrUnknownAttribute is reported by Validate as a warning for each attribute
+// or block that LoadManifestLenient ignored.
+var ErrUnknownAttribute = fmt.Errorf("unknown attribute")
+
+// ErrUnroutedUpstream is reported as a warning by Manifest.Validate when an
+// Upstream has no routes.
+var ErrUnroutedUpstream = fmt.Errorf("upstream has no routes")
+
 // Manifest is a list of upstream services in which to proxy.
 type Manifest struct {
 	Annotations map[string]string `hcl:"annotations,optional"` // Annotations to be used by other libraries
@@ -18,33 +81,258 @@ type Manifest struct {
 	PrefixPath  string            `hcl:"prefix_path,optional"` // Prefix to add to all upstream routes. Stripped when proxying.
 
 	upstreamIndex map[string]*Upstream // Index to lookup Upstream by identifier
+	unknown       []error              // Attributes and blocks ignored by LoadManifestLenient
 }
 
 // Upstream is an upstream service in which to proxy.
 type Upstream struct {
-	Identifier      string            `hcl:",label"`                     // Human identifier for the upstream
-	Annotations     map[string]string `hcl:"annotations,optional"`       // Annotations to be used by other libraries
-	Destination     string            `hcl:"destination"`                // Scheme and Hostname of the upstream component
-	Routes          []Route           `hcl:"route,block"`                // Routes to accept
-	FlushIntervalMS int               `hcl:"flush_interval_ms,optional"` // httputil.ReverseProxy.FlushInterval value in milliseconds
-	Owner           string            `hcl:"owner,optional"`             // Team that owns the upstream component
-	PrefixPath      string            `hcl:"prefix_path,optional"`       // Prefix to add to all routes. Stripped when proxying.
+	Identifier              string            `hcl:",label"`                              // Human identifier for the upstream
+	Annotations             map[string]string `hcl:"annotations,optional"`                // Annotations to be used by other libraries
+	Destination             string            `hcl:"destination,optional"`                // Scheme and Hostname of the upstream component, or "unix://" and a socket path
+	Destinations            []Destination     `hcl:"destination,block"`                   // Weighted destinations to split traffic between
+	Routes                  []Route           `hcl:"route,block"`                         // Routes to accept
+	FlushIntervalString     string            `hcl:"flush_interval,optional"`             // httputil.ReverseProxy.FlushInterval value as a duration; "-1" flushes immediately
+	FlushIntervalMS         int               `hcl:"flush_interval_ms,optional"`          // httputil.ReverseProxy.FlushInterval value in milliseconds
+	TimeoutMS               int               `hcl:"timeout_ms,optional"`                 // Deadline for requests in milliseconds. Zero means no deadline.
+	DialTimeoutMS           int               `hcl:"dial_timeout_ms,optional"`            // Limit on connecting to a destination in milliseconds
+	TLSHandshakeTimeoutMS   int               `hcl:"tls_handshake_timeout_ms,optional"`   // Limit on the TLS handshake with a destination in milliseconds
+	ResponseHeaderTimeoutMS int               `hcl:"response_header_timeout_ms,optional"` // Limit on waiting for a destination's response headers in milliseconds
+	SlowThresholdMS         int               `hcl:"slow_threshold_ms,optional"`          // Requests taking longer are logged to the error log. Zero disables logging.
+	Owner                   string            `hcl:"owner,optional"`                      // Team that owns the upstream component
+	PrefixPath              string            `hcl:"prefix_path,optional"`                // Prefix to add to all routes. Stripped when proxying unless strip_prefix is false.
+	StripPrefix             *bool             `hcl:"strip_prefix,optional"`               // Whether the root and prefix_path are stripped when proxying. Defaults to true.
+	StripRequestHeaders     []string          `hcl:"strip_request_headers,optional"`      // Headers to remove from requests before proxying
+	Protocol                string            `hcl:"protocol,optional"`                   // Protocol to translate requests from: "" (none) or "grpc-web"
+	Host                    string            `hcl:"host,optional"`                       // Pattern the request's Host must match, such as "{tenant}.api.example.com"
+	Redirect                *Redirect         `hcl:"redirect,block"`                      // Redirect requests instead of proxying them
+	Auth                    *UpstreamAuth     `hcl:"auth,block"`                          // Credentials to send with requests to the destination
+	ResponseHeaders         map[string]string `hcl:"response_headers,optional"`           // Headers to set on responses. Overrides WithResponseHeaders.
+	Health                  *HealthCheck      `hcl:"health,block"`                        // Active health check used by Proxy.RunHealthChecks
+}
+
+// StripsPrefix reports whether the Proxy's root and the Upstream's prefix_path
+// are stripped from the path of requests proxied to the Upstream.
+func (u Upstream) StripsPrefix() bool {
+	return u.StripPrefix == nil || *u.StripPrefix
+}
+
+// Redirect answers an Upstream's requests with a redirect rather than proxying
+// them to a destination.
+type Redirect struct {
+	To     string `hcl:"to"`              // URL to redirect to. Path parameters, such as {id}, are replaced with their values.
+	Status int    `hcl:"status,optional"` // Redirect status code. Defaults to 301 Moved Permanently.
+}
+
+// Values for Upstream.Protocol.
+const (
+	UpstreamProtocolGRPCWeb = "grpc-web" // Translate gRPC-Web requests to gRPC
+)
+
+// FlushInterval returns the httputil.ReverseProxy.FlushInterval for the
+// Upstream. The flush_interval duration is preferred over flush_interval_ms
+// when both are set.
+func (u Upstream) FlushInterval() time.Duration {
+	if u.FlushIntervalString != "" {
+		d, _ := parseFlushInterval(u.FlushIntervalString)
+		return d
+	}
+	return time.Duration(u.FlushIntervalMS) * time.Millisecond
+}
+
+// parseFlushInterval parses a flush_interval value. In addition to Go
+// durations, it accepts a unitless "-1" to mean flushing immediately.
+func parseFlushInterval(s string) (time.Duration, error) {
+	if s == "-1" {
+		return -1, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// Destination is one of several destinations for an Upstream. Traffic is split
+// between the destinations in proportion to their weights.
+type Destination struct {
+	Identifier string `hcl:",label"` // Human identifier for the destination
+	URL        string `hcl:"url"`    // Scheme and Hostname of the destination
+	Weight     int    `hcl:"weight"` // Relative share of traffic sent to the destination
 }
 
 // Route is an individual HTTP method/path combination in which to proxy.
 type Route struct {
-	Methods []string `hcl:"methods"` // HTTP Methods
-	Path    string   `hcl:"path"`    // HTTP Path
+	Methods          []string          `hcl:"methods"`                     // HTTP Methods
+	Path             string            `hcl:"path"`                        // HTTP Path
+	Host             string            `hcl:"host,optional"`               // Pattern the request's Host must match. Overrides the Upstream's.
+	Match            string            `hcl:"match,optional"`              // How the path is matched: "exact" (default) or "prefix"
+	MatchHeaders     map[string]string `hcl:"match_headers,optional"`      // Headers that must be present with the given values
+	MatchContentType string            `hcl:"match_content_type,optional"` // Prefix the request's Content-Type must begin with
+	MatchQuery       map[string]string `hcl:"match_query,optional"`        // Query parameters that must be present with the given values
+	RequireHeaders   []string          `hcl:"require_headers,optional"`    // Headers that must be present and non-empty. Requests without them are rejected rather than routed elsewhere.
+	Deprecated       bool              `hcl:"deprecated,optional"`         // Whether responses carry the Deprecation header
+	Sunset           string            `hcl:"sunset,optional"`             // Date or RFC 3339 timestamp sent in the Sunset header, when the route will stop working
+	TimeoutMS        int               `hcl:"timeout_ms,optional"`         // Deadline for requests in milliseconds. Zero means inherit from the Upstream.
+	FlushIntervalMS  int               `hcl:"flush_interval_ms,optional"`  // httputil.ReverseProxy.FlushInterval value in milliseconds; -1 flushes immediately. Zero means inherit from the Upstream.
+}
+
+// HostPattern returns the pattern the Host of requests to the Route must match,
+// given the Upstream it belongs to. It's empty if any Host matches.
+func (r Route) HostPattern(u Upstream) string {
+	if r.Host != "" {
+		return r.Host
+	}
+	return u.Host
+}
+
+// FlushInterval returns the httputil.ReverseProxy.FlushInterval for requests to
+// the Route, given the Upstream it belongs to.
+func (r Route) FlushInterval(u Upstream) time.Duration {
+	switch {
+	case r.FlushIntervalMS < 0:
+		return -1
+	case r.FlushIntervalMS > 0:
+		return time.Duration(r.FlushIntervalMS) * time.Millisecond
+	}
+	return u.FlushInterval()
+}
+
+// Timeout returns the deadline for requests to the Route, given the Upstream it
+// belongs to. Zero means there's no deadline.
+func (r Route) Timeout(u Upstream) time.Duration {
+	if r.TimeoutMS > 0 {
+		return time.Duration(r.TimeoutMS) * time.Millisecond
+	}
+	return time.Duration(u.TimeoutMS) * time.Millisecond
 }
 
-// LoadManifest parses an HCL file containing the manifest.
+// Values for Route.Match.
+const (
+	RouteMatchExact  = "exact"  // Match the path exactly
+	RouteMatchPrefix = "prefix" // Match the path and everything beneath it
+)
+
+// LoadManifest parses an HCL file containing the manifest. It's strict: any
+// attribute or block it doesn't recognize is an error that gives its line and
+// column, so typos and attributes meant for newer versions are caught. See
+// LoadManifestLenient for the alternative. Values defined in locals blocks can
+// be referenced elsewhere in the file as local.NAME.
 func LoadManifest(filename string, ectx *hcl.EvalContext) (*Manifest, error) {
+	body, ectx, diags := parseManifestFile(filename, ectx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	var m Manifest
+	if diags := gohcl.DecodeBody(body, ectx, &m); diags.HasErrors() {
+		return nil, diags
+	}
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// LoadManifestLenient parses an HCL file containing the manifest like
+// LoadManifest, but ignores attributes and blocks it doesn't recognize. This
+// lets manifests written for newer versions be loaded by older ones, at the
+// cost of silently dropping whatever the newer attributes configure, and of
+// letting typos through. Each one ignored is reported by Validate as a warning
+// wrapping ErrUnknownAttribute.
+func LoadManifestLenient(filename string, ectx *hcl.EvalContext) (*Manifest, error) {
+	body, ectx, diags := parseManifestFile(filename, ectx)
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
 	var m Manifest
-	err := hclsimple.DecodeFile(filename, ectx, &m)
+	var errs hcl.Diagnostics
+	for _, d := range gohcl.DecodeBody(body, ectx, &m) {
+		if d.Summary == "Unsupported argument" || d.Summary == "Unsupported block type" {
+			m.unknown = append(m.unknown, fmt.Errorf("%w: %s: %s", ErrUnknownAttribute, d.Subject, d.Detail))
+			continue
+		}
+		errs = append(errs, d)
+	}
+	if errs.HasErrors() {
+		return nil, errs
+	}
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// LoadManifestDir parses every HCL file in a directory and merges them into a
+// single manifest. Upstream identifiers must be unique across all of the files.
+// Manifest-level attributes may be declared in any of the files, but files that
+// declare the same attribute must agree on its value. Locals are only visible
+// within the file that defines them.
+func LoadManifestDir(dir string, ectx *hcl.EvalContext) (*Manifest, error) {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
 
+	// Track which file declared what so errors can point at both files.
+	var (
+		merged          Manifest
+		found           bool
+		prefixFile      string
+		annotationFiles = map[string]string{}
+		upstreamFiles   = map[string]string{}
+	)
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".hcl" {
+			continue
+		}
+		found = true
+		filename := filepath.Join(dir, e.Name())
+
+		body, fctx, diags := parseManifestFile(filename, ectx)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		var m Manifest
+		if diags := gohcl.DecodeBody(body, fctx, &m); diags.HasErrors() {
+			return nil, diags
+		}
+
+		if m.PrefixPath != "" {
+			if merged.PrefixPath != "" && merged.PrefixPath != m.PrefixPath {
+				return nil, fmt.Errorf("%w: prefix_path %q in %s and %q in %s", ErrInconsistentManifest, merged.PrefixPath, prefixFile, m.PrefixPath, filename)
+			}
+			merged.PrefixPath = m.PrefixPath
+			prefixFile = filename
+		}
+
+		for k, v := range m.Annotations {
+			if merged.Annotations == nil {
+				merged.Annotations = map[string]string{}
+			}
+			if prev, ok := merged.Annotations[k]; ok && prev != v {
+				return nil, fmt.Errorf("%w: annotation %q is %q in %s and %q in %s", ErrInconsistentManifest, k, prev, annotationFiles[k], v, filename)
+			}
+			merged.Annotations[k] = v
+			annotationFiles[k] = filename
+		}
+
+		for _, u := range m.Upstreams {
+			if other, ok := upstreamFiles[u.Identifier]; ok {
+				return nil, fmt.Errorf("%w: %q in %s and %s", ErrDuplicateUpstreamIdentifier, u.Identifier, other, filename)
+			}
+			upstreamFiles[u.Identifier] = filename
+			merged.Upstreams = append(merged.Upstreams, u)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no .hcl files in %s", dir)
+	}
+
+	if err := merged.init(); err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// init establishes defaults for a decoded Manifest, indexes its Upstreams and
+// validates them.
+func (m *Manifest) init() error {
 	// Establish defaults for annotation maps so the caller can simply ask about
 	// keys without caring about nil values.
 	if m.Annotations == nil {
@@ -54,20 +342,355 @@ func LoadManifest(filename string, ectx *hcl.EvalContext) (*Manifest, error) {
 		if m.Upstreams[i].Annotations == nil {
 			m.Upstreams[i].Annotations = map[string]string{}
 		}
+		m.Upstreams[i].normalizeRoutes()
+	}
+
+	if errs := m.problems(); len(errs) > 0 {
+		return errs[0]
+	}
+
+	m.index()
+	return nil
+}
+
+// index rebuilds the index of Upstreams by identifier. It must be called
+// whenever Upstreams is changed, since the index points into it.
+func (m *Manifest) index() {
+	m.upstreamIndex = map[string]*Upstream{}
+	for i := range m.Upstreams {
+		m.upstreamIndex[m.Upstreams[i].Identifier] = &m.Upstreams[i]
+	}
+}
+
+// AddUpstream adds an Upstream to the Manifest, so a Manifest can be built in
+// code rather than loaded from HCL. The Upstream is checked as LoadManifest
+// would check it; if its identifier is already taken, or it has any other
+// problem, an error is returned and the Manifest is left as it is.
+func (m *Manifest) AddUpstream(u Upstream) error {
+	for _, existing := range m.Upstreams {
+		if existing.Identifier == u.Identifier {
+			return fmt.Errorf("%w: %q", ErrDuplicateUpstreamIdentifier, u.Identifier)
+		}
+	}
+	u.normalizeRoutes()
+	if errs := upstreamProblems(u); len(errs) > 0 {
+		return errs[0]
+	}
+
+	if m.Annotations == nil {
+		m.Annotations = map[string]string{}
+	}
+	if u.Annotations == nil {
+		u.Annotations = map[string]string{}
+	}
+	m.Upstreams = append(m.Upstreams, u)
+	m.index()
+	return nil
+}
+
+// normalizeRoutes upper-cases the methods of the Upstream's routes, so that
+// "get" routes GET requests, and adds a leading slash to paths without one.
+// The routes are copied rather than changed in place, since they may be shared
+// with the caller.
+func (u *Upstream) normalizeRoutes() {
+	routes := make([]Route, len(u.Routes))
+	for i, r := range u.Routes {
+		r.Methods = upperMethods(r.Methods)
+		if !strings.HasPrefix(r.Path, "/") {
+			r.Path = "/" + r.Path
+		}
+		routes[i] = r
+	}
+	if u.Routes != nil {
+		u.Routes = routes
 	}
+}
+
+// problems returns every reason the Manifest can't be used, in the order the
+// Upstreams are declared.
+func (m *Manifest) problems() []error {
+	var errs []error
 
 	// Validate uniqueness of upstream identifiers
-	upstreams := map[string]*Upstream{}
+	seen := map[string]bool{}
+	for _, u := range m.Upstreams {
+		if seen[u.Identifier] {
+			errs = append(errs, fmt.Errorf("%w: %q", ErrDuplicateUpstreamIdentifier, u.Identifier))
+		}
+		seen[u.Identifier] = true
+	}
+
+	for _, u := range m.Upstreams {
+		errs = append(errs, upstreamProblems(u)...)
+	}
+	return errs
+}
+
+// upstreamProblems returns every reason an Upstream can't be used on its own.
+func upstreamProblems(u Upstream) []error {
+	var errs []error
+	if err := validateDestinations(u); err != nil {
+		errs = append(errs, err)
+	}
+	if u.FlushIntervalString != "" {
+		if _, err := parseFlushInterval(u.FlushIntervalString); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %q: %s", ErrInvalidFlushInterval, u.Identifier, err))
+		}
+	}
+	switch u.Protocol {
+	case "", UpstreamProtocolGRPCWeb:
+	default:
+		errs = append(errs, fmt.Errorf("%w: %q on %q", ErrInvalidProtocol, u.Protocol, u.Identifier))
+	}
+	for _, ms := range []int{u.TimeoutMS, u.DialTimeoutMS, u.TLSHandshakeTimeoutMS, u.ResponseHeaderTimeoutMS, u.SlowThresholdMS} {
+		if ms < 0 {
+			errs = append(errs, fmt.Errorf("%w: %q: %d", ErrInvalidTimeout, u.Identifier, ms))
+			break
+		}
+	}
+	if u.Auth != nil {
+		if err := u.Auth.validate(u.Identifier); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if u.Health != nil {
+		if err := u.Health.validate(u.Identifier); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := validateRoutes(u); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// UnroutedUpstreams returns the identifiers of the Upstreams that have no
+// routes, and so receive no traffic.
+func (m *Manifest) UnroutedUpstreams() []string {
+	var ids []string
+	for _, u := range m.Upstreams {
+		if len(u.Routes) == 0 {
+			ids = append(ids, u.Identifier)
+		}
+	}
+	return ids
+}
+
+// AnnotationKeys returns the sorted, unique annotation keys used by the
+// Manifest and its Upstreams.
+func (m *Manifest) AnnotationKeys() []string {
+	seen := map[string]bool{}
+	for k := range m.Annotations {
+		seen[k] = true
+	}
 	for _, u := range m.Upstreams {
-		id := u.Identifier
-		_, ok := upstreams[id]
-		if !ok {
-			upstreams[id] = &u
+		for k := range u.Annotations {
+			seen[k] = true
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AnnotationsWithPrefix returns the Manifest's annotations whose keys start
+// with the prefix, such as "company/".
+func (m *Manifest) AnnotationsWithPrefix(prefix string) map[string]string {
+	return annotationsWithPrefix(m.Annotations, prefix, false)
+}
+
+// AnnotationNamespace returns the Manifest's annotations whose keys start with
+// the prefix, keyed without it.
+func (m *Manifest) AnnotationNamespace(prefix string) map[string]string {
+	return annotationsWithPrefix(m.Annotations, prefix, true)
+}
+
+// AnnotationsWithPrefix returns the Upstream's annotations whose keys start
+// with the prefix, such as "company/". Libraries that own a namespace of
+// annotations can use it to read all of theirs.
+func (u Upstream) AnnotationsWithPrefix(prefix string) map[string]string {
+	return annotationsWithPrefix(u.Annotations, prefix, false)
+}
+
+// AnnotationNamespace returns the Upstream's annotations whose keys start with
+// the prefix, keyed without it. For example, with the prefix "company/", the
+// annotation "company/middleware-stack" is keyed "middleware-stack".
+func (u Upstream) AnnotationNamespace(prefix string) map[string]string {
+	return annotationsWithPrefix(u.Annotations, prefix, true)
+}
+
+func annotationsWithPrefix(annotations map[string]string, prefix string, strip bool) map[string]string {
+	matching := map[string]string{}
+	for k, v := range annotations {
+		if !strings.HasPrefix(k, prefix) {
 			continue
 		}
-		return nil, fmt.Errorf("%w: %q", ErrDuplicateUpstreamIdentifier, id)
+		if strip {
+			k = strings.TrimPrefix(k, prefix)
+		}
+		matching[k] = v
 	}
-	m.upstreamIndex = upstreams
+	return matching
+}
 
-	return &m, nil
+// Validate checks the Manifest, reporting every problem rather than just the
+// first. It returns nil if there are none, and otherwise a *ValidationError.
+// Manifests returned by LoadManifest never have errors, but they may have
+// warnings.
+func (m *Manifest) Validate() error {
+	v := &ValidationError{Errors: m.problems()}
+	v.Warnings = append(v.Warnings, m.unknown...)
+	for _, id := range m.UnroutedUpstreams() {
+		v.Warnings = append(v.Warnings, fmt.Errorf("%w: %q", ErrUnroutedUpstream, id))
+	}
+	for _, u := range m.Upstreams {
+		if err := validateRouteMethods(u); err != nil {
+			v.Warnings = append(v.Warnings, err)
+		}
+	}
+	if len(v.Errors) == 0 && len(v.Warnings) == 0 {
+		return nil
+	}
+	return v
+}
+
+// ValidationError is returned by Manifest.Validate. Errors are problems that
+// prevent the Manifest from being used, while Warnings are likely mistakes that
+// don't.
+type ValidationError struct {
+	Errors   []error
+	Warnings []error
+}
+
+// Fatal reports whether any of the problems prevent the Manifest from being
+// used.
+func (e *ValidationError) Fatal() bool {
+	return len(e.Errors) > 0
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	for _, err := range e.Warnings {
+		msgs = append(msgs, "warning: "+err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is reports whether any of the errors or warnings match target, so that
+// errors.Is can be used to look for a particular problem.
+func (e *ValidationError) Is(target error) bool {
+	for _, err := range append(e.Errors, e.Warnings...) {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateDestinations verifies that an Upstream specifies exactly one way of
+// reaching its destination(s) and that any weighted destinations are sane.
+func validateDestinations(u Upstream) error {
+	if u.Redirect != nil {
+		return validateRedirect(u)
+	}
+
+	switch {
+	case u.Destination == "" && len(u.Destinations) == 0:
+		return fmt.Errorf("%w: %q", ErrMissingDestination, u.Identifier)
+	case u.Destination != "" && len(u.Destinations) > 0:
+		return fmt.Errorf("%w: %q", ErrConflictingDestination, u.Identifier)
+	case len(u.Destinations) == 0:
+		return nil
+	}
+
+	weights := map[string]int{}
+	for _, d := range u.Destinations {
+		if _, ok := weights[d.Identifier]; ok {
+			return fmt.Errorf("%w: %q", ErrDuplicateDestinationIdentifier, d.Identifier)
+		}
+		weights[d.Identifier] = d.Weight
+	}
+	if err := validateWeights(weights); err != nil {
+		return fmt.Errorf("%w: %q", err, u.Identifier)
+	}
+	return nil
+}
+
+// validateRedirect verifies that an Upstream that redirects has no
+// destinations and a redirection status code.
+func validateRedirect(u Upstream) error {
+	if u.Destination != "" || len(u.Destinations) > 0 {
+		return fmt.Errorf("%w: %q", ErrConflictingRedirect, u.Identifier)
+	}
+	if s := u.Redirect.Status; s != 0 && (s < 300 || s > 399) {
+		return fmt.Errorf("%w: %q: status %d", ErrInvalidRedirect, u.Identifier, s)
+	}
+	if u.Redirect.To == "" {
+		return fmt.Errorf("%w: %q: missing target", ErrInvalidRedirect, u.Identifier)
+	}
+	return nil
+}
+
+// validateRouteMethods verifies that each of an Upstream's routes has at least
+// one method. Routes without any are tolerated when a Manifest is loaded, as
+// they always have been, since they do no harm beyond receiving no traffic.
+func validateRouteMethods(u Upstream) error {
+	for _, r := range u.Routes {
+		if len(r.Methods) == 0 {
+			return fmt.Errorf("%w: %q route %q has no methods", ErrInvalidRoute, u.Identifier, r.Path)
+		}
+	}
+	return nil
+}
+
+// validateRoutes verifies that each of an Upstream's routes has recognized
+// methods, a supported match type and a sane timeout.
+func validateRoutes(u Upstream) error {
+	for _, r := range u.Routes {
+		for _, m := range r.Methods {
+			if !IsValidMethod(m) {
+				return fmt.Errorf("%w: %q on %q route %q", ErrInvalidMethod, m, u.Identifier, r.Path)
+			}
+		}
+		switch r.Match {
+		case "", RouteMatchExact, RouteMatchPrefix:
+		default:
+			return fmt.Errorf("%w: %q on %q route %q", ErrInvalidRouteMatch, r.Match, u.Identifier, r.Path)
+		}
+		if r.TimeoutMS < 0 {
+			return fmt.Errorf("%w: %q route %q: %d", ErrInvalidTimeout, u.Identifier, r.Path, r.TimeoutMS)
+		}
+		if r.Sunset != "" {
+			if _, err := parseSunset(r.Sunset); err != nil {
+				return fmt.Errorf("%w: %q route %q: %q", ErrInvalidSunset, u.Identifier, r.Path, r.Sunset)
+			}
+		}
+		if _, err := compileHost(r.HostPattern(u)); err != nil {
+			return fmt.Errorf("%q route %q: %w", u.Identifier, r.Path, err)
+		}
+	}
+	return nil
+}
+
+// validateWeights verifies that no weight is negative and that the weights add
+// up to a positive total.
+func validateWeights(weights map[string]int) error {
+	var total int
+	for _, w := range weights {
+		if w < 0 {
+			return ErrInvalidWeights
+		}
+		total += w
+	}
+	if total == 0 {
+		return ErrInvalidWeights
+	}
+	return nil
 }
@@ -0,0 +1,265 @@
+package pass
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// candidate is a route registered for a method and pattern, along with the
+// conditions a request must meet for the route to handle it.
+type candidate struct {
+	upstream string
+	method   string                   // Method the route was registered for, or anyMethod
+	path     string                   // Path of the Route, as written in the Manifest
+	prefix   string                   // Path the Upstream's routes are mounted under
+	strip    bool                     // Whether the prefix is stripped when proxying
+	match    func(*http.Request) bool // Always matches if nil
+	handler  http.Handler
+}
+
+// anyMethod is the method routes that accept every recognized method are
+// registered under, so they take one handler rather than one per method.
+const anyMethod = "*"
+
+// handle registers a route with the router. Routes with conditions are tried
+// before those without, otherwise in the order they're registered. The first
+// route whose conditions the request meets handles it; if none do, the request
+// is handed to the not-found handler. Routes registered for anyMethod are
+// candidates for every method.
+func (rt *routing) handle(method, pattern string, c candidate) {
+	c.method = method
+	key := method + " " + pattern
+
+	if method == anyMethod {
+		if _, ok := rt.candidates[key]; !ok {
+			rt.router.Handle(pattern, rt.dispatch(key))
+			// Handle replaces the handlers for specific methods, so they're
+			// registered again.
+			for _, m := range methods {
+				if mkey := m + " " + pattern; rt.candidates[mkey] != nil {
+					rt.router.Method(m, pattern, rt.dispatch(mkey))
+				}
+			}
+		}
+		rt.candidates[key] = insertCandidate(rt.candidates[key], c)
+		for _, m := range methods {
+			if mkey := m + " " + pattern; rt.candidates[mkey] != nil {
+				rt.candidates[mkey] = insertCandidate(rt.candidates[mkey], c)
+			}
+		}
+		return
+	}
+
+	candidates, ok := rt.candidates[key]
+	if !ok {
+		rt.router.Method(method, pattern, rt.dispatch(key))
+		candidates = append([]candidate{}, rt.candidates[anyMethod+" "+pattern]...)
+	}
+	rt.candidates[key] = insertCandidate(candidates, c)
+}
+
+// insertCandidate adds c to the candidates, after those it shouldn't be tried
+// before.
+func insertCandidate(candidates []candidate, c candidate) []candidate {
+	i := len(candidates)
+	if c.match != nil {
+		for i = 0; i < len(candidates); i++ {
+			if candidates[i].match == nil {
+				break
+			}
+		}
+	}
+	candidates = append(candidates, candidate{})
+	copy(candidates[i+1:], candidates[i:])
+	candidates[i] = c
+	return candidates
+}
+
+// coversAllMethods reports whether the list includes every recognized method.
+func coversAllMethods(list []string) bool {
+	for _, m := range methods {
+		found := false
+		for _, l := range list {
+			if l == m {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func (rt *routing) dispatch(key string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, c := range rt.candidates[key] {
+			if c.match == nil || c.match(r) {
+				if m, ok := r.Context().Value(matchOnlyKey{}).(*RouteMatch); ok {
+					*m = c.routeMatch(r)
+					return
+				}
+				if matched, ok := r.Context().Value(matchedKey{}).(*string); ok {
+					*matched = c.upstream
+				}
+				c.handler.ServeHTTP(w, r)
+				return
+			}
+		}
+		rt.serveNotFound(w, r)
+	})
+}
+
+// serveNotFound hands a request no route matched to the not-found handler,
+// unless it's only being matched, can be redirected to a prefixed route or is
+// an OPTIONS request serveOptions can answer.
+func (rt *routing) serveNotFound(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.Context().Value(matchOnlyKey{}).(*RouteMatch); ok {
+		return
+	}
+	if rt.redirectToPrefix(w, r) {
+		return
+	}
+	if rt.serveOptions(w, r) {
+		return
+	}
+	rt.notFound.ServeHTTP(w, r)
+}
+
+// RouteMatch describes the route a request matches. See Proxy.Match.
+type RouteMatch struct {
+	Upstream     string            // Identifier of the Upstream the request is routed to
+	Method       string            // Method of the matching route
+	Path         string            // Path of the matching route, as written in the Manifest
+	Prefix       string            // Path the Upstream's routes are mounted under
+	URLParams    map[string]string // Path parameters captured by the route
+	UpstreamPath string            // Path of the request sent to the Upstream, once the prefix is stripped
+}
+
+// matchOnlyKey is the context key for the RouteMatch that Proxy.Match fills in
+// instead of serving the request.
+type matchOnlyKey struct{}
+
+// Match reports the route a request would be routed to, without serving it.
+// Request conditions, such as the host and headers, are taken into account.
+// It reports false if no route matches.
+func (p *Proxy) Match(r *http.Request) (RouteMatch, bool) {
+	var m RouteMatch
+	rt := p.current()
+	r = rt.rewrite(r)
+	r = r.Clone(context.WithValue(r.Context(), matchOnlyKey{}, &m))
+	rt.router.ServeHTTP(&discardResponseWriter{header: http.Header{}}, r)
+	return m, m.Upstream != ""
+}
+
+// routeMatch describes the candidate as the route matching r.
+func (c candidate) routeMatch(r *http.Request) RouteMatch {
+	m := RouteMatch{
+		Upstream:     c.upstream,
+		Method:       c.method,
+		Path:         c.path,
+		Prefix:       c.prefix,
+		URLParams:    URLParams(r),
+		UpstreamPath: r.URL.Path,
+	}
+	if m.Method == anyMethod {
+		m.Method = r.Method
+	}
+	if c.strip {
+		m.UpstreamPath = strings.TrimPrefix(r.URL.Path, c.prefix)
+	}
+	return m
+}
+
+// matchedKey is the context key for the identifier of the Upstream a request
+// was routed to.
+type matchedKey struct{}
+
+// TrackMatchedUpstream returns a copy of the request whose context records the
+// Upstream it's routed to, if any, when it's served by a Proxy. Middleware that
+// wraps a Proxy can use this to read MatchedUpstream after the request has been
+// served. The Proxy does this itself for handlers it calls.
+func TrackMatchedUpstream(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), matchedKey{}, new(string))
+	return r.WithContext(ctx)
+}
+
+// MatchedUpstream returns the identifier of the Upstream whose route matched
+// the request. It returns false for requests that fell through to the
+// not-found handler, even if an upstream responds with 404 Not Found itself.
+// See TrackMatchedUpstream for using it outside of the Proxy.
+func MatchedUpstream(ctx context.Context) (string, bool) {
+	matched, ok := ctx.Value(matchedKey{}).(*string)
+	if !ok || *matched == "" {
+		return "", false
+	}
+	return *matched, true
+}
+
+// routeMatcher returns a function reporting whether a request meets a Route's
+// match conditions, or nil if the Route has none. The host pattern, if not nil,
+// is one of the conditions.
+func routeMatcher(route Route, host *hostPattern) func(*http.Request) bool {
+	if len(route.MatchHeaders) == 0 && len(route.MatchQuery) == 0 && route.MatchContentType == "" && host == nil {
+		return nil
+	}
+	return func(r *http.Request) bool {
+		if host != nil {
+			if _, ok := host.match(r.Host); !ok {
+				return false
+			}
+		}
+		return matchHeaders(r.Header, route.MatchHeaders) &&
+			matchQuery(r.URL.Query(), route.MatchQuery) &&
+			matchContentType(r.Header, route.MatchContentType)
+	}
+}
+
+// matchContentType reports whether the Content-Type header begins with prefix,
+// ignoring case. Any Content-Type matches an empty prefix.
+func matchContentType(h http.Header, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	ct := h.Get("Content-Type")
+	return len(ct) >= len(prefix) && strings.EqualFold(ct[:len(prefix)], prefix)
+}
+
+// matchHeaders reports whether each of the headers has one of its values equal
+// to the one given.
+func matchHeaders(h http.Header, want map[string]string) bool {
+	for k, v := range want {
+		var found bool
+		for _, actual := range h.Values(k) {
+			if actual == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchQuery reports whether each of the query parameters has one of its values
+// equal to the one given.
+func matchQuery(q url.Values, want map[string]string) bool {
+	for k, v := range want {
+		var found bool
+		for _, actual := range q[k] {
+			if actual == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,329 @@
+package pass
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestMatchHeaders(t *testing.T) {
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "stable")
+	}))
+	defer stable.Close()
+	beta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "beta")
+	}))
+	defer beta.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"stable": cty.StringVal(stable.URL),
+			"beta":   cty.StringVal(beta.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/match_headers.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		status int
+		body   string
+	}{
+		{"present", "/widgets", "true", http.StatusOK, "beta"},
+		{"absent", "/widgets", "", http.StatusOK, "stable"},
+		{"mismatched", "/widgets", "false", http.StatusOK, "stable"},
+		{"present without fallback", "/previews", "true", http.StatusOK, "beta"},
+		{"absent without fallback", "/previews", "", http.StatusNotFound, ""},
+		{"mismatched without fallback", "/previews", "false", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			require.NoError(t, err)
+			if tt.header != "" {
+				req.Header.Set("X-Beta", tt.header)
+			}
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+			if tt.body != "" {
+				b, err := ioutil.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.body, string(b))
+			}
+		})
+	}
+}
+
+func TestMatchQuery(t *testing.T) {
+	v1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "v1")
+	}))
+	defer v1.Close()
+	v2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "v2 "+r.URL.RawQuery)
+	}))
+	defer v2.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"v1": cty.StringVal(v1.URL),
+			"v2": cty.StringVal(v2.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/match_query.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		body   string
+	}{
+		{"matching", "/search?engine=v2&q=widgets", http.StatusOK, "v2 engine=v2&q=widgets"},
+		{"mismatched", "/search?engine=v1", http.StatusOK, "v1"},
+		{"absent", "/search?q=widgets", http.StatusOK, "v1"},
+		{"repeated key", "/search?engine=v1&engine=v2", http.StatusOK, "v2 engine=v1&engine=v2"},
+		{"case-sensitive value", "/search?engine=V2", http.StatusOK, "v1"},
+		{"matching without fallback", "/reports?engine=v2", http.StatusOK, "v2 engine=v2"},
+		{"absent without fallback", "/reports", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tt.path)
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+			if tt.body != "" {
+				b, err := ioutil.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.body, string(b))
+			}
+		})
+	}
+}
+
+func TestMatchContentType(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "api")
+	}))
+	defer api.Close()
+	uploads := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "uploads")
+	}))
+	defer uploads.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"api":     cty.StringVal(api.URL),
+			"uploads": cty.StringVal(uploads.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/match_content_type.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		status      int
+		body        string
+	}{
+		{"matching", "/documents", "multipart/form-data; boundary=x", http.StatusOK, "uploads"},
+		{"matching case-insensitively", "/documents", "Multipart/Mixed", http.StatusOK, "uploads"},
+		{"non-matching", "/documents", "application/json", http.StatusOK, "api"},
+		{"absent", "/documents", "", http.StatusOK, "api"},
+		{"matching without fallback", "/attachments", "multipart/form-data", http.StatusOK, "uploads"},
+		{"non-matching without fallback", "/attachments", "multipart/mixed", http.StatusNotFound, ""},
+		{"absent without fallback", "/attachments", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, server.URL+tt.path, nil)
+			require.NoError(t, err)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+			if tt.body != "" {
+				b, err := ioutil.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.body, string(b))
+			}
+		})
+	}
+}
+
+func TestMatchedUpstream(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/routing.hcl", ectx)
+	require.NoError(t, err)
+
+	var inner string
+	middleware := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inner, _ = MatchedUpstream(r.Context())
+			next.ServeHTTP(w, r)
+		})
+	}
+	var notFoundMatched bool
+	notFound := func(w http.ResponseWriter, r *http.Request) {
+		_, notFoundMatched = MatchedUpstream(r.Context())
+		w.WriteHeader(http.StatusNotFound)
+	}
+	proxy, err := New(m, WithUpstreamMiddleware("accounts", middleware), WithNotFound(notFound))
+	require.NoError(t, err)
+
+	var (
+		matched string
+		ok      bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = TrackMatchedUpstream(r)
+		proxy.ServeHTTP(w, r)
+		matched, ok = MatchedUpstream(r.Context())
+	}))
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	// The upstream's own 404 is still a match.
+	resp, err := client.Get(server.URL + "/api/v2/private/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.True(t, ok)
+	require.Equal(t, "accounts", matched)
+	require.Equal(t, "accounts", inner)
+
+	resp, err = client.Get(server.URL + "/api/v2/private/notfound")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.False(t, ok)
+	require.Empty(t, matched)
+	require.False(t, notFoundMatched)
+
+	_, ok = MatchedUpstream(context.Background())
+	require.False(t, ok)
+}
+
+func TestAllMethodsRoute(t *testing.T) {
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "stable")
+	}))
+	defer stable.Close()
+	beta := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Served-By", "beta")
+	}))
+	defer beta.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"stable": cty.StringVal(stable.URL),
+			"beta":   cty.StringVal(beta.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/all_methods.hcl", ectx)
+	require.NoError(t, err)
+
+	var observed *RouteInfo
+	proxy, err := New(m, WithObserveFunction(func(r *http.Request, info *RouteInfo) {
+		observed = info
+	}))
+	require.NoError(t, err)
+
+	// One registration for every method, plus the beta GET route.
+	require.Len(t, proxy.current().candidates, 2)
+
+	for _, method := range methods {
+		t.Run(method, func(t *testing.T) {
+			r := httptest.NewRequest(method, "/widgets", nil)
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			require.Equal(t, "stable", w.Header().Get("X-Served-By"))
+			require.Equal(t, method, observed.RouteMethod)
+		})
+	}
+
+	t.Run("conditional route for one method", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/widgets", nil)
+		r.Header.Set("X-Beta", "true")
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, "beta", w.Header().Get("X-Served-By"))
+		require.Equal(t, http.MethodGet, observed.RouteMethod)
+	})
+}
+
+func TestProxyMatch(t *testing.T) {
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"stable": cty.StringVal("http://stable.local"),
+			"beta":   cty.StringVal("http://beta.local"),
+		},
+	}
+	m, err := LoadManifest("testdata/match_headers.hcl", ectx)
+	require.NoError(t, err)
+
+	var observed int
+	proxy, err := New(m, WithObserveFunction(func(*http.Request, *RouteInfo) { observed++ }))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/widgets", nil)
+	match, ok := proxy.Match(r)
+	require.True(t, ok)
+	require.Equal(t, RouteMatch{
+		Upstream:     "stable",
+		Method:       http.MethodGet,
+		Path:         "/widgets",
+		UpstreamPath: "/widgets",
+	}, match)
+
+	r.Header.Set("X-Beta", "true")
+	match, ok = proxy.Match(r)
+	require.True(t, ok)
+	require.Equal(t, "beta", match.Upstream)
+
+	_, ok = proxy.Match(httptest.NewRequest(http.MethodGet, "/previews", nil))
+	require.False(t, ok)
+	require.Zero(t, observed)
+}
@@ -0,0 +1,55 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidMethod is returned when a Route, or configuration such as
+// CORSConfig.AllowedMethods, names a method that isn't recognized.
+var ErrInvalidMethod = fmt.Errorf("invalid method")
+
+// methods are the recognized HTTP methods: those defined by RFC 7231 and
+// PATCH, from RFC 5789.
+var methods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// IsValidMethod reports whether s is a recognized HTTP method. Case is ignored,
+// so "get" is recognized as GET.
+func IsValidMethod(s string) bool {
+	s = strings.ToUpper(s)
+	for _, m := range methods {
+		if m == s {
+			return true
+		}
+	}
+	return false
+}
+
+// upperMethods returns a copy of methods in upper case, without the
+// duplicates that differed only in case.
+func upperMethods(methods []string) []string {
+	if methods == nil {
+		return nil
+	}
+	upper := make([]string, 0, len(methods))
+	seen := map[string]bool{}
+	for _, m := range methods {
+		m = strings.ToUpper(m)
+		if !seen[m] {
+			seen[m] = true
+			upper = append(upper, m)
+		}
+	}
+	return upper
+}
@@ -0,0 +1,72 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestIsValidMethod(t *testing.T) {
+	for _, m := range []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE"} {
+		require.True(t, IsValidMethod(m), m)
+	}
+	for _, m := range []string{"get", "Post", "delete"} {
+		require.True(t, IsValidMethod(m), m)
+	}
+	for _, m := range []string{"", "PROPFIND", "BREW", "GET ", "fetch"} {
+		require.False(t, IsValidMethod(m), m)
+	}
+}
+
+func TestInvalidMethod(t *testing.T) {
+	_, err := LoadManifest("testdata/invalid_method.hcl", nil)
+	require.True(t, errors.Is(err, ErrInvalidMethod))
+
+	m, err := LoadManifest("testdata/basic.hcl", nil)
+	require.NoError(t, err)
+	_, err = New(m, WithUpstreamCORS("accounts", CORSConfig{AllowedMethods: []string{"GET", "FETCH"}}))
+	require.True(t, errors.Is(err, ErrInvalidMethod))
+}
+
+func TestLowercaseMethods(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method))
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"widgets": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/lowercase_methods.hcl", ectx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"GET", "POST"}, m.Upstreams[0].Routes[0].Methods)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(method, "/widgets", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, method, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/widgets", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	var reg Manifest
+	require.NoError(t, reg.AddUpstream(Upstream{
+		Identifier:  "widgets",
+		Destination: destination.URL,
+		Routes:      []Route{{Methods: []string{"delete"}, Path: "/widgets"}},
+	}))
+	require.Equal(t, []string{"DELETE"}, reg.Upstreams[0].Routes[0].Methods)
+}
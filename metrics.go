@@ -0,0 +1,54 @@
+package pass
+
+import (
+	"net/http"
+	"time"
+)
+
+// Metrics records metrics about requests being proxied upstream. It's called
+// at each stage of a request's lifecycle with the RouteInfo of the route that
+// matched. Requests that no route matched are recorded too, with a RouteInfo
+// marked Unmatched.
+type Metrics interface {
+	// IncRequest is called just before a request is proxied upstream.
+	IncRequest(info *RouteInfo)
+	// ObserveLatency is called once the upstream has been given the request
+	// and the response has been written, whether or not it succeeded.
+	ObserveLatency(info *RouteInfo, d time.Duration)
+	// IncError is called when a request can't be proxied or the upstream
+	// can't be reached. This includes requests rejected before being proxied,
+	// such as those to a disabled Upstream.
+	IncError(info *RouteInfo, err error)
+}
+
+// ExemplarMetrics is a Metrics that can attach exemplars, such as the ID of a
+// trace, to latency observations. When the Metrics given to WithMetrics
+// implements it and a TraceIDFunc is configured with WithTraceIDFunc,
+// ObserveLatencyWithExemplar is called in place of ObserveLatency for requests
+// that are being traced.
+type ExemplarMetrics interface {
+	Metrics
+	// ObserveLatencyWithExemplar is ObserveLatency with exemplar labels, such
+	// as {"trace_id": "..."}, to record alongside the observation.
+	ObserveLatencyWithExemplar(info *RouteInfo, d time.Duration, exemplar map[string]string)
+}
+
+// TraceIDFunc returns the ID of the trace a request is part of, typically from
+// the span stored in its context by tracing middleware. It returns an empty
+// string if the request isn't being traced.
+type TraceIDFunc func(*http.Request) string
+
+// ExemplarTraceID is the exemplar label holding the ID of a trace.
+const ExemplarTraceID = "trace_id"
+
+// observeLatency records the latency of a request with the Metrics, attaching
+// its trace ID as an exemplar if possible.
+func observeLatency(r *http.Request, cfg mountConfig, info *RouteInfo, d time.Duration) {
+	if em, ok := cfg.metrics.(ExemplarMetrics); ok && cfg.traceID != nil {
+		if id := cfg.traceID(r); id != "" {
+			em.ObserveLatencyWithExemplar(info, d, map[string]string{ExemplarTraceID: id})
+			return
+		}
+	}
+	cfg.metrics.ObserveLatency(info, d)
+}
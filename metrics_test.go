@@ -0,0 +1,201 @@
+package pass
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type recordingMetrics struct {
+	mu        sync.Mutex
+	requests  []RouteInfo
+	latencies []time.Duration
+	errors    []error
+}
+
+func (m *recordingMetrics) IncRequest(info *RouteInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, *info)
+}
+
+func (m *recordingMetrics) ObserveLatency(info *RouteInfo, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencies = append(m.latencies, d)
+}
+
+func (m *recordingMetrics) IncError(info *RouteInfo, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors = append(m.errors, err)
+}
+
+func (m *recordingMetrics) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests, m.latencies, m.errors = nil, nil, nil
+}
+
+func TestMetrics(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	var broken int32
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if atomic.LoadInt32(&broken) == 1 {
+			return nil, fmt.Errorf("broken transport")
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	metrics := &recordingMetrics{}
+	proxy, err := New(m, WithMetrics(metrics), WithTransport(transport))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	t.Run("success", func(t *testing.T) {
+		metrics.reset()
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		require.Len(t, metrics.requests, 1)
+		require.Equal(t, "accounts", metrics.requests[0].UpstreamIdentifier)
+		require.Equal(t, "/accounts", metrics.requests[0].RoutePath)
+		require.Equal(t, destination.URL, metrics.requests[0].UpstreamHost)
+		require.Len(t, metrics.latencies, 1)
+		require.Empty(t, metrics.errors)
+	})
+
+	t.Run("upstream error", func(t *testing.T) {
+		metrics.reset()
+		atomic.StoreInt32(&broken, 1)
+		defer atomic.StoreInt32(&broken, 0)
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+		require.Len(t, metrics.requests, 1)
+		require.Len(t, metrics.latencies, 1)
+		require.Len(t, metrics.errors, 1)
+		require.Contains(t, metrics.errors[0].Error(), "broken transport")
+	})
+
+	t.Run("disabled upstream", func(t *testing.T) {
+		metrics.reset()
+		require.NoError(t, proxy.SetUpstreamEnabled("accounts", false))
+		defer func() { require.NoError(t, proxy.SetUpstreamEnabled("accounts", true)) }()
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		require.Empty(t, metrics.requests)
+		require.Empty(t, metrics.latencies)
+		require.Len(t, metrics.errors, 1)
+		require.True(t, errors.Is(metrics.errors[0], ErrUpstreamDisabled))
+	})
+}
+
+type exemplarMetrics struct {
+	recordingMetrics
+	exemplars []map[string]string
+}
+
+func (m *exemplarMetrics) ObserveLatencyWithExemplar(info *RouteInfo, d time.Duration, exemplar map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.latencies = append(m.latencies, d)
+	m.exemplars = append(m.exemplars, exemplar)
+}
+
+func TestMetricsExemplars(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	traceID := func(r *http.Request) string {
+		return r.Header.Get("X-Trace-Id")
+	}
+	metrics := &exemplarMetrics{}
+	proxy, err := New(m, WithMetrics(metrics), WithTraceIDFunc(traceID))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/accounts", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Trace-Id", "4bf92f3577b34da6a3ce929d0e0e4736")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Untraced requests are observed without an exemplar.
+	resp, err = client.Get(server.URL + "/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.Len(t, metrics.latencies, 2)
+	require.Equal(t, []map[string]string{{ExemplarTraceID: "4bf92f3577b34da6a3ce929d0e0e4736"}}, metrics.exemplars)
+}
+
+func TestRouteTemplate(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/routing.hcl", ectx)
+	require.NoError(t, err)
+
+	metrics := &recordingMetrics{}
+	proxy, err := New(m, WithMetrics(metrics))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	for _, id := range []string{"1", "2"} {
+		resp, err := client.Get(server.URL + "/api/v2/private/accounts/" + id)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	require.Len(t, metrics.requests, 2)
+	for _, info := range metrics.requests {
+		require.Equal(t, "/accounts/{id}", info.RoutePath)
+		require.Equal(t, "/api/v2/private/accounts/{id}", info.RouteTemplate)
+	}
+}
@@ -0,0 +1,116 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// ErrInvalidMiddlewareOrder is returned when the order given to
+// WithMiddlewareOrder doesn't name each MiddlewareLayer exactly once.
+var ErrInvalidMiddlewareOrder = fmt.Errorf("invalid middleware order")
+
+// MiddlewareLayer is one of the layers of middleware applied to routes. See
+// WithMiddlewareOrder.
+type MiddlewareLayer int
+
+// Middleware layers, in their default order from outermost to innermost.
+const (
+	MiddlewareGlobal     MiddlewareLayer = iota // WithMiddleware
+	MiddlewareAnnotation                        // WithAnnotationMiddleware
+	MiddlewareUpstream                          // WithUpstreamMiddleware
+	MiddlewareRoute                             // WithRouteMiddleware
+)
+
+// DefaultMiddlewareOrder is the order middleware layers are applied in, from
+// outermost to innermost, unless WithMiddlewareOrder says otherwise.
+var DefaultMiddlewareOrder = []MiddlewareLayer{
+	MiddlewareGlobal,
+	MiddlewareAnnotation,
+	MiddlewareUpstream,
+	MiddlewareRoute,
+}
+
+func (l MiddlewareLayer) String() string {
+	switch l {
+	case MiddlewareGlobal:
+		return "global"
+	case MiddlewareAnnotation:
+		return "annotation"
+	case MiddlewareUpstream:
+		return "upstream"
+	case MiddlewareRoute:
+		return "route"
+	}
+	return fmt.Sprintf("MiddlewareLayer(%d)", int(l))
+}
+
+// annotationMiddleware is the configuration given to WithAnnotationMiddleware.
+type annotationMiddleware struct {
+	key string
+	fn  func(value string) func(http.Handler) http.Handler
+}
+
+// routeMiddleware is the configuration given to WithRouteMiddleware.
+type routeMiddleware struct {
+	upstream string
+	path     string
+	stack    []func(http.Handler) http.Handler
+}
+
+// validateMiddlewareOrder verifies that every layer appears exactly once.
+func validateMiddlewareOrder(order []MiddlewareLayer) error {
+	seen := map[MiddlewareLayer]bool{}
+	for _, l := range order {
+		if l < MiddlewareGlobal || l > MiddlewareRoute || seen[l] {
+			return fmt.Errorf("%w: %v", ErrInvalidMiddlewareOrder, order)
+		}
+		seen[l] = true
+	}
+	if len(seen) != len(DefaultMiddlewareOrder) {
+		return fmt.Errorf("%w: %v", ErrInvalidMiddlewareOrder, order)
+	}
+	return nil
+}
+
+// layeredMiddleware returns the middleware given to the Proxy's options for a
+// route, in the configured order of layers.
+func layeredMiddleware(u Upstream, route Route, cfg mountConfig) chi.Middlewares {
+	var mws chi.Middlewares
+	for _, layer := range cfg.middlewareOrder {
+		switch layer {
+		case MiddlewareGlobal:
+			mws = append(mws, cfg.middleware...)
+		case MiddlewareAnnotation:
+			for _, am := range cfg.annotationMws {
+				if v, ok := u.Annotations[am.key]; ok {
+					mws = append(mws, am.fn(v))
+				}
+			}
+		case MiddlewareUpstream:
+			mws = append(mws, cfg.upstreamMiddleware[u.Identifier]...)
+		case MiddlewareRoute:
+			for _, rm := range cfg.routeMiddleware {
+				if rm.upstream == u.Identifier && rm.path == route.Path {
+					mws = append(mws, rm.stack...)
+				}
+			}
+		}
+	}
+	return mws
+}
+
+// hasRoutePath reports whether the Manifest's upstream has a route with path.
+func hasRoutePath(m *Manifest, upstream, path string) bool {
+	u, ok := m.upstreamIndex[upstream]
+	if !ok {
+		return false
+	}
+	for _, r := range u.Routes {
+		if r.Path == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func stampLayer(name string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Layers", name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	m, err := LoadManifest("testdata/middleware.hcl", nil)
+	require.NoError(t, err)
+
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Header: http.Header{}}, nil
+	})
+	layers := []MountOption{
+		WithTransport(transport),
+		WithMiddleware(stampLayer("global")),
+		WithAnnotationMiddleware("team", func(team string) func(http.Handler) http.Handler {
+			return stampLayer("annotation:" + team)
+		}),
+		WithUpstreamMiddleware("accounts", stampLayer("upstream")),
+		WithRouteMiddleware("accounts", "/accounts/{id}", stampLayer("route")),
+	}
+	serve := func(t *testing.T, proxy *Proxy, path string) []string {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w.Header().Values("X-Layers")
+	}
+
+	t.Run("default", func(t *testing.T) {
+		proxy, err := New(m, layers...)
+		require.NoError(t, err)
+		require.Equal(t, []string{"global", "annotation:identity", "upstream", "route"}, serve(t, proxy, "/accounts/1"))
+		require.Equal(t, []string{"global", "annotation:identity", "upstream"}, serve(t, proxy, "/accounts"))
+		require.Equal(t, []string{"global"}, serve(t, proxy, "/widgets"))
+	})
+
+	t.Run("custom", func(t *testing.T) {
+		order := []MiddlewareLayer{MiddlewareRoute, MiddlewareUpstream, MiddlewareGlobal, MiddlewareAnnotation}
+		proxy, err := New(m, append(layers, WithMiddlewareOrder(order))...)
+		require.NoError(t, err)
+		require.Equal(t, []string{"route", "upstream", "global", "annotation:identity"}, serve(t, proxy, "/accounts/1"))
+	})
+
+	t.Run("invalid order", func(t *testing.T) {
+		order := []MiddlewareLayer{MiddlewareRoute, MiddlewareRoute, MiddlewareGlobal, MiddlewareAnnotation}
+		_, err := New(m, WithMiddlewareOrder(order))
+		require.True(t, errors.Is(err, ErrInvalidMiddlewareOrder))
+
+		_, err = New(m, WithMiddlewareOrder(order[2:]))
+		require.True(t, errors.Is(err, ErrInvalidMiddlewareOrder))
+	})
+
+	t.Run("unknown route", func(t *testing.T) {
+		_, err := New(m, WithRouteMiddleware("accounts", "/missing", stampLayer("route")))
+		require.True(t, errors.Is(err, ErrMissingUpstreamForMiddleware))
+
+		_, err = New(m, WithRouteMiddleware("missing", "/accounts", stampLayer("route")))
+		require.True(t, errors.Is(err, ErrMissingUpstreamForMiddleware))
+	})
+}
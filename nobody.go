@@ -0,0 +1,45 @@
+package pass
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ErrUnexpectedBody is passed to the ErrorHandler when a request has a body
+// but its method is one given to WithRejectGetBody.
+var ErrUnexpectedBody = fmt.Errorf("unexpected request body")
+
+// defaultBodilessMethods are the methods WithRejectGetBody rejects bodies for
+// when it isn't given any.
+var defaultBodilessMethods = []string{http.MethodGet, http.MethodHead, http.MethodDelete}
+
+// rejectBody is middleware that responds with 400 Bad Request to requests with
+// one of methods that have a non-empty body.
+func rejectBody(methods map[string]bool, cfg mountConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if methods[r.Method] && hasBody(r) {
+				serveError(w, r, cfg, fmt.Errorf("%w: %s", ErrUnexpectedBody, r.Method), http.StatusBadRequest)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasBody reports whether a request has a non-empty body. Bodies of unknown
+// length are peeked at, and what's read is put back.
+func hasBody(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+		return false
+	}
+	if r.ContentLength > 0 {
+		return true
+	}
+	var b [1]byte
+	n, _ := io.ReadFull(r.Body, b[:])
+	r.Body = readCloser{io.MultiReader(bytes.NewReader(b[:n]), r.Body), r.Body}
+	return n > 0
+}
@@ -0,0 +1,69 @@
+package pass
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRejectGetBody(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(destination.URL),
+			"secondary": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	var handled error
+	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+		handled = err
+		w.WriteHeader(http.StatusBadRequest)
+	}
+
+	tests := []struct {
+		name    string
+		methods []string
+		method  string
+		body    io.Reader
+		length  int64
+		status  int
+	}{
+		{"get with body", nil, http.MethodGet, strings.NewReader("payload"), 7, http.StatusBadRequest},
+		{"get with chunked body", nil, http.MethodGet, strings.NewReader("payload"), -1, http.StatusBadRequest},
+		{"get with empty chunked body", nil, http.MethodGet, strings.NewReader(""), -1, http.StatusOK},
+		{"get without body", nil, http.MethodGet, nil, 0, http.StatusOK},
+		{"post with body", nil, http.MethodPost, strings.NewReader("payload"), 7, http.StatusOK},
+		{"configured methods", []string{"post"}, http.MethodPost, strings.NewReader("payload"), 7, http.StatusBadRequest},
+		{"method not configured", []string{"post"}, http.MethodGet, strings.NewReader("payload"), 7, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handled = nil
+			proxy, err := New(m, WithRejectGetBody(tt.methods...), WithErrorHandler(errorHandler))
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(tt.method, "/widgets", tt.body)
+			r.ContentLength = tt.length
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusBadRequest {
+				require.True(t, errors.Is(handled, ErrUnexpectedBody))
+			} else {
+				require.NoError(t, handled)
+			}
+		})
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"log"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // MountOption is a functional option used when mounting a manifest to a router.
@@ -12,18 +15,30 @@ type MountOption func(*mountConfig)
 
 // ObserveFunction is a function called just before a request is proxied to an
 // upstream host. It provides an opportunity to perform logging and update
-// metrics with information about the route.
+// metrics with information about the route. It's also called for requests that
+// no route matches, with a RouteInfo marked Unmatched, just before they're
+// handed to the not-found handler.
 type ObserveFunction func(*http.Request, *RouteInfo)
 
 // RouteInfo is a structure that communicates route information to an
-// ObserveFunction.
+// ObserveFunction. Its fields come from the Manifest rather than the request,
+// so RouteTemplate and the others are suitable for labeling metrics without
+// unbounded cardinality. The concrete path is in the request's URL.
 type RouteInfo struct {
-	RouteMethod        string
-	RoutePath          string
-	RoutePrefix        string
-	UpstreamHost       string
-	UpstreamIdentifier string
-	UpstreamOwner      string
+	RouteMethod         string
+	RoutePath           string
+	RoutePrefix         string
+	UpstreamHost        string
+	UpstreamIdentifier  string
+	UpstreamOwner       string
+	RouteTemplate       string            // Route's path pattern including its prefix, such as "/api/accounts/{id}", rather than the request's path
+	UpstreamDestination string            // Identifier of the chosen Destination, if the Upstream has several
+	UpstreamURL         string            // URL the request is proxied to, before any RequestModifier is applied
+	ServedBy            string            // Identifier of the Upstream that served the request, which differs from UpstreamIdentifier if a fallback did
+	Extra               map[string]string // Values from the RequestEnricher, if one is configured
+	HostParams          map[string]string // Parameters captured from the request's Host by the route's host pattern
+	ClientIP            string            // IP address of the client, as resolved by the ClientIPResolver
+	Unmatched           bool              // Whether no route matched, so the request fell through to the not-found handler
 }
 
 // WithObserveFunction sets an ObserveFunction to use for all requests being
@@ -34,16 +49,57 @@ func WithObserveFunction(fn ObserveFunction) MountOption {
 	}
 }
 
+// RequestEnricher is a function that derives values from a request, such as the
+// client's country from its IP address, to be recorded in RouteInfo.Extra.
+type RequestEnricher func(*http.Request) map[string]string
+
+// WithRequestEnricher specifies a RequestEnricher to call for every request
+// being proxied upstream. It's called just before the ObserveFunction, and its
+// values are copied so each request has its own.
+func WithRequestEnricher(fn RequestEnricher) MountOption {
+	return func(c *mountConfig) {
+		c.enricher = fn
+	}
+}
+
+// WithMetrics specifies a Metrics implementation to record requests, latencies
+// and errors for all requests being proxied upstream.
+func WithMetrics(m Metrics) MountOption {
+	return func(c *mountConfig) {
+		c.metrics = m
+	}
+}
+
 // WithRoot informs the proxy of the root mount point. This root prefix will be
-// stripped away from all requests sent upstream.
+// stripped away from all requests sent upstream. A leading slash is added if
+// it's missing. It can be changed later with Proxy.SetRoot.
 func WithRoot(prefix string) MountOption {
 	return func(c *mountConfig) {
 		c.root = prefix
 	}
 }
 
+// WithAccessLog writes an entry for each request served by the Proxy, including
+// requests no route matched, to w in the given format. The format defaults to
+// CommonLogFormat.
+func WithAccessLog(w io.Writer, format AccessLogFormat) MountOption {
+	return func(c *mountConfig) {
+		c.accessLog = newAccessLog(w, format)
+	}
+}
+
+// WithUpstreamAccessLog writes entries for requests routed to an Upstream to w
+// in the given format, instead of the log given to WithAccessLog.
+func WithUpstreamAccessLog(upstream string, w io.Writer, format AccessLogFormat) MountOption {
+	return func(c *mountConfig) {
+		c.upstreamAccessLogs[upstream] = newAccessLog(w, format)
+	}
+}
+
 // WithErrorLog specifies an error logger to use when reporting upstream
 // communication errors instead of the log package's default logger.
+// WithErrorLogger, where it's available, logs them with structured fields
+// instead.
 func WithErrorLog(l *log.Logger) MountOption {
 	return func(c *mountConfig) {
 		c.errorLog = l
@@ -61,6 +117,15 @@ func WithBufferPool(p BufferPool) MountOption {
 	}
 }
 
+// WithUpstreamBufferPool specifies a BufferPool for a single Upstream, in place
+// of the one given to WithBufferPool. This lets Upstreams that stream large
+// responses use larger buffers than the rest.
+func WithUpstreamBufferPool(upstream string, p BufferPool) MountOption {
+	return func(c *mountConfig) {
+		c.bufferPools[upstream] = p
+	}
+}
+
 // ResponseModifier is a function that modifies upstream responses before as
 // they are returned to the client.
 type ResponseModifier func(*http.Response) error
@@ -74,6 +139,404 @@ func WithResponseModifier(fn ResponseModifier) MountOption {
 	}
 }
 
+// ResponsePipeline is a sequence of ResponseModifiers applied in order.
+type ResponsePipeline []ResponseModifier
+
+// ModifyResponse applies each ResponseModifier in turn. It stops at the first
+// one to return an error, and returns that error.
+func (p ResponsePipeline) ModifyResponse(resp *http.Response) error {
+	for _, fn := range p {
+		if err := fn(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithUpstreamResponseModifier specifies ResponseModifiers to apply, in order,
+// to responses from a single Upstream. They're applied after the one from
+// WithResponseModifier. The option can be given more than once; its modifiers
+// are appended to the Upstream's ResponsePipeline. An error from any of them
+// stops the pipeline and is passed to the ErrorHandler.
+func WithUpstreamResponseModifier(upstream string, fns ...ResponseModifier) MountOption {
+	return func(c *mountConfig) {
+		c.responseMods[upstream] = append(c.responseMods[upstream], fns...)
+	}
+}
+
+// WithRewriteRedirects rewrites the Location header of upstream responses that
+// refer to the upstream's own destination so that they point back through the
+// Proxy. Both absolute Locations on the destination's host and relative ones
+// are rewritten to include the route's prefix; query strings are preserved.
+// The rewrite happens before any ResponseModifier is applied.
+func WithRewriteRedirects() MountOption {
+	return func(c *mountConfig) {
+		c.rewriteRedirects = true
+	}
+}
+
+// WithUpstreamFollowRedirects has the Proxy follow redirects from an
+// Upstream's destinations itself, and respond with the final response. By
+// default, redirects are passed through to the client unchanged (see
+// WithRewriteRedirects). Redirects are followed up to the limit given to
+// WithMaxUpstreamRedirects.
+func WithUpstreamFollowRedirects(upstream string) MountOption {
+	return func(c *mountConfig) {
+		c.followRedirects[upstream] = true
+	}
+}
+
+// WithMaxUpstreamRedirects caps the number of redirects followed for Upstreams
+// set up with WithUpstreamFollowRedirects, to avoid redirect loops. Requests
+// that are redirected more often are handed to the ErrorHandler with
+// ErrTooManyRedirects or, if there isn't one, answered with 502 Bad Gateway.
+// It defaults to DefaultMaxUpstreamRedirects.
+func WithMaxUpstreamRedirects(n int) MountOption {
+	return func(c *mountConfig) {
+		c.maxRedirects = n
+	}
+}
+
+// WithRetries retries requests that fail to reach an upstream, up to max times.
+// Only requests with idempotent methods and no body are retried, since others
+// can't be safely replayed, unless their bodies are buffered with
+// WithBufferRequestBody.
+func WithRetries(max int) MountOption {
+	return func(c *mountConfig) {
+		c.retries = max
+	}
+}
+
+// WithBufferRequestBody reads request bodies of up to max bytes before they're
+// proxied, so they can be replayed by WithRetries and WithUpstreamFallback
+// whatever the request's method. Bodies over 1 MiB are buffered in a temporary
+// file rather than in memory. Larger bodies are streamed and aren't replayed.
+func WithBufferRequestBody(max int64) MountOption {
+	return func(c *mountConfig) {
+		c.bufferBodyMax = max
+	}
+}
+
+// WithRetryBackoff specifies how long to wait before each of the retries enabled
+// by WithRetries. Without it, retries are sent immediately. ConstantBackoff,
+// ExponentialBackoff and ExponentialJitterBackoff are provided.
+func WithRetryBackoff(strategy BackoffStrategy) MountOption {
+	return func(c *mountConfig) {
+		c.retryBackoff = strategy
+	}
+}
+
+// WithRetryBudget limits the retries enabled by WithRetries to a ratio of the
+// original requests sent to each Upstream over a sliding ten second window.
+// This keeps a widespread failure from turning into a storm of retries. The
+// budget isn't enforced until the window holds at least minRequests original
+// requests. Use Proxy.RetryBudget to see whether retries are being throttled.
+func WithRetryBudget(ratio float64, minRequests int) MountOption {
+	return func(c *mountConfig) {
+		c.retryBudget = &retryBudgetConfig{ratio: ratio, minRequests: minRequests}
+	}
+}
+
+// WithUpstreamBalancer chooses between the destinations of an Upstream with
+// destination blocks using the Balancer, instead of at random in proportion to
+// their weights. Destinations with no weight, including those removed with
+// SetSplit, aren't offered to the Balancer. RoundRobinBalancer, RandomBalancer
+// and LeastConnBalancer are provided.
+func WithUpstreamBalancer(upstream string, b Balancer) MountOption {
+	return func(c *mountConfig) {
+		c.balancers[upstream] = b
+	}
+}
+
+// WithStickySessions routes each client of an Upstream with destination blocks
+// to the same destination for as long as that destination receives traffic and
+// is healthy. With a cookie, new clients, and those whose destination has been
+// given no weight or reported unhealthy, are assigned a destination by the
+// Upstream's Balancer, or in turn if it has none. With the client's IP, the
+// destination is chosen in proportion to the weights.
+func WithStickySessions(upstream string, s StickySessions) MountOption {
+	return func(c *mountConfig) {
+		c.sticky[upstream] = s
+	}
+}
+
+// WithRequestID makes sure every request carries an ID in the header, which
+// defaults to DefaultRequestIDHeader if empty. The client's ID is used if it
+// sent one; otherwise a UUID is generated. The ID is sent upstream, echoed on
+// the response and available to ObserveFunctions and middleware through
+// RequestIDFromContext.
+func WithRequestID(header string) MountOption {
+	return func(c *mountConfig) {
+		if header == "" {
+			header = DefaultRequestIDHeader
+		}
+		c.requestIDHeader = header
+	}
+}
+
+// WithMaintenanceContentType specifies the Content-Type of the responses served
+// in maintenance mode (see Proxy.SetMaintenance). It defaults to
+// DefaultMaintenanceContentType.
+func WithMaintenanceContentType(contentType string) MountOption {
+	return func(c *mountConfig) {
+		c.maintenanceType = contentType
+	}
+}
+
+// WithCollapseSlashes replaces runs of slashes in the paths of requests sent
+// upstream, once prefixes are stripped and destination paths joined, with a
+// single slash. The query string is left alone. Unlike a path normalizer such
+// as passutil.CollapseSlashes, it doesn't affect routing.
+func WithCollapseSlashes() MountOption {
+	return func(c *mountConfig) {
+		c.collapseSlashes = true
+	}
+}
+
+// WithMethodOverride routes POST requests as the method in the header, such as
+// "X-HTTP-Method-Override", for clients that can only send GET and POST. Only
+// PUT, PATCH and DELETE can be given; other values, and the header on requests
+// other than POST, are ignored. The request is sent upstream with the
+// overriding method and without the header. It's applied before the rewrite
+// from WithPreRouteRewrite.
+func WithMethodOverride(header string) MountOption {
+	return func(c *mountConfig) {
+		c.methodOverride = header
+	}
+}
+
+// WithPreRouteRewrite specifies a function that can change requests, such as
+// their URL's path, before they're routed. It's called on a copy of each
+// request, first thing in ServeHTTP (and Match). Requests then pass through the
+// path normalizers and routing, then middleware, and finally the
+// RequestModifier and directors as they're proxied. The rewritten request is
+// the one sent upstream.
+func WithPreRouteRewrite(fn func(*http.Request)) MountOption {
+	return func(c *mountConfig) {
+		c.preRoute = fn
+	}
+}
+
+// WithPathNormalizer specifies a function to normalize the path of incoming
+// requests before they're routed. The normalized path is also the one sent
+// upstream. The option can be given more than once; normalizers are applied in
+// order. See package passutil for some ready-made normalizers.
+func WithPathNormalizer(fn func(string) string) MountOption {
+	return func(c *mountConfig) {
+		c.pathNormalizers = append(c.pathNormalizers, fn)
+	}
+}
+
+// WithImplicitHead registers HEAD for every route that declares GET but not
+// HEAD, so HEAD requests work wherever GET requests do.
+func WithImplicitHead() MountOption {
+	return func(c *mountConfig) {
+		c.implicitHead = true
+	}
+}
+
+// WithAutoOptions answers OPTIONS requests that no route declares with 204 No
+// Content and an Allow header listing the methods routes accept for the
+// request's path. Paths no route matches are handed to the not-found handler
+// as usual. Routes of Upstreams given to WithUpstreamCORS answer OPTIONS
+// requests themselves.
+func WithAutoOptions() MountOption {
+	return func(c *mountConfig) {
+		c.autoOptions = true
+	}
+}
+
+// WithRequestCoalescing shares one upstream request between concurrent,
+// identical GET requests to an Upstream, so a burst of requests for the same
+// resource reaches it once. Requests are identical when their host, URL and
+// Accept, Accept-Encoding and Accept-Language headers match. Requests with
+// Authorization or Cookie headers, or that ask for a fresh response with
+// Cache-Control or Pragma no-cache, aren't coalesced. Shared responses are
+// buffered in full before they're written to each client, and only the client
+// whose request was sent upstream is given its Set-Cookie headers. A client
+// that goes away doesn't cancel the upstream request while others wait on it.
+func WithRequestCoalescing(upstream string) MountOption {
+	return func(c *mountConfig) {
+		c.coalesce[upstream] = true
+	}
+}
+
+// WithNoHealthyDestinations specifies how requests routed to an Upstream that
+// isn't healthy are handled. Destinations reported unhealthy are passed over
+// while any other destination can take the request; the mode only applies
+// once none can, or the Upstream as a whole is reported unhealthy. By default
+// such requests are answered with 503 Service Unavailable, passing
+// ErrNoHealthyDestinations to the ErrorHandler. NoHealthyServeStale proxies
+// them to the Upstream's destinations anyway, and NoHealthyFallbackUpstream
+// serves them from the fallback given to WithUpstreamFallback, where the
+// request is eligible for it.
+func WithNoHealthyDestinations(mode NoHealthyDestinationsMode) MountOption {
+	return func(c *mountConfig) {
+		c.noHealthy = mode
+	}
+}
+
+// WithUpstreamFallback sends requests that the primary Upstream fails to serve,
+// whether because it can't be reached or because it responds with a 5xx
+// status, to one of the fallback Upstream's destinations instead. Only requests
+// with idempotent methods and no body, or with a body buffered by
+// WithBufferRequestBody, are sent to the fallback. Once the
+// fallback is used, RouteInfo.ServedBy holds its identifier and the Upstream*
+// fields describe its destination.
+func WithUpstreamFallback(primary, fallback string) MountOption {
+	return func(c *mountConfig) {
+		c.fallbacks[primary] = fallback
+	}
+}
+
+// WithShadow mirrors a fraction, between 0 and 1, of the requests routed to an
+// Upstream to a shadow Upstream, such as a new version being tested with
+// production traffic. Requests are replayed in the background, so the shadow
+// can't slow down or affect the response to the client, and the shadow's
+// responses are discarded. So are its errors: they aren't given to the
+// ErrorHandler, Metrics or error log, though a structured logger from
+// WithErrorLogger gets them at debug level. Request bodies are buffered to be replayed; requests
+// with bodies larger than the limit given to WithShadowMaxBodySize aren't
+// mirrored. Replayed requests are given the deadline from WithShadowTimeout,
+// and those beyond the limit from WithMaxShadowRequests are dropped, so a slow
+// shadow can't pile up work in the Proxy.
+func WithShadow(identifier, shadowIdentifier string, fraction float64) MountOption {
+	return func(c *mountConfig) {
+		c.shadows[identifier] = shadow{identifier: shadowIdentifier, fraction: fraction}
+	}
+}
+
+// WithShadowMaxBodySize specifies the largest request body, in bytes, that's
+// buffered to be mirrored by WithShadow. It defaults to
+// DefaultShadowMaxBodySize.
+func WithShadowMaxBodySize(n int64) MountOption {
+	return func(c *mountConfig) {
+		c.shadowMaxBody = n
+	}
+}
+
+// WithShadowTimeout specifies the deadline for requests replayed to a shadow
+// Upstream by WithShadow. It defaults to DefaultShadowTimeout.
+func WithShadowTimeout(d time.Duration) MountOption {
+	return func(c *mountConfig) {
+		c.shadowTimeout = d
+	}
+}
+
+// WithMaxShadowRequests specifies how many requests can be replayed to each
+// shadow Upstream by WithShadow at once. Requests that would be replayed
+// beyond the limit are dropped rather than queued. It defaults to
+// DefaultMaxShadowRequests.
+func WithMaxShadowRequests(n int) MountOption {
+	return func(c *mountConfig) {
+		c.shadowMax = n
+	}
+}
+
+// WithUpstreamBodyTransformer specifies a BodyTransformer that rewrites the
+// bodies of an Upstream's responses. Responses are buffered in full to be
+// transformed, so streamed responses, from Upstreams or routes with a flush
+// interval, are passed through untouched, as are encoded (e.g. gzipped) bodies
+// and bodies larger than the size given to WithBodyTransformMaxSize.
+func WithUpstreamBodyTransformer(upstream string, fn BodyTransformer) MountOption {
+	return func(c *mountConfig) {
+		c.bodyTransformers[upstream] = fn
+	}
+}
+
+// WithBodyTransformMaxSize specifies the largest response body, in bytes, that's
+// buffered to be transformed by WithUpstreamBodyTransformer. It defaults to
+// DefaultBodyTransformMaxSize.
+func WithBodyTransformMaxSize(n int64) MountOption {
+	return func(c *mountConfig) {
+		c.bodyTransformMax = n
+	}
+}
+
+// WithDestinationResolver specifies a DestinationResolver that resolves the
+// destination of each Upstream when requests are proxied, in place of its
+// destination attribute, so destinations found by service discovery can change
+// without reloading the Manifest. The resolver is given the Upstream, whose
+// destination attribute can name the service to look up. Upstreams with
+// destination blocks aren't resolved. A resolved destination is used for the TTL given to
+// WithDestinationResolverTTL, after which the next request resolves it again
+// while other requests keep using it. If that fails, the stale destination is
+// used for another TTL and the error is logged. If there's no destination to
+// fall back on, as for the first requests, the ErrorHandler is given an error
+// wrapping ErrDestinationResolution; without one, the request is answered with
+// 502 Bad Gateway.
+func WithDestinationResolver(fn DestinationResolver) MountOption {
+	return func(c *mountConfig) {
+		c.resolver = fn
+	}
+}
+
+// WithDestinationResolverTTL specifies how long a destination returned by the
+// DestinationResolver is used for. A TTL of zero resolves the destination for
+// every request, except those that arrive while it's already being resolved.
+// It defaults to DefaultDestinationResolverTTL.
+func WithDestinationResolverTTL(ttl time.Duration) MountOption {
+	return func(c *mountConfig) {
+		c.resolverTTL = ttl
+	}
+}
+
+// WithMiddleware registers a middleware stack applied to the routes of every
+// Upstream. Unlike wrapping the Proxy, it only runs once a route has matched.
+// Middlewares are applied in-order.
+func WithMiddleware(m ...func(http.Handler) http.Handler) MountOption {
+	return func(c *mountConfig) {
+		c.middleware = append(c.middleware, m...)
+	}
+}
+
+// WithAnnotationMiddleware registers middleware for the routes of every
+// Upstream with the annotation key. The function is called with the
+// annotation's value for each such Upstream to create its middleware.
+func WithAnnotationMiddleware(key string, fn func(value string) func(http.Handler) http.Handler) MountOption {
+	return func(c *mountConfig) {
+		c.annotationMws = append(c.annotationMws, annotationMiddleware{key, fn})
+	}
+}
+
+// WithPrefixRedirect redirects requests that don't match a route, but would if
+// their path had the prefix of the routes (from the root, and the Manifest's
+// and Upstream's prefix_path), to the prefixed path. GET and HEAD requests are
+// redirected with 301 Moved Permanently and others with 308 Permanent Redirect,
+// so they're resent with the same method and body. Paths that wouldn't match
+// under any prefix are still not found.
+func WithPrefixRedirect() MountOption {
+	return func(c *mountConfig) {
+		c.prefixRedirect = true
+	}
+}
+
+// WithStreamingUploads guarantees that request bodies are streamed to
+// upstreams as they arrive, and never read into memory or onto disk first, such
+// as for large uploads. It overrides WithBufferRequestBody, and requests with
+// bodies aren't mirrored by WithShadow. Like any request without a buffered
+// body, requests with bodies aren't retried and don't fall back.
+func WithStreamingUploads() MountOption {
+	return func(c *mountConfig) {
+		c.streamUploads = true
+	}
+}
+
+// WithRejectGetBody responds with 400 Bad Request, before proxying, to requests
+// that have a body but whose method shouldn't, passing ErrUnexpectedBody to the
+// ErrorHandler. The methods default to GET, HEAD and DELETE.
+func WithRejectGetBody(methods ...string) MountOption {
+	return func(c *mountConfig) {
+		if len(methods) == 0 {
+			methods = defaultBodilessMethods
+		}
+		c.bodilessMethods = map[string]bool{}
+		for _, m := range methods {
+			c.bodilessMethods[strings.ToUpper(m)] = true
+		}
+	}
+}
+
 // WithUpstreamMiddleware registers a middleware stack for an upstream identifier (from
 // the Manifest). When the Upstream's routes are registered these middleware
 // will be applied along with them. Middlewares are applied in-order.
@@ -83,6 +546,27 @@ func WithUpstreamMiddleware(upstream string, m ...func(http.Handler) http.Handle
 	}
 }
 
+// WithRouteMiddleware registers a middleware stack for the routes of an
+// Upstream with the given path, as written in the Manifest, whatever their
+// methods. Middlewares are applied in-order.
+func WithRouteMiddleware(upstream, path string, m ...func(http.Handler) http.Handler) MountOption {
+	return func(c *mountConfig) {
+		c.routeMiddleware = append(c.routeMiddleware, routeMiddleware{upstream, path, m})
+	}
+}
+
+// WithMiddlewareOrder changes the order the layers of middleware registered with
+// WithMiddleware, WithAnnotationMiddleware, WithUpstreamMiddleware and
+// WithRouteMiddleware are applied in, from outermost to innermost. The order
+// must name each MiddlewareLayer once. It defaults to DefaultMiddlewareOrder:
+// global, annotation, upstream, then route. Every layer runs after the Proxy's
+// own recovery, header limits, CORS and basic authentication.
+func WithMiddlewareOrder(order []MiddlewareLayer) MountOption {
+	return func(c *mountConfig) {
+		c.middlewareOrder = order
+	}
+}
+
 // ErrorHandler is a function that handles errors on behalf of the proxy. Errors
 // returned from ResponseModifier functions will also be handled by this
 // function.
@@ -96,17 +580,152 @@ func WithErrorHandler(fn ErrorHandler) MountOption {
 	}
 }
 
+// WithRequiredHeaderStatus specifies the status of responses to requests
+// missing a header in their route's require_headers. It defaults to 400 Bad
+// Request. An ErrorHandler is given ErrMissingRequiredHeader instead.
+func WithRequiredHeaderStatus(status int) MountOption {
+	return func(c *mountConfig) {
+		c.requireStatus = status
+	}
+}
+
+// WithRequestTimeoutHeader sets a deadline on requests from the number of
+// milliseconds in their header, such as "X-Timeout-Ms", up to the maximum given
+// to WithMaxRequestTimeoutHeader. Requests that the upstream doesn't answer in
+// time are answered as for timeout_ms. The header can only shorten a route's
+// timeout_ms, not extend it. Requests without the header, or with a value
+// that isn't a positive number, only have the route's timeout_ms.
+func WithRequestTimeoutHeader(name string) MountOption {
+	return func(c *mountConfig) {
+		c.timeoutHeader = name
+	}
+}
+
+// WithMaxRequestTimeoutHeader caps the deadline set from the header given to
+// WithRequestTimeoutHeader. Larger values are clamped to it. It defaults to
+// DefaultMaxRequestTimeoutHeader.
+func WithMaxRequestTimeoutHeader(d time.Duration) MountOption {
+	return func(c *mountConfig) {
+		c.timeoutHeaderMax = d
+	}
+}
+
+// WithMaxHeaderBytes rejects requests whose headers add up to more than n
+// bytes with 431 Request Header Fields Too Large, before they're proxied. It's
+// independent of http.Server's MaxHeaderBytes. Upstreams can set their own
+// limit with the AnnotationMaxHeaderBytes annotation, where zero means no
+// limit.
+func WithMaxHeaderBytes(n int) MountOption {
+	return func(c *mountConfig) {
+		c.maxHeaderBytes = n
+	}
+}
+
+// WithTraceIDFunc specifies how to find the ID of the trace a request is part
+// of, so that Metrics implementing ExemplarMetrics can link latency
+// observations to traces.
+func WithTraceIDFunc(fn TraceIDFunc) MountOption {
+	return func(c *mountConfig) {
+		c.traceID = fn
+	}
+}
+
+// WithClientIPResolver specifies how the IP address of the client that made a
+// request is determined, for RouteInfo.ClientIP and sticky sessions keyed by
+// client IP. It defaults to RemoteAddrClientIP.
+func WithClientIPResolver(fn ClientIPResolver) MountOption {
+	return func(c *mountConfig) {
+		c.clientIP = fn
+	}
+}
+
+// WithReadinessPolicy specifies the ReadinessPolicy used by Ready. It defaults
+// to ReadyWhenAllHealthy.
+func WithReadinessPolicy(policy ReadinessPolicy) MountOption {
+	return func(c *mountConfig) {
+		c.readiness = policy
+	}
+}
+
+// WithRecovery recovers from panics in the middleware and handlers of every
+// route, so a panic fails only its own request. The RecoveryHandler responds to
+// the request; if it's nil, the panic and its stack are logged to the error log
+// and ErrPanic is passed to the ErrorHandler, or a 500 Internal Server Error is
+// sent if there isn't one.
+func WithRecovery(fn RecoveryHandler) MountOption {
+	return func(c *mountConfig) {
+		c.recoverPanics = true
+		c.recovery = fn
+	}
+}
+
+// WithStripRequestHeaders removes headers from every request before it's sent
+// upstream, such as credentials that are only meant for the Proxy. Names are
+// matched case-insensitively. Upstreams can strip additional headers with the
+// strip_request_headers attribute. Headers are stripped before any
+// RequestModifier is applied. Hop-by-hop headers, including those named in the
+// Connection header, are always removed.
+func WithStripRequestHeaders(names ...string) MountOption {
+	return func(c *mountConfig) {
+		c.stripHeaders = append(c.stripHeaders, names...)
+	}
+}
+
 // RequestModifier is a function that modifies a request
 type RequestModifier func(*http.Request)
 
+// WithUpstreamIdentifierHeader sets a header on requests sent upstream to the
+// identifier of the Upstream they were routed to, so upstreams' logs can be
+// correlated with the Proxy's. Requests served by a fallback carry the
+// fallback's identifier. Any value sent by the client is replaced.
+func WithUpstreamIdentifierHeader(name string) MountOption {
+	return func(c *mountConfig) {
+		c.upstreamIDHeader = name
+	}
+}
+
 // WithRequestModifier specifies a RequestModifer to apply to all outgoing
-// requests.
+// requests. It runs after routing and middleware, as the request is prepared
+// for its destination; see WithPreRouteRewrite to change requests before
+// they're routed.
 func WithRequestModifier(fn RequestModifier) MountOption {
 	return func(c *mountConfig) {
 		c.requestModifier = fn
 	}
 }
 
+// WithResponseHeaders sets headers on the responses of every Upstream, such as
+// security headers. An Upstream's response_headers override them. Responses
+// generated by the Proxy itself, such as for errors, aren't affected.
+func WithResponseHeaders(headers map[string]string) MountOption {
+	return func(c *mountConfig) {
+		c.responseHeaders = headers
+	}
+}
+
+// WithUpstreamDirector specifies a RequestModifier to apply to outgoing
+// requests for a single Upstream, for full control over its requests. Outgoing
+// requests are prepared in this order: the standard director rewrites the URL,
+// headers from WithStripRequestHeaders are removed, the Host is set to the
+// destination's, the credentials from the Upstream's auth block are added, the
+// RequestModifier from WithRequestModifier is applied, then the Upstream's
+// director, and finally forwarding headers are removed for WithStripForwardedFor.
+func WithUpstreamDirector(upstream string, fn RequestModifier) MountOption {
+	return func(c *mountConfig) {
+		c.directors[upstream] = fn
+	}
+}
+
+// WithStripForwardedFor keeps the client's address from reaching an Upstream by
+// removing the X-Forwarded-For, X-Real-IP and Forwarded headers from its
+// requests. It's applied after every other change to the request, so no
+// RequestModifier can add them back.
+func WithStripForwardedFor(upstream string) MountOption {
+	return func(c *mountConfig) {
+		c.stripForwarded[upstream] = true
+	}
+}
+
 // WithTransport specifies an http.RoundTripper to use instead of
 // http.DefaultTransport.
 func WithTransport(t http.RoundTripper) MountOption {
@@ -117,13 +736,25 @@ func WithTransport(t http.RoundTripper) MountOption {
 
 // WithNotFound specifies an http.HandlerFunc to use if no routes in the
 // manifest match. Use this for fall-through behavior to delegate to existing
-// (in-process) routes.
+// (in-process) routes. The handler receives the request with its original URL
+// path; the Proxy's root is available from RootFromContext.
 func WithNotFound(h http.HandlerFunc) MountOption {
 	return func(c *mountConfig) {
 		c.notFoundHandler = h
 	}
 }
 
+// WithStaticFallback serves files from fs for GET and HEAD requests that no
+// route matches, such as the assets of a single-page application. Paths that
+// don't name a file are served the index file, such as "index.html", so the
+// application can route them itself. Other requests aren't found. It replaces
+// any handler given to WithNotFound.
+func WithStaticFallback(fs http.FileSystem, index string) MountOption {
+	return func(c *mountConfig) {
+		c.notFoundHandler = staticFallback(fs, index)
+	}
+}
+
 // WithTrailingSlashes forces trailing slashes to be unhandled. By default, the
 // Proxy will strip trailing slashes where appropriate.
 func WithTrailingSlashes() MountOption {
@@ -132,28 +763,190 @@ func WithTrailingSlashes() MountOption {
 	}
 }
 
+// WithUpstreamConcurrencyLimit caps the number of requests that can be in
+// flight to an Upstream at once. By default, requests over the limit are
+// rejected immediately; see WithConcurrencyLimitWait.
+func WithUpstreamConcurrencyLimit(upstream string, max int) MountOption {
+	return func(c *mountConfig) {
+		c.concurrencyLimits[upstream] = max
+	}
+}
+
+// WithConcurrencyLimitWait specifies how long a request over an Upstream's
+// concurrency limit waits for another request to finish before it's rejected.
+// Requests are rejected immediately if this is zero.
+func WithConcurrencyLimitWait(d time.Duration) MountOption {
+	return func(c *mountConfig) {
+		c.concurrencyWait = d
+	}
+}
+
+// WithUpstreamBasicAuth protects an Upstream with HTTP Basic Authentication.
+// Requests without credentials, or with credentials that validate rejects, are
+// answered with 401 Unauthorized. The check runs before any middleware
+// registered with WithUpstreamMiddleware.
+func WithUpstreamBasicAuth(upstream, realm string, validate func(user, pass string) bool) MountOption {
+	return func(c *mountConfig) {
+		c.basicAuth[upstream] = basicAuth{realm: realm, validate: validate}
+	}
+}
+
+// WithUpstreamCORS applies Cross-Origin Resource Sharing configuration to an
+// Upstream. Preflight requests are answered by the Proxy rather than being
+// proxied, and the Access-Control-* headers are added to actual responses. The
+// check runs before basic authentication and middleware, since preflight
+// requests don't carry credentials.
+func WithUpstreamCORS(upstream string, cfg CORSConfig) MountOption {
+	return func(c *mountConfig) {
+		c.cors[upstream] = cfg
+	}
+}
+
+// WithGatewayErrorResponse specifies the response sent when an upstream can't
+// be reached, or fails to answer in time, in place of an empty 502 Bad Gateway
+// or 504 Gateway Timeout. A status of zero keeps the default status code. An
+// ErrorHandler given to WithErrorHandler takes precedence over this.
+func WithGatewayErrorResponse(status int, body []byte, contentType string) MountOption {
+	return func(c *mountConfig) {
+		c.gatewayError = &errorResponse{status: status, body: body, contentType: contentType}
+	}
+}
+
 // mountConfig contains realized configuration for mounting routes.
 type mountConfig struct {
 	// Pass configuration
 	observe             ObserveFunction
+	enricher            RequestEnricher
+	metrics             Metrics
 	root                string
 	upstreamMiddleware  map[string][]func(http.Handler) http.Handler
+	middleware          []func(http.Handler) http.Handler
+	annotationMws       []annotationMiddleware
+	routeMiddleware     []routeMiddleware
+	middlewareOrder     []MiddlewareLayer
 	keepTrailingSlashes bool
+	implicitHead        bool
+	autoOptions         bool
+	pathNormalizers     []func(string) string
+	preRoute            func(*http.Request)
+	methodOverride      string
+	collapseSlashes     bool
+	bufferPools         map[string]BufferPool // Per-Upstream overrides of bufferPool
+	fallbacks           map[string]string
+	noHealthy           NoHealthyDestinationsMode
+	coalesce            map[string]bool
+	shadows             map[string]shadow
+	shadowMaxBody       int64
+	shadowTimeout       time.Duration
+	shadowMax           int
 	notFoundHandler     http.HandlerFunc
+	concurrencyLimits   map[string]int
+	concurrencyWait     time.Duration
+	basicAuth           map[string]basicAuth
+	cors                map[string]CORSConfig
+	sticky              map[string]StickySessions
+	balancers           map[string]Balancer
+	requestIDHeader     string
+	upstreamIDHeader    string
+	maintenanceType     string
+	gatewayError        *errorResponse
+	stripHeaders        []string
+	directors           map[string]RequestModifier
+	responseMods        map[string]ResponsePipeline
+	stripForwarded      map[string]bool
+	bodyTransformers    map[string]BodyTransformer
+	bodyTransformMax    int64
+	recoverPanics       bool
+	recovery            RecoveryHandler
+	maxHeaderBytes      int
+	timeoutHeader       string
+	timeoutHeaderMax    time.Duration
+	requireStatus       int
+	readiness           ReadinessPolicy
+	clientIP            ClientIPResolver
+	traceID             TraceIDFunc
+	responseHeaders     map[string]string
+	resolver            DestinationResolver
+	resolverTTL         time.Duration
+	rewriteRedirects    bool
+	followRedirects     map[string]bool
+	maxRedirects        int
+	retries             int
+	bufferBodyMax       int64
+	streamUploads       bool
+	prefixRedirect      bool
+	accessLog           *accessLog
+	upstreamAccessLogs  map[string]*accessLog
+	bodilessMethods     map[string]bool
+	retryBudget         *retryBudgetConfig
+	retryBackoff        BackoffStrategy
 
 	// httputil.ReverseProxy configuration
 	bufferPool       httputil.BufferPool
 	errorHandler     ErrorHandler
 	errorLog         *log.Logger
+	errorLogger      errorLogger
 	requestModifier  RequestModifier
 	responseModifier ResponseModifier
 	transport        http.RoundTripper
 }
 
+// retryBudgetConfig is the configuration given to WithRetryBudget.
+type retryBudgetConfig struct {
+	ratio       float64
+	minRequests int
+}
+
+// errorResponse is the configuration given to WithGatewayErrorResponse.
+type errorResponse struct {
+	status      int
+	body        []byte
+	contentType string
+}
+
+// write sends the response, using status if none was configured.
+func (e *errorResponse) write(w http.ResponseWriter, status int) {
+	if e.status != 0 {
+		status = e.status
+	}
+	if e.contentType != "" {
+		w.Header().Set("Content-Type", e.contentType)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(e.body)))
+	w.WriteHeader(status)
+	w.Write(e.body)
+}
+
 // newMountConfig creates a mountConfig with established defaults.
 func newMountConfig() mountConfig {
 	return mountConfig{
 		errorLog:           log.New(io.Discard, "", log.LstdFlags),
 		upstreamMiddleware: map[string][]func(http.Handler) http.Handler{},
+		middlewareOrder:    DefaultMiddlewareOrder,
+		concurrencyLimits:  map[string]int{},
+		basicAuth:          map[string]basicAuth{},
+		cors:               map[string]CORSConfig{},
+		sticky:             map[string]StickySessions{},
+		balancers:          map[string]Balancer{},
+		upstreamAccessLogs: map[string]*accessLog{},
+		followRedirects:    map[string]bool{},
+		coalesce:           map[string]bool{},
+		maxRedirects:       DefaultMaxUpstreamRedirects,
+		requireStatus:      http.StatusBadRequest,
+		timeoutHeaderMax:   DefaultMaxRequestTimeoutHeader,
+		bufferPools:        map[string]BufferPool{},
+		fallbacks:          map[string]string{},
+		shadows:            map[string]shadow{},
+		directors:          map[string]RequestModifier{},
+		responseMods:       map[string]ResponsePipeline{},
+		stripForwarded:     map[string]bool{},
+		bodyTransformers:   map[string]BodyTransformer{},
+		bodyTransformMax:   DefaultBodyTransformMaxSize,
+		shadowMaxBody:      DefaultShadowMaxBodySize,
+		shadowTimeout:      DefaultShadowTimeout,
+		shadowMax:          DefaultMaxShadowRequests,
+		resolverTTL:        DefaultDestinationResolverTTL,
+		maintenanceType:    DefaultMaintenanceContentType,
+		clientIP:           RemoteAddrClientIP,
 	}
 }
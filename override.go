@@ -0,0 +1,29 @@
+package pass
+
+import (
+	"net/http"
+	"strings"
+)
+
+// overridableMethods are the methods a POST request can be routed as with
+// WithMethodOverride. They all carry a body, as the POST may, and none are
+// safe methods that could be cached or retried as if the request were a read.
+var overridableMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// overrideMethod returns the method a request should be routed as according to
+// its override header, or the empty string if it shouldn't be overridden.
+// Only POST requests are overridden, and only to one of overridableMethods.
+func overrideMethod(r *http.Request, header string) string {
+	if r.Method != http.MethodPost {
+		return ""
+	}
+	m := strings.TrimSpace(r.Header.Get(header))
+	if !overridableMethods[m] {
+		return ""
+	}
+	return m
+}
@@ -0,0 +1,83 @@
+package pass
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestMethodOverride(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Override", r.Header.Get("X-HTTP-Method-Override"))
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/method_override.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithMethodOverride("X-HTTP-Method-Override"))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		override string
+		status   int
+		upstream string
+	}{
+		{"override", http.MethodPost, "/widgets/1", "DELETE", http.StatusOK, http.MethodDelete},
+		{"no override", http.MethodPost, "/widgets", "", http.StatusOK, http.MethodPost},
+		{"override on get", http.MethodGet, "/widgets/1", "DELETE", http.StatusOK, http.MethodGet},
+		{"unknown method", http.MethodPost, "/widgets/1", "BREW", http.StatusMethodNotAllowed, ""},
+		{"unsafe method", http.MethodPost, "/widgets/1", "GET", http.StatusMethodNotAllowed, ""},
+		{"lowercase method", http.MethodPost, "/widgets/1", "delete", http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, nil)
+			require.NoError(t, err)
+			if tt.override != "" {
+				req.Header.Set("X-HTTP-Method-Override", tt.override)
+			}
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+			require.Equal(t, tt.upstream, resp.Header.Get("X-Method"))
+			if tt.upstream == http.MethodDelete {
+				require.Empty(t, resp.Header.Get("X-Override"))
+			}
+		})
+	}
+
+	t.Run("match", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/widgets/1", nil)
+		req.Header.Set("X-HTTP-Method-Override", "DELETE")
+		match, ok := proxy.Match(req)
+		require.True(t, ok)
+		require.Equal(t, http.MethodDelete, match.Method)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/widgets/1", nil)
+		req.Header.Set("X-HTTP-Method-Override", "DELETE")
+		_, ok := proxy.Match(req)
+		require.False(t, ok)
+	})
+}
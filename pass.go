@@ -2,26 +2,143 @@
 package pass
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"golang.org/x/sync/singleflight"
 )
 
 // ErrMissingUpstreamForMiddleware is returned when the Upstream referenced by a
 // middleware stack doesn't exist in the Manifest.
 var ErrMissingUpstreamForMiddleware = fmt.Errorf("upstream missing for middleware stack")
 
+// ErrUpstreamDisabled is passed to the ErrorHandler when a request is routed to
+// an Upstream that has been disabled with Proxy.SetUpstreamEnabled.
+var ErrUpstreamDisabled = fmt.Errorf("upstream disabled")
+
+// ErrClientDisconnected is passed to the ErrorHandler when a client disconnects
+// before its request has been answered. The request to the upstream is
+// canceled when this happens.
+var ErrClientDisconnected = fmt.Errorf("client disconnected")
+
+// DefaultMaxRequestTimeoutHeader is the longest deadline that can be set from
+// the header given to WithRequestTimeoutHeader.
+const DefaultMaxRequestTimeoutHeader = 30 * time.Second
+
+// ErrInvalidRoot is returned when the root given to Proxy.SetRoot doesn't begin
+// with a slash.
+var ErrInvalidRoot = fmt.Errorf("invalid root")
+
 // Proxy is a reverse-proxy.
 type Proxy struct {
-	manifest *Manifest
-	router   chi.Router
-	root     string
+	reloadMu sync.Mutex // Serializes calls to Reload, ReplaceUpstream and SetRoot
+
+	mu      sync.RWMutex
+	routing *routing
+}
+
+// routing is the router and runtime state built from a Manifest. It's replaced
+// wholesale when the Proxy is reloaded.
+type routing struct {
+	cfg       mountConfig // Options the routing was built with
+	manifest  *Manifest
+	router    chi.Router
+	root      string
+	pickers   map[string]picker
+	splits    map[string]*split
+	upstreams map[string]*upstreamState
+
+	// Each Upstream's destinations, unless they're found by the
+	// DestinationResolver, so they can be health checked.
+	destinations map[string][]*destinationProxy
+
+	// Routes registered with the router, keyed by method and pattern. Several
+	// routes can share a method and pattern when they have match conditions.
+	candidates map[string][]candidate
+	notFound   http.Handler
+
+	// Prefixes unprefixed requests are redirected to, longest first, if
+	// WithPrefixRedirect is enabled.
+	redirectPrefixes []string
+
+	// Whether OPTIONS requests no route declares are answered with the
+	// methods routes accept for the path, if WithAutoOptions is enabled.
+	autoOptions bool
+
+	maintenance *maintenance    // Proxy-wide maintenance mode; carried over on reload
+	readiness   ReadinessPolicy // Decides whether the Proxy is Ready
+}
+
+// upstreamState is runtime state for an Upstream. It's carried over when the
+// Proxy is reloaded with a Manifest containing the same Upstream identifier.
+type upstreamState struct {
+	inFlight  int64         // Accessed atomically; first for 64-bit alignment
+	disabled  int32         // Accessed atomically
+	unhealthy int32         // Accessed atomically
+	sem       chan struct{} // Concurrency limiting semaphore, if limited
+	shadows   chan struct{} // Replays in flight to the Upstream as a shadow
+
+	retryBudget *retryBudget // Limits retries, if budgeted
+	maintenance maintenance
+	health      destinationHealth  // Destinations reported unhealthy
+	admit       sync.RWMutex       // Held for writing while a drain begins
+	requests    inFlightRequests   // Canceled by Proxy.DrainUpstream
+	flights     singleflight.Group // Coalesced requests, if enabled
+}
+
+func newUpstreamState(identifier string, cfg mountConfig) *upstreamState {
+	s := &upstreamState{}
+	if max, ok := cfg.concurrencyLimits[identifier]; ok {
+		s.sem = make(chan struct{}, max)
+	}
+	if b := cfg.retryBudget; b != nil {
+		s.retryBudget = newRetryBudget(b.ratio, b.minRequests)
+	}
+	for _, sh := range cfg.shadows {
+		if sh.identifier == identifier {
+			s.shadows = make(chan struct{}, cfg.shadowMax)
+			break
+		}
+	}
+	return s
+}
+
+func (s *upstreamState) enabled() bool {
+	return atomic.LoadInt32(&s.disabled) == 0
+}
+
+// track counts fn as serving a request in flight while it runs. fn is given a
+// copy of the request that's canceled if the Upstream is drained. It reports
+// false, without calling fn, if the Upstream is disabled. The check and the
+// request being counted happen together, under admit, so that
+// Proxy.DrainUpstream can't miss a request that's been let through.
+func (s *upstreamState) track(r *http.Request, fn func(*http.Request)) bool {
+	s.admit.RLock()
+	if !s.enabled() {
+		s.admit.RUnlock()
+		return false
+	}
+	atomic.AddInt64(&s.inFlight, 1)
+	r, done := s.requests.add(r)
+	s.admit.RUnlock()
+
+	defer atomic.AddInt64(&s.inFlight, -1)
+	defer done()
+	fn(r)
+	return true
 }
 
 // New creates a new Proxy with the Manifest's routes mounted to it.
@@ -31,148 +148,1180 @@ func New(m *Manifest, opts ...MountOption) (*Proxy, error) {
 		o(&cfg)
 	}
 
+	if cfg.root != "" && !strings.HasPrefix(cfg.root, "/") {
+		cfg.root = "/" + cfg.root
+	}
+	rt, err := newRouting(m, cfg, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{routing: rt}, nil
+}
+
+// Reload replaces the Proxy's routes with those of another Manifest. The
+// options provided when the Proxy was created are applied to the new routes.
+// Runtime state, such as whether an Upstream is enabled, is kept for Upstreams
+// whose identifiers exist in both Manifests; destination weights are taken
+// from the new Manifest. Requests that are already in flight are unaffected.
+func (p *Proxy) Reload(m *Manifest) error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	prev := p.current()
+	rt, err := newRouting(m, prev.cfg, prev, nil)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.routing = rt
+	p.mu.Unlock()
+	return nil
+}
+
+// ReplaceUpstream replaces a single Upstream, identified by its identifier,
+// leaving the rest of the Manifest as it is. Only the replaced Upstream's
+// destinations are rebuilt; other Upstreams keep theirs, along with any
+// changes made with SetSplit. Runtime state is kept as it is with Reload.
+//
+// The router itself is rebuilt from every Upstream's routes, since routes of
+// different Upstreams can share a path, so replacing an Upstream costs about
+// as much as a Reload. It's meant for occasional changes, such as from an
+// admin API, rather than for every request. Unlike a Manifest being loaded,
+// the Upstream is rejected with ErrInvalidRoute if any route has no methods.
+func (p *Proxy) ReplaceUpstream(u Upstream) error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	prev := p.current()
+	if _, ok := prev.upstreams[u.Identifier]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownUpstream, u.Identifier)
+	}
+	if err := validateRouteMethods(u); err != nil {
+		return err
+	}
+
+	m := &Manifest{
+		Annotations: prev.manifest.Annotations,
+		PrefixPath:  prev.manifest.PrefixPath,
+	}
+	keep := map[string]bool{}
+	for _, existing := range prev.manifest.Upstreams {
+		if existing.Identifier == u.Identifier {
+			m.Upstreams = append(m.Upstreams, u)
+			continue
+		}
+		m.Upstreams = append(m.Upstreams, existing)
+		keep[existing.Identifier] = true
+	}
+	if err := m.init(); err != nil {
+		return err
+	}
+
+	rt, err := newRouting(m, prev.cfg, prev, keep)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.routing = rt
+	p.mu.Unlock()
+	return nil
+}
+
+// SetRoot changes the root mount point given to WithRoot, rebuilding every
+// route under the new root. Runtime state is kept as it is with Reload.
+// Requests that are already in flight are unaffected.
+func (p *Proxy) SetRoot(prefix string) error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		return fmt.Errorf("%w: %q", ErrInvalidRoot, prefix)
+	}
+
+	prev := p.current()
+	cfg := prev.cfg
+	cfg.root = prefix
+	rt, err := newRouting(prev.manifest, cfg, prev, nil)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.routing = rt
+	p.mu.Unlock()
+	return nil
+}
+
+// current returns the routing currently in use.
+func (p *Proxy) current() *routing {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.routing
+}
+
+// newRouting mounts the Manifest's routes to a new router. Upstream state is
+// reused from prev, if there is one, where the identifiers match. The
+// destinations of Upstreams in keep are reused from prev as well.
+func newRouting(m *Manifest, cfg mountConfig, prev *routing, keep map[string]bool) (*routing, error) {
 	// Verify that the middleware stacks reference real upstreams
 	for k := range cfg.upstreamMiddleware {
 		if _, ok := m.upstreamIndex[k]; !ok {
 			return nil, fmt.Errorf("%w: %q", ErrMissingUpstreamForMiddleware, k)
 		}
 	}
+	for _, rm := range cfg.routeMiddleware {
+		if !hasRoutePath(m, rm.upstream, rm.path) {
+			return nil, fmt.Errorf("%w: %q route %q", ErrMissingUpstreamForMiddleware, rm.upstream, rm.path)
+		}
+	}
+	if err := validateMiddlewareOrder(cfg.middlewareOrder); err != nil {
+		return nil, err
+	}
+	for k := range cfg.coalesce {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	for k := range cfg.followRedirects {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	if cfg.maxRedirects < 0 {
+		return nil, fmt.Errorf("invalid max upstream redirects: %d", cfg.maxRedirects)
+	}
+	for k := range cfg.upstreamAccessLogs {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	for k, max := range cfg.concurrencyLimits {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+		if max < 1 {
+			return nil, fmt.Errorf("invalid concurrency limit for %q: %d", k, max)
+		}
+	}
+	for k := range cfg.basicAuth {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	if b := cfg.retryBudget; b != nil && (b.ratio < 0 || b.minRequests < 0) {
+		return nil, fmt.Errorf("invalid retry budget: ratio %v, min requests %d", b.ratio, b.minRequests)
+	}
+	for k := range cfg.sticky {
+		u, ok := m.upstreamIndex[k]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+		if len(u.Destinations) == 0 {
+			return nil, fmt.Errorf("%w: upstream %q has no destination blocks", ErrUnknownDestination, k)
+		}
+	}
+	for k := range cfg.balancers {
+		u, ok := m.upstreamIndex[k]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+		if len(u.Destinations) == 0 {
+			return nil, fmt.Errorf("%w: upstream %q has no destination blocks", ErrUnknownDestination, k)
+		}
+	}
+	for k := range cfg.directors {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	for k := range cfg.responseMods {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	for k := range cfg.stripForwarded {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	for _, k := range cfg.readiness.critical {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	for k := range cfg.bodyTransformers {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	for k := range cfg.bufferPools {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+	}
+	for primary, fallback := range cfg.fallbacks {
+		for _, k := range []string{primary, fallback} {
+			if _, ok := m.upstreamIndex[k]; !ok {
+				return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+			}
+		}
+		if primary == fallback {
+			return nil, fmt.Errorf("upstream %q can't fall back to itself", primary)
+		}
+		if m.upstreamIndex[fallback].Redirect != nil {
+			return nil, fmt.Errorf("%w: upstream %q is a redirect", ErrMissingDestination, fallback)
+		}
+	}
+	for k, s := range cfg.shadows {
+		for _, id := range []string{k, s.identifier} {
+			if _, ok := m.upstreamIndex[id]; !ok {
+				return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, id)
+			}
+		}
+		if k == s.identifier {
+			return nil, fmt.Errorf("upstream %q can't shadow itself", k)
+		}
+		if m.upstreamIndex[s.identifier].Redirect != nil {
+			return nil, fmt.Errorf("%w: upstream %q is a redirect", ErrMissingDestination, s.identifier)
+		}
+		if s.fraction < 0 || s.fraction > 1 {
+			return nil, fmt.Errorf("invalid shadow fraction for %q: %v", k, s.fraction)
+		}
+	}
+	if len(cfg.shadows) > 0 && (cfg.shadowTimeout <= 0 || cfg.shadowMax < 1) {
+		return nil, fmt.Errorf("invalid shadow limits: timeout %v, max requests %d", cfg.shadowTimeout, cfg.shadowMax)
+	}
+	for k, c := range cfg.cors {
+		if _, ok := m.upstreamIndex[k]; !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, k)
+		}
+		for _, method := range c.AllowedMethods {
+			if !IsValidMethod(method) {
+				return nil, fmt.Errorf("%w: %q in CORS configuration for %q", ErrInvalidMethod, method, k)
+			}
+		}
+	}
 
 	router := chi.NewRouter()
+	if len(cfg.pathNormalizers) > 0 {
+		router.Use(normalizePath(cfg.pathNormalizers))
+	}
 	if !cfg.keepTrailingSlashes {
 		router.Use(middleware.StripSlashes)
 	}
-	if cfg.notFoundHandler != nil {
-		router.NotFound(cfg.notFoundHandler)
+	if cfg.requestIDHeader != "" {
+		router.Use(requestID(cfg.requestIDHeader))
+	}
+
+	rt := &routing{
+		cfg:        cfg,
+		manifest:   m,
+		router:     router,
+		root:       path.Join(cfg.root, m.PrefixPath),
+		pickers:    map[string]picker{},
+		splits:     map[string]*split{},
+		upstreams:  map[string]*upstreamState{},
+		candidates: map[string][]candidate{},
+		notFound:   http.NotFoundHandler(),
+		readiness:  cfg.readiness,
+
+		destinations: map[string][]*destinationProxy{},
+		autoOptions:  cfg.autoOptions,
+	}
+	if prev != nil {
+		rt.maintenance = prev.maintenance
+	} else {
+		rt.maintenance = &maintenance{}
 	}
 
-	rootPath := path.Join(cfg.root, m.PrefixPath)
+	if cfg.notFoundHandler != nil {
+		rt.notFound = withRoot(rt.root, cfg.notFoundHandler)
+	}
+	rt.notFound = observeUnmatched(rt.notFound, cfg)
+	router.NotFound(rt.serveNotFound)
+	if cfg.autoOptions {
+		router.MethodNotAllowed(rt.serveMethodNotAllowed)
+	}
 
 	for _, u := range m.Upstreams {
-		var err error
-		router.Group(func(r chi.Router) {
-			if mstack, ok := cfg.upstreamMiddleware[u.Identifier]; ok {
-				r.Use(mstack...)
+		var state *upstreamState
+		if prev != nil {
+			state = prev.upstreams[u.Identifier]
+		}
+		if state == nil {
+			state = newUpstreamState(u.Identifier, cfg)
+		}
+		rt.upstreams[u.Identifier] = state
+
+		if keep[u.Identifier] {
+			rt.pickers[u.Identifier] = prev.pickers[u.Identifier]
+			if s, ok := prev.splits[u.Identifier]; ok {
+				rt.splits[u.Identifier] = s
 			}
-			err = mount(r, rootPath, u, cfg)
-		})
-		if err != nil {
+			if dests, ok := prev.destinations[u.Identifier]; ok {
+				rt.destinations[u.Identifier] = dests
+			}
+		}
+
+		if u.FlushIntervalString != "" && u.FlushIntervalMS != 0 {
+			cfg.errorLog.Printf("upstream %q sets both flush_interval and flush_interval_ms; using flush_interval", u.Identifier)
+		}
+
+		if err := rt.mount(u, state, cfg); err != nil {
 			return nil, err
 		}
 	}
 
-	return &Proxy{
-		manifest: m,
-		router:   router,
-		root:     rootPath,
-	}, nil
+	return rt, nil
 }
 
-func mount(router chi.Router, rootPath string, u Upstream, cfg mountConfig) error {
-	rproxy, err := newReverseProxy(u, cfg)
+func (rt *routing) mount(u Upstream, state *upstreamState, cfg mountConfig) error {
+	// Construct the full prefix for mounting. All of this will be stripped
+	// from the request we pass upstream.
+	prefix := path.Join(rt.root, u.PrefixPath)
+	if cfg.prefixRedirect {
+		rt.addRedirectPrefix(prefix)
+	}
+
+	// Redirects are answered by the Proxy, so they have no destinations.
+	pick, ok := rt.pickers[u.Identifier]
+	if !ok && u.Redirect == nil {
+		var err error
+		pick, err = rt.newPicker(u, state, prefix, cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The Upstream's middleware wraps each of its routes. Routes can share a
+	// pattern with other Upstreams' routes, so it can't be applied to a group.
+	var mws chi.Middlewares
+	if cfg.recoverPanics {
+		mws = append(mws, recoverPanics(cfg))
+	}
+	maxHeader, err := maxHeaderBytes(u, cfg)
 	if err != nil {
 		return err
 	}
+	if maxHeader > 0 {
+		mws = append(mws, limitHeaderBytes(maxHeader, cfg))
+	}
+	if len(cfg.bodilessMethods) > 0 {
+		mws = append(mws, rejectBody(cfg.bodilessMethods, cfg))
+	}
+	if c, ok := cfg.cors[u.Identifier]; ok {
+		mws = append(mws, newCORS(c, u).handler)
+	}
+	if auth, ok := cfg.basicAuth[u.Identifier]; ok {
+		mws = append(mws, requireBasicAuth(auth))
+	}
+
+	for _, route := range u.Routes {
+		patterns := routePatterns(prefix, route)
+		routeMws := append(mws[:len(mws):len(mws)], layeredMiddleware(u, route, cfg)...)
+		host, err := compileHost(route.HostPattern(u))
+		if err != nil {
+			return err
+		}
+		match := routeMatcher(route, host)
+
+		methods := route.Methods
+		if cfg.implicitHead && hasMethod(route, http.MethodGet) && !hasMethod(route, http.MethodHead) {
+			methods = append(methods[:len(methods):len(methods)], http.MethodHead)
+		}
+
+		// Routes that accept every method are registered once, and record the
+		// request's method in RouteInfo.
+		if coversAllMethods(methods) {
+			methods = []string{anyMethod}
+		}
 
-	for _, rt := range u.Routes {
-		// Construct the full prefix for mounting. All of this will be
-		// stripped from the request we pass upstream.
-		prefix := path.Join(rootPath, u.PrefixPath)
+		for _, method := range methods {
+			info := RouteInfo{
+				RouteMethod:        method,
+				RoutePath:          route.Path,
+				RoutePrefix:        prefix,
+				RouteTemplate:      patterns[0],
+				UpstreamIdentifier: u.Identifier,
+				UpstreamOwner:      u.Owner,
+				ServedBy:           u.Identifier,
+			}
 
-		for _, method := range rt.Methods {
-			// Defer creation of the RouteInfo structure to request-time.
-			observe := func(r *http.Request) {
-				if cfg.observe == nil {
-					return
+			var handler http.Handler
+			if u.Redirect != nil {
+				handler = redirectHandler(*u.Redirect)
+			} else {
+				handler = proxyHandler(state, pick, route.FlushInterval(u), cfg)
+				if fallback, ok := cfg.fallbacks[u.Identifier]; ok {
+					handler = rt.withFallback(fallback)(handler)
+				}
+				if s, ok := cfg.shadows[u.Identifier]; ok {
+					handler = rt.withShadow(s, cfg)(handler)
+				}
+				if cfg.coalesce[u.Identifier] {
+					handler = coalesce(&state.flights, u.Identifier, cfg)(handler)
 				}
-				cfg.observe(r, &RouteInfo{
-					RouteMethod:        method,
-					RoutePath:          rt.Path,
-					RoutePrefix:        prefix,
-					UpstreamHost:       u.Destination,
-					UpstreamIdentifier: u.Identifier,
-					UpstreamOwner:      u.Owner,
-				})
+				if cfg.bufferBodyMax > 0 && !cfg.streamUploads {
+					handler = bufferRequestBody(cfg.bufferBodyMax, cfg)(handler)
+				}
+				if u.Protocol == UpstreamProtocolGRPCWeb {
+					handler = translateGRPCWeb(handler)
+				}
+			}
+			if len(route.RequireHeaders) > 0 {
+				handler = requireHeaders(route.RequireHeaders, cfg.requireStatus, cfg)(handler)
+			}
+			if route.Deprecated || route.Sunset != "" {
+				handler = deprecate(route)(handler)
+			}
+			if state.sem != nil {
+				handler = limitConcurrency(state.sem, cfg)(handler)
+			}
+			handler = serveMaintenance(rt.maintenance, &state.maintenance, cfg.maintenanceType)(handler)
+			if cfg.timeoutHeader != "" {
+				handler = withHeaderTimeout(cfg.timeoutHeader, cfg.timeoutHeaderMax)(handler)
+			}
+			if timeout := route.Timeout(u); timeout > 0 {
+				handler = withTimeout(timeout)(handler)
+			}
+			handler = withRouteInfo(info)(handler)
+
+			if u.StripsPrefix() {
+				handler = http.StripPrefix(prefix, handler)
+			}
+			if u.SlowThresholdMS > 0 && u.Redirect == nil {
+				threshold := time.Duration(u.SlowThresholdMS) * time.Millisecond
+				handler = logSlowRequests(u.Identifier, threshold, cfg.errorLog)(handler)
+			}
+			handler = routeMws.Handler(handler)
+			if host != nil {
+				handler = withHostParams(host)(handler)
 			}
 
-			path := path.Join(prefix, rt.Path)
-			handler := http.StripPrefix(prefix, proxyHandler(rproxy, observe))
-			router.Method(method, path, handler)
+			c := candidate{
+				upstream: u.Identifier,
+				path:     route.Path,
+				prefix:   prefix,
+				strip:    u.StripsPrefix(),
+				match:    match,
+				handler:  handler,
+			}
+			for _, pattern := range patterns {
+				rt.handle(method, pattern, c)
+			}
+		}
+
+		// Preflight requests are answered by the CORS middleware, but they
+		// need a route to reach it. Preflights don't carry the headers of the
+		// actual request, so match conditions other than the host aren't
+		// applied.
+		if _, ok := cfg.cors[u.Identifier]; ok && !hasMethod(route, http.MethodOptions) {
+			c := candidate{
+				upstream: u.Identifier,
+				path:     route.Path,
+				prefix:   prefix,
+				strip:    u.StripsPrefix(),
+				match:    routeMatcher(Route{}, host),
+				handler:  routeMws.HandlerFunc(methodNotAllowed),
+			}
+			for _, pattern := range patterns {
+				rt.handle(http.MethodOptions, pattern, c)
+			}
 		}
 	}
 
 	return nil
 }
 
+// routePatterns returns the router patterns to register for a Route. Prefix
+// routes match the path itself as well as everything beneath it. A route for
+// "/" under a prefix is the root of the prefix, so it matches the prefix with
+// and without a trailing slash, whether or not trailing slashes are kept.
+func routePatterns(prefix string, route Route) []string {
+	pattern := path.Join(prefix, route.Path)
+	if route.Match == RouteMatchPrefix {
+		return []string{pattern, strings.TrimSuffix(pattern, "/") + "/*"}
+	}
+	if path.Clean(route.Path) == "/" && pattern != "/" {
+		return []string{pattern, pattern + "/"}
+	}
+	return []string{pattern}
+}
+
+// newPicker creates the reverse-proxies for an Upstream's destination(s) and
+// returns a function that chooses one of them for each request. The function is
+// registered so it can be reused by ReplaceUpstream, and Upstreams with weighted
+// destinations have their split registered so it can be adjusted later.
+// Upstreams with a single destination, whether given by the destination
+// attribute or a lone destination block without a Balancer, always get it
+// without going through the split.
+func (rt *routing) newPicker(u Upstream, state *upstreamState, prefix string, cfg mountConfig) (picker, error) {
+	if len(u.Destinations) == 0 && cfg.resolver != nil {
+		pick := newResolvingPicker(cfg.resolver, cfg.resolverTTL, u, state, prefix, cfg)
+		rt.pickers[u.Identifier] = pick
+		return pick, nil
+	}
+	if len(u.Destinations) == 0 {
+		dest, err := newDestinationProxy("", u.Destination, u, state, prefix, cfg)
+		if err != nil {
+			return nil, err
+		}
+		pick := lonePicker(dest, state, cfg)
+		rt.pickers[u.Identifier] = pick
+		rt.destinations[u.Identifier] = []*destinationProxy{dest}
+		return pick, nil
+	}
+
+	s := &split{
+		balancer: cfg.balancers[u.Identifier],
+		health:   &state.health,
+		stale:    cfg.noHealthy == NoHealthyServeStale,
+	}
+	for _, d := range u.Destinations {
+		dest, err := newDestinationProxy(d.Identifier, d.URL, u, state, prefix, cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.add(dest, d.Weight)
+	}
+	rt.splits[u.Identifier] = s
+	rt.destinations[u.Identifier] = s.destinations
+
+	pick := func(_ http.ResponseWriter, r *http.Request) (*destinationProxy, error) { return s.pick(r) }
+	if len(s.destinations) == 1 && s.balancer == nil {
+		// A lone destination always has all of the weight, so there's
+		// nothing to choose between.
+		pick = lonePicker(s.destinations[0], state, cfg)
+	}
+	if sticky, ok := cfg.sticky[u.Identifier]; ok {
+		pick = newStickyPicker(sticky, s, u.Identifier, prefix, cfg.clientIP)
+	}
+	rt.pickers[u.Identifier] = pick
+	return pick, nil
+}
+
+// lonePicker returns a picker for an Upstream's only destination. Requests are
+// refused with ErrNoHealthyDestinations while it's unhealthy, unless
+// WithNoHealthyDestinations says to serve stale.
+func lonePicker(dest *destinationProxy, state *upstreamState, cfg mountConfig) picker {
+	stale := cfg.noHealthy == NoHealthyServeStale
+	return func(http.ResponseWriter, *http.Request) (*destinationProxy, error) {
+		if !stale && !state.health.healthy(dest.identifier) {
+			return nil, ErrNoHealthyDestinations
+		}
+		return dest, nil
+	}
+}
+
 // Root returns the root specified at Proxy creation + the "prefix_path"
 // specified in the Manifest.
 func (p *Proxy) Root() string {
-	if p.root == "" {
+	return rootOrSlash(p.current().root)
+}
+
+func rootOrSlash(root string) string {
+	if root == "" {
 		return "/"
 	}
-	return p.root
+	return root
+}
+
+// rootKey is the context key for the Proxy's root.
+type rootKey struct{}
+
+// withRoot stores the Proxy's root in the request's context before handing the
+// request to h.
+func withRoot(root string, h http.HandlerFunc) http.HandlerFunc {
+	root = rootOrSlash(root)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), rootKey{}, root)
+		h(w, r.WithContext(ctx))
+	}
+}
+
+// observeUnmatched is middleware for requests that no route matched. They're
+// given to the ObserveFunction and Metrics with a RouteInfo that's marked
+// Unmatched, so the volume of requests falling through can be measured.
+func observeUnmatched(next http.Handler, cfg mountConfig) http.Handler {
+	if cfg.observe == nil && cfg.metrics == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := &RouteInfo{
+			RouteMethod: r.Method,
+			ClientIP:    cfg.clientIP(r),
+			Unmatched:   true,
+		}
+		r = r.WithContext(context.WithValue(r.Context(), routeInfoKey{}, info))
+		if observe := cfg.observe; observe != nil {
+			observe(r, info)
+		}
+		if metrics := cfg.metrics; metrics != nil {
+			metrics.IncRequest(info)
+			defer func(start time.Time) {
+				observeLatency(r, cfg, info, time.Since(start))
+			}(time.Now())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RootFromContext returns the Proxy's root (see Proxy.Root) from the context of
+// a request handed to the handler registered with WithNotFound. The request's
+// URL is left as it arrived, so the root can be used to work out the path that
+// was attempted relative to it.
+func RootFromContext(ctx context.Context) (string, bool) {
+	root, ok := ctx.Value(rootKey{}).(string)
+	return root, ok
+}
+
+// rewrite applies the method override and the pre-route rewrite, if there are
+// any, to a copy of the request.
+func (rt *routing) rewrite(r *http.Request) *http.Request {
+	if header := rt.cfg.methodOverride; header != "" {
+		if m := overrideMethod(r, header); m != "" {
+			r = r.Clone(r.Context())
+			r.Method = m
+			r.Header.Del(header)
+		}
+	}
+	if rt.cfg.preRoute == nil {
+		return r
+	}
+	r = r.Clone(r.Context())
+	before, raw := r.URL.Path, r.URL.RawPath
+	rt.cfg.preRoute(r)
+
+	// A RawPath left over from the original path would be used in its place.
+	if r.URL.Path != before && r.URL.RawPath == raw {
+		r.URL.RawPath = ""
+	}
+	return r
 }
 
 // Upstreams returns the Upstream services registered with this Proxy.
 func (p *Proxy) Upstreams() []Upstream {
-	return p.manifest.Upstreams
+	return p.current().manifest.Upstreams
+}
+
+// SetUpstreamEnabled takes an Upstream in or out of rotation. Requests routed
+// to a disabled Upstream aren't proxied; they're handed to the ErrorHandler
+// with ErrUpstreamDisabled or, if there isn't one, answered with 503 Service
+// Unavailable. The setting survives reloads that keep the Upstream's
+// identifier.
+func (p *Proxy) SetUpstreamEnabled(identifier string, enabled bool) error {
+	state, ok := p.current().upstreams[identifier]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownUpstream, identifier)
+	}
+
+	var disabled int32
+	if !enabled {
+		disabled = 1
+	}
+	atomic.StoreInt32(&state.disabled, disabled)
+	return nil
 }
 
 // ServeHTTP implements net/http.Handler
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	p.router.ServeHTTP(w, r)
+	if _, ok := r.Context().Value(matchedKey{}).(*string); !ok {
+		r = TrackMatchedUpstream(r)
+	}
+	rt := p.current()
+	r = rt.rewrite(r)
+	if rt.cfg.accessLog != nil || len(rt.cfg.upstreamAccessLogs) > 0 {
+		logAccess(rt.router, rt.cfg).ServeHTTP(w, r)
+		return
+	}
+	rt.router.ServeHTTP(w, r)
 }
 
-// newReverseProxy creates and configures a new httputil.ReverseProxy.
-func newReverseProxy(u Upstream, cfg mountConfig) (*httputil.ReverseProxy, error) {
-	dest, err := url.Parse(u.Destination)
+// newDestinationProxy creates and configures a new httputil.ReverseProxy for one
+// of the Upstream's destinations. The prefix is the path the Upstream's routes
+// are mounted under.
+func newDestinationProxy(identifier, destination string, u Upstream, state *upstreamState, prefix string, cfg mountConfig) (*destinationProxy, error) {
+	dest, err := url.Parse(destination)
 	if err != nil {
 		return nil, err
 	}
 
 	if dest.Scheme == "" {
-		return nil, fmt.Errorf("missing scheme: %q", u.Destination)
+		return nil, fmt.Errorf("missing scheme: %q", destination)
+	}
+	var socket string
+	if dest.Scheme == "unix" {
+		if socket, dest, err = unixSocket(dest); err != nil {
+			return nil, err
+		}
 	}
 
 	proxy := httputil.NewSingleHostReverseProxy(dest)
-	setDirector(proxy, dest.Host, cfg.requestModifier)
+	strip := append(cfg.stripHeaders[:len(cfg.stripHeaders):len(cfg.stripHeaders)], u.StripRequestHeaders...)
+	var anonymize RequestModifier
+	if cfg.stripForwarded[u.Identifier] {
+		anonymize = stripForwarded
+	}
+	var identify, collapse RequestModifier
+	if cfg.upstreamIDHeader != "" {
+		identify = identifyUpstream(cfg.upstreamIDHeader, u.Identifier)
+	}
+	if cfg.collapseSlashes {
+		collapse = collapseSlashes
+	}
+	setDirector(proxy, dest.Host, strip, collapse, authorize(u.Auth), identify, cfg.requestModifier, cfg.directors[u.Identifier], anonymize)
 	if cfg.transport != nil {
 		proxy.Transport = cfg.transport
 	}
+	if hasTransportTimeouts(u) {
+		t, err := tunedTransport(u, proxy.Transport)
+		if err != nil {
+			return nil, err
+		}
+		proxy.Transport = t
+	}
+	if socket != "" {
+		t, err := unixTransport(u, socket, proxy.Transport)
+		if err != nil {
+			return nil, err
+		}
+		proxy.Transport = t
+	}
+	transport := proxy.Transport
+	if cfg.followRedirects[u.Identifier] {
+		base := proxy.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		proxy.Transport = &followRedirects{base: base, max: cfg.maxRedirects}
+	}
+	if cfg.retries > 0 {
+		base := proxy.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		proxy.Transport = &retryTransport{
+			base:    base,
+			max:     cfg.retries,
+			budget:  state.retryBudget,
+			backoff: cfg.retryBackoff,
+		}
+	}
 	if cfg.errorLog != nil {
 		proxy.ErrorLog = cfg.errorLog
 	}
-	if cfg.bufferPool != nil {
+	if pool, ok := cfg.bufferPools[u.Identifier]; ok {
+		proxy.BufferPool = pool
+	} else if cfg.bufferPool != nil {
 		proxy.BufferPool = cfg.bufferPool
 	}
-	if cfg.responseModifier != nil {
-		proxy.ModifyResponse = cfg.responseModifier
+	proxy.FlushInterval = u.FlushInterval()
+	proxy.ModifyResponse = responseModifiers(cfg, u, dest, prefix, proxy.FlushInterval)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if drained(r.Context()) {
+			serveError(w, r, cfg, fmt.Errorf("%w: %v", ErrUpstreamDrained, err), http.StatusServiceUnavailable)
+			return
+		}
+		if r.Context().Err() == context.Canceled {
+			// The client went away, which canceled the upstream request.
+			// There's nobody to respond to, but the ErrorHandler and Metrics
+			// are still told.
+			serveError(w, r, cfg, fmt.Errorf("%w: %v", ErrClientDisconnected, err), http.StatusBadGateway)
+			return
+		}
+		if fallback := fallbackFrom(r.Context()); fallback != nil {
+			logUpstreamError(cfg, u.Identifier, r, "upstream failed, falling back", err, "fallback", cfg.fallbacks[u.Identifier])
+			if fallback(w) {
+				return
+			}
+		}
+		if cfg.errorHandler == nil {
+			// Mirror httputil.ReverseProxy's default behavior.
+			logUpstreamError(cfg, u.Identifier, r, "http: proxy error", err)
+		}
+		status := http.StatusBadGateway
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		serveGatewayError(w, r, cfg, err, status)
 	}
-	if cfg.errorHandler != nil {
-		proxy.ErrorHandler = cfg.errorHandler
+
+	// A ReverseProxy has a single FlushInterval, so routes that override it
+	// are served by copies of the proxy.
+	var flushProxies map[time.Duration]*httputil.ReverseProxy
+	for _, route := range u.Routes {
+		d := route.FlushInterval(u)
+		if _, ok := flushProxies[d]; ok || d == proxy.FlushInterval {
+			continue
+		}
+		if flushProxies == nil {
+			flushProxies = map[time.Duration]*httputil.ReverseProxy{}
+		}
+		p := *proxy
+		p.FlushInterval = d
+		p.ModifyResponse = responseModifiers(cfg, u, dest, prefix, d)
+		flushProxies[d] = &p
 	}
-	proxy.FlushInterval = time.Duration(u.FlushIntervalMS) * time.Millisecond
 
-	return proxy, nil
+	// Replays to a shadow mustn't reach the ErrorHandler or Metrics, which
+	// are for the clients' requests.
+	shadow := *proxy
+	shadow.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logShadowError(cfg, u.Identifier, r, err)
+	}
+
+	return &destinationProxy{
+		identifier:   identifier,
+		url:          destination,
+		target:       dest,
+		proxy:        proxy,
+		transport:    transport,
+		flushProxies: flushProxies,
+		shadow:       &shadow,
+	}, nil
+}
+
+// normalizePath is middleware that applies path normalizers to requests before
+// they're routed. The raw (encoded) path is discarded if the path changes,
+// since it no longer corresponds.
+func normalizePath(normalizers []func(string) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := r.URL.Path
+			for _, fn := range normalizers {
+				p = fn(p)
+			}
+			if p != r.URL.Path {
+				u := *r.URL
+				u.Path = p
+				u.RawPath = ""
+				r2 := new(http.Request)
+				*r2 = *r
+				r2.URL = &u
+				r = r2
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// withTimeout is middleware that sets a deadline on requests. Requests that
+// the upstream doesn't answer in time are answered with 504 Gateway Timeout.
+func withTimeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// withHeaderTimeout is middleware that sets a deadline on requests from the
+// number of milliseconds in their header, up to max. Requests without a valid
+// header are left alone.
+func withHeaderTimeout(header string, max time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ms, err := strconv.ParseInt(r.Header.Get(header), 10, 64)
+			if err != nil || ms <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			d := max
+			if ms < max.Milliseconds() {
+				d = time.Duration(ms) * time.Millisecond
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// routeInfoKey is the context key for the RouteInfo of a request being proxied.
+type routeInfoKey struct{}
+
+// withRouteInfo is middleware that gives each request its own copy of the
+// RouteInfo, stored in the request's context.
+func withRouteInfo(info RouteInfo) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := info
+			if info.RouteMethod == anyMethod {
+				info.RouteMethod = r.Method
+			}
+			info.HostParams = HostParams(r)
+			ctx := context.WithValue(r.Context(), routeInfoKey{}, &info)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// routeInfoFrom returns the RouteInfo stored in the context, or nil if there
+// isn't one.
+func routeInfoFrom(ctx context.Context) *RouteInfo {
+	info, _ := ctx.Value(routeInfoKey{}).(*RouteInfo)
+	return info
+}
+
+// URLParams returns the path parameters captured by the route that matched the
+// request, keyed by name, or nil if there are none. Whatever a trailing
+// wildcard matched is keyed by "*". It can be used by ObserveFunctions and
+// middleware given to WithUpstreamMiddleware; chi.URLParam works there too.
+func URLParams(r *http.Request) map[string]string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || len(rctx.URLParams.Keys) == 0 {
+		return nil
+	}
+	params := make(map[string]string, len(rctx.URLParams.Keys))
+	for i, k := range rctx.URLParams.Keys {
+		params[k] = rctx.URLParams.Values[i]
+	}
+	return params
+}
+
+// copyExtra copies the values returned by a request enricher, which may be
+// shared between requests.
+func copyExtra(extra map[string]string) map[string]string {
+	if extra == nil {
+		return nil
+	}
+	c := make(map[string]string, len(extra))
+	for k, v := range extra {
+		c[k] = v
+	}
+	return c
 }
 
 // proxyHandler is an HTTP that hands requests off to a httputil.ReverseProxy.
 // It performs some request-level logging.
-func proxyHandler(proxy *httputil.ReverseProxy, observe func(r *http.Request)) http.Handler {
+func proxyHandler(state *upstreamState, pick picker, flush time.Duration, cfg mountConfig) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		observe(r)
-		proxy.ServeHTTP(w, r)
+		enabled := state.track(r, func(r *http.Request) {
+			serveTracked(state, pick, flush, cfg, w, r)
+		})
+		if !enabled {
+			serveError(w, r, cfg, ErrUpstreamDisabled, http.StatusServiceUnavailable)
+		}
 	})
 }
 
+// serveTracked proxies a request that's tracked as in flight to the Upstream.
+func serveTracked(state *upstreamState, pick picker, flush time.Duration, cfg mountConfig, w http.ResponseWriter, r *http.Request) {
+	if !state.healthy() && serveUnhealthy(w, r, cfg) {
+		return
+	}
+
+	dest, err := pick(w, r)
+	if errors.Is(err, ErrNoHealthyDestinations) && serveUnhealthy(w, r, cfg) {
+		return
+	}
+	if err != nil {
+		serveGatewayError(w, r, cfg, err, http.StatusBadGateway)
+		return
+	}
+	info := routeInfoFrom(r.Context())
+	info.UpstreamHost = dest.url
+	info.UpstreamDestination = dest.identifier
+	info.UpstreamURL = dest.targetURL(r.URL).String()
+	info.ClientIP = cfg.clientIP(r)
+	if enrich := cfg.enricher; enrich != nil {
+		info.Extra = copyExtra(enrich(r))
+	}
+	if observe := cfg.observe; observe != nil {
+		observe(r, info)
+	}
+	if metrics := cfg.metrics; metrics != nil {
+		metrics.IncRequest(info)
+		defer func(start time.Time) {
+			observeLatency(r, cfg, info, time.Since(start))
+		}(time.Now())
+	}
+
+	dest.serve(dest.proxyFor(flush), w, r)
+}
+
+// hasTransportTimeouts reports whether the Upstream sets any timeouts for its
+// connections to destinations.
+func hasTransportTimeouts(u Upstream) bool {
+	return u.DialTimeoutMS > 0 || u.TLSHandshakeTimeoutMS > 0 || u.ResponseHeaderTimeoutMS > 0
+}
+
+// tunedTransport returns a copy of the base transport with the Upstream's
+// connection timeouts applied. Only an *http.Transport can be tuned, so any
+// other http.RoundTripper given to WithTransport is an error.
+func tunedTransport(u Upstream, base http.RoundTripper) (*http.Transport, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	bt, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("upstream %q sets connection timeouts, which need an *http.Transport; got %T", u.Identifier, base)
+	}
+
+	t := bt.Clone()
+	if u.DialTimeoutMS > 0 {
+		t.DialContext = (&net.Dialer{
+			Timeout:   time.Duration(u.DialTimeoutMS) * time.Millisecond,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
+	if u.TLSHandshakeTimeoutMS > 0 {
+		t.TLSHandshakeTimeout = time.Duration(u.TLSHandshakeTimeoutMS) * time.Millisecond
+	}
+	if u.ResponseHeaderTimeoutMS > 0 {
+		t.ResponseHeaderTimeout = time.Duration(u.ResponseHeaderTimeoutMS) * time.Millisecond
+	}
+	return t, nil
+}
+
+// responseModifiers combines the built-in response modification that's been
+// enabled with the caller's ResponseModifiers. It returns nil if there's
+// nothing to apply.
+func responseModifiers(cfg mountConfig, u Upstream, dest *url.URL, prefix string, flush time.Duration) ResponseModifier {
+	var mods ResponsePipeline
+	if u.Protocol == UpstreamProtocolGRPCWeb {
+		mods = append(mods, grpcWebResponse)
+	}
+	if _, ok := cfg.fallbacks[u.Identifier]; ok {
+		mods = append(mods, triggerFallback)
+	}
+	if fn, ok := cfg.bodyTransformers[u.Identifier]; ok && flush == 0 {
+		// Streamed responses can't be buffered to be transformed.
+		mods = append(mods, transformBody(fn, cfg.bodyTransformMax))
+	}
+	if cfg.requestIDHeader != "" {
+		// The ID is echoed on the response already; drop the upstream's copy
+		// so it isn't duplicated.
+		mods = append(mods, func(resp *http.Response) error {
+			resp.Header.Del(cfg.requestIDHeader)
+			return nil
+		})
+	}
+	if headers := responseHeaders(cfg.responseHeaders, u.ResponseHeaders); len(headers) > 0 {
+		mods = append(mods, func(resp *http.Response) error {
+			for k, v := range headers {
+				resp.Header.Set(k, v)
+			}
+			return nil
+		})
+	}
+	if cfg.rewriteRedirects {
+		if !u.StripsPrefix() {
+			// The destination already sees the prefix in its paths.
+			prefix = ""
+		}
+		mods = append(mods, rewriteRedirects(dest, prefix))
+	}
+	if cfg.responseModifier != nil {
+		mods = append(mods, cfg.responseModifier)
+	}
+	mods = append(mods, cfg.responseMods[u.Identifier]...)
+
+	switch len(mods) {
+	case 0:
+		return nil
+	case 1:
+		return mods[0]
+	}
+	return mods.ModifyResponse
+}
+
+// responseHeaders merges the headers set on every response with those set on
+// an Upstream's, which take precedence.
+func responseHeaders(global, upstream map[string]string) map[string]string {
+	h := map[string]string{}
+	for _, headers := range []map[string]string{global, upstream} {
+		for k, v := range headers {
+			h[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+	return h
+}
+
+// serveError responds to a request that couldn't be proxied. The ErrorHandler
+// is given the error if there is one; otherwise the status code is written.
+func serveError(w http.ResponseWriter, r *http.Request, cfg mountConfig, err error, status int) {
+	recordError(r, cfg, err)
+	if cfg.errorHandler != nil {
+		cfg.errorHandler(w, r, err)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+// serveGatewayError responds to a request that couldn't be proxied because of
+// a problem reaching the upstream. The response given to
+// WithGatewayErrorResponse is used unless there's an ErrorHandler.
+func serveGatewayError(w http.ResponseWriter, r *http.Request, cfg mountConfig, err error, status int) {
+	if cfg.errorHandler == nil && cfg.gatewayError != nil {
+		recordError(r, cfg, err)
+		cfg.gatewayError.write(w, status)
+		return
+	}
+	serveError(w, r, cfg, err, status)
+}
+
+// recordError counts an error against the request's route with the configured
+// Metrics.
+func recordError(r *http.Request, cfg mountConfig, err error) {
+	if cfg.metrics != nil {
+		if info := routeInfoFrom(r.Context()); info != nil {
+			cfg.metrics.IncError(info, err)
+		}
+	}
+}
+
+// collapseSlashes is a RequestModifier that replaces runs of slashes in the
+// path of a request sent upstream with a single slash. The query is left
+// alone.
+func collapseSlashes(r *http.Request) {
+	r.URL.Path = collapsePath(r.URL.Path)
+	if r.URL.RawPath != "" {
+		r.URL.RawPath = collapsePath(r.URL.RawPath)
+	}
+}
+
+func collapsePath(p string) string {
+	if !strings.Contains(p, "//") {
+		return p
+	}
+
+	var b strings.Builder
+	b.Grow(len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && i > 0 && p[i-1] == '/' {
+			continue
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
+// identifyUpstream returns a RequestModifier that sets the header to the
+// identifier of the Upstream the request is proxied to, replacing any value
+// sent by the client.
+func identifyUpstream(header, identifier string) RequestModifier {
+	return func(r *http.Request) {
+		r.Header.Set(header, identifier)
+	}
+}
+
 // setDirector replaces the existing proxy's director function with one of our
 // own to smooth over some behavior. It also applies any request modification
-// configured by the caller.
-func setDirector(p *httputil.ReverseProxy, destHost string, modifier RequestModifier) {
+// configured by the caller, in order.
+func setDirector(p *httputil.ReverseProxy, destHost string, strip []string, modifiers ...RequestModifier) {
 	base := p.Director
 	p.Director = func(r *http.Request) {
 		base(r)
 
+		for _, h := range strip {
+			r.Header.Del(h)
+		}
+
 		// Override r.Host to prevent us sending this request back to ourselves.
 		// A bug in the stdlib causes this value to be preferred over the
 		// r.URL.Host (which is set in the default Director) if r.Host isn't
@@ -180,8 +1329,10 @@ func setDirector(p *httputil.ReverseProxy, destHost string, modifier RequestModi
 		// https://github.com/golang/go/issues/28168
 		r.Host = destHost
 
-		if modifier != nil {
-			modifier(r)
+		for _, modify := range modifiers {
+			if modify != nil {
+				modify(r)
+			}
 		}
 	}
 }
@@ -2,14 +2,21 @@ package pass
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/hashicorp/hcl/v2"
@@ -73,6 +80,47 @@ func TestParsing(t *testing.T) {
 	require.Empty(t, diff)
 }
 
+func TestAnnotationsWithPrefix(t *testing.T) {
+	u := Upstream{
+		Annotations: map[string]string{
+			"company/middleware-stack": "jwt,tracing",
+			"company/version":          "2",
+			"company":                  "acme",
+			"other/version":            "1",
+			"pass/max-header-bytes":    "4096",
+		},
+	}
+	require.Equal(t, map[string]string{
+		"company/middleware-stack": "jwt,tracing",
+		"company/version":          "2",
+	}, u.AnnotationsWithPrefix("company/"))
+	require.Equal(t, map[string]string{
+		"middleware-stack": "jwt,tracing",
+		"version":          "2",
+	}, u.AnnotationNamespace("company/"))
+	require.Empty(t, u.AnnotationsWithPrefix("missing/"))
+	require.Empty(t, Upstream{}.AnnotationNamespace("company/"))
+
+	m := &Manifest{Annotations: u.Annotations}
+	require.Equal(t, map[string]string{"other/version": "1"}, m.AnnotationsWithPrefix("other/"))
+	require.Equal(t, map[string]string{"max-header-bytes": "4096"}, m.AnnotationNamespace("pass/"))
+}
+
+func TestAnnotationKeys(t *testing.T) {
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"namespace": cty.StringVal("primary"),
+		},
+	}
+	m, err := LoadManifest("testdata/manifest.hcl", ectx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"company/middleware-stack", "company/version"}, m.AnnotationKeys())
+
+	m, err = LoadManifest("testdata/basic.hcl", nil)
+	require.NoError(t, err)
+	require.Empty(t, m.AnnotationKeys())
+}
+
 func TestRouting(t *testing.T) {
 	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, r.URL.Path)
@@ -140,6 +188,140 @@ func TestRouting(t *testing.T) {
 		require.Equal(t, http.StatusNotFound, resp.StatusCode)
 	})
 
+	t.Run("not found handler", func(t *testing.T) {
+		var (
+			notFoundPath string
+			notFoundRoot string
+		)
+		notFound := func(w http.ResponseWriter, r *http.Request) {
+			notFoundPath = r.URL.Path
+			notFoundRoot, _ = RootFromContext(r.Context())
+			w.WriteHeader(http.StatusTeapot)
+		}
+
+		proxy, err := New(m, WithRoot("/root"), WithNotFound(notFound))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/root/api/v2/private/notfound/", nil)
+		require.NoError(t, err)
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTeapot, resp.StatusCode)
+		require.Equal(t, "/root/api/v2/private/notfound/", notFoundPath)
+		require.Equal(t, "/root/api/v2", notFoundRoot)
+	})
+
+	t.Run("not found observed", func(t *testing.T) {
+		var captured *RouteInfo
+		observe := func(r *http.Request, info *RouteInfo) {
+			captured = info
+		}
+		metrics := &recordingMetrics{}
+		notFound := func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}
+
+		proxy, err := New(m, WithObserveFunction(observe), WithMetrics(metrics), WithNotFound(notFound))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/api/v2/private/notfound")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTeapot, resp.StatusCode)
+		require.Equal(t, &RouteInfo{
+			RouteMethod: http.MethodGet,
+			ClientIP:    "127.0.0.1",
+			Unmatched:   true,
+		}, captured)
+		require.Len(t, metrics.requests, 1)
+		require.True(t, metrics.requests[0].Unmatched)
+		require.Len(t, metrics.latencies, 1)
+
+		captured = nil
+		resp, err = client.Get(server.URL + "/api/v2/private/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.False(t, captured.Unmatched)
+	})
+
+	t.Run("implicit head", func(t *testing.T) {
+		proxy, err := New(m, WithImplicitHead())
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Head(server.URL + "/api/v2/private/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("head without implicit head", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Head(server.URL + "/api/v2/private/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+	})
+
+	t.Run("path normalizer", func(t *testing.T) {
+		lower := func(p string) string { return strings.ToLower(p) }
+		collapse := func(p string) string { return strings.ReplaceAll(p, "//", "/") }
+		proxy, err := New(m, WithPathNormalizer(lower), WithPathNormalizer(collapse))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/API/v2//private/Accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "/accounts", string(b))
+	})
+
+	t.Run("pre-route rewrite", func(t *testing.T) {
+		var modified string
+		legacy := func(r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/v1/") {
+				r.URL.Path = "/api/v2/private/" + strings.TrimPrefix(r.URL.Path, "/v1/")
+			}
+		}
+		proxy, err := New(m,
+			WithPreRouteRewrite(legacy),
+			WithRequestModifier(func(r *http.Request) { modified = r.URL.Path }),
+		)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/v1/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "/accounts", string(b))
+		require.Equal(t, "/accounts", modified)
+
+		match, ok := proxy.Match(httptest.NewRequest(http.MethodGet, "/v1/accounts", nil))
+		require.True(t, ok)
+		require.Equal(t, "/accounts", match.Path)
+	})
+
 	t.Run("with root specified", func(t *testing.T) {
 		proxy, err := New(m, WithRoot("/root"))
 		require.NoError(t, err)
@@ -184,12 +366,73 @@ func TestRouting(t *testing.T) {
 			RouteMethod:        http.MethodGet,
 			RoutePath:          "/accounts",
 			RoutePrefix:        "/api/v2/private",
+			RouteTemplate:      "/api/v2/private/accounts",
 			UpstreamHost:       destination.URL,
 			UpstreamIdentifier: "accounts",
 			UpstreamOwner:      "Identity <team-identity@company.com>",
+			ServedBy:           "accounts",
+			UpstreamURL:        destination.URL + "/accounts",
+			ClientIP:           "127.0.0.1",
 		}, captured)
 	})
 
+	t.Run("with request enricher", func(t *testing.T) {
+		shared := map[string]string{"country": "NZ"}
+		enrich := func(r *http.Request) map[string]string {
+			return shared
+		}
+		var captured *RouteInfo
+		observe := func(r *http.Request, info *RouteInfo) {
+			captured = info
+			info.Extra["country"] = "changed"
+		}
+
+		proxy, err := New(m, WithRequestEnricher(enrich), WithObserveFunction(observe))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/api/v2/private/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, map[string]string{"country": "changed"}, captured.Extra)
+		require.Equal(t, map[string]string{"country": "NZ"}, shared)
+	})
+
+	t.Run("url params", func(t *testing.T) {
+		var observed, middleware map[string]string
+		var chiParam string
+		observe := func(r *http.Request, info *RouteInfo) {
+			observed = URLParams(r)
+		}
+		mw := func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				middleware = URLParams(r)
+				chiParam = chi.URLParam(r, "id")
+				next.ServeHTTP(w, r)
+			})
+		}
+
+		proxy, err := New(m, WithObserveFunction(observe), WithUpstreamMiddleware("accounts", mw))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/api/v2/private/accounts/42")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, map[string]string{"id": "42"}, observed)
+		require.Equal(t, map[string]string{"id": "42"}, middleware)
+		require.Equal(t, "42", chiParam)
+
+		resp, err = client.Get(server.URL + "/api/v2/private/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Nil(t, observed)
+	})
+
 	t.Run("upstreams exposed", func(t *testing.T) {
 		proxy, err := New(m)
 		require.NoError(t, err)
@@ -227,6 +470,142 @@ func TestRouting(t *testing.T) {
 	})
 }
 
+func TestQueryAndEncodedPath(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s?%s", r.URL.EscapedPath(), r.URL.RawQuery)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/routing.hcl", ectx)
+	require.NoError(t, err)
+	proxy, err := New(m, WithRoot("/root"))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name   string
+		path   string
+		expect string
+	}{
+		{
+			name:   "query string",
+			path:   "/root/api/v2/private/accounts?filter=a%2Fb&sort=desc",
+			expect: "/accounts?filter=a%2Fb&sort=desc",
+		},
+		{
+			name:   "encoded slash in path",
+			path:   "/root/api/v2/private/accounts/a%2Fb?sort=desc",
+			expect: "/accounts/a%2Fb?sort=desc",
+		},
+		{
+			name:   "encoded space in path",
+			path:   "/root/api/v2/private/accounts/a%20b",
+			expect: "/accounts/a%20b?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			require.NoError(t, err)
+
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			b, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, tt.expect, string(b))
+		})
+	}
+}
+
+func TestDestinationBasePath(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s?%s", r.URL.EscapedPath(), r.URL.RawQuery)
+	}))
+	defer destination.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name        string
+		destination string
+	}{
+		{
+			name:        "base path",
+			destination: destination.URL + "/base",
+		},
+		{
+			name:        "base path with trailing slash",
+			destination: destination.URL + "/base/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ectx := &hcl.EvalContext{
+				Variables: map[string]cty.Value{
+					"destination": cty.StringVal(tt.destination),
+				},
+			}
+			m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+			require.NoError(t, err)
+			var upstreamURL string
+			observe := func(r *http.Request, info *RouteInfo) {
+				upstreamURL = info.UpstreamURL
+			}
+			proxy, err := New(m, WithObserveFunction(observe))
+			require.NoError(t, err)
+			server := httptest.NewServer(proxy)
+			defer server.Close()
+
+			resp, err := client.Get(server.URL + "/accounts?sort=desc")
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			b, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, "/base/accounts?sort=desc", string(b))
+			require.Equal(t, destination.URL+"/base/accounts?sort=desc", upstreamURL)
+		})
+	}
+
+	t.Run("weighted destination", func(t *testing.T) {
+		ectx := &hcl.EvalContext{
+			Variables: map[string]cty.Value{
+				"blue":  cty.StringVal(destination.URL + "/blue"),
+				"green": cty.StringVal(destination.URL + "/green"),
+			},
+		}
+		m, err := LoadManifest("testdata/split.hcl", ectx)
+		require.NoError(t, err)
+		var upstreamURL string
+		observe := func(r *http.Request, info *RouteInfo) {
+			upstreamURL = info.UpstreamURL
+		}
+		proxy, err := New(m, WithObserveFunction(observe))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "/blue/accounts?", string(b))
+		require.Equal(t, destination.URL+"/blue/accounts", upstreamURL)
+	})
+}
+
 func TestErrorLogging(t *testing.T) {
 	b := bytes.NewBuffer(nil)
 	l := log.New(b, "", 0)
@@ -260,6 +639,59 @@ func TestErrorLogging(t *testing.T) {
 	require.Contains(t, b.String(), "broken transport")
 }
 
+type countingBufferPool struct {
+	gets int32
+}
+
+func (p *countingBufferPool) Get() []byte {
+	atomic.AddInt32(&p.gets, 1)
+	return make([]byte, 32*1024)
+}
+
+func (p *countingBufferPool) Put([]byte) {}
+
+func TestUpstreamBufferPool(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "body")
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"stable": cty.StringVal(destination.URL),
+			"beta":   cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/match_headers.hcl", ectx)
+	require.NoError(t, err)
+
+	global := &countingBufferPool{}
+	beta := &countingBufferPool{}
+	proxy, err := New(m, WithBufferPool(global), WithUpstreamBufferPool("beta", beta))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	resp, err := client.Get(server.URL + "/widgets")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(1), atomic.LoadInt32(&global.gets))
+	require.Equal(t, int32(0), atomic.LoadInt32(&beta.gets))
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/widgets", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Beta", "true")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(1), atomic.LoadInt32(&global.gets))
+	require.Equal(t, int32(1), atomic.LoadInt32(&beta.gets))
+
+	_, err = New(m, WithUpstreamBufferPool("doesnt-exist", beta))
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+}
+
 func TestErrorHandling(t *testing.T) {
 	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
 		return nil, fmt.Errorf("broken transport")
@@ -297,10 +729,16 @@ func TestErrorHandling(t *testing.T) {
 	require.Error(t, capturedErr)
 }
 
-func TestModification(t *testing.T) {
-	var requestHeader string
+func TestClientDisconnect(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{})
 	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		requestHeader = r.Header.Get("Direction")
+		close(started)
+		select {
+		case <-r.Context().Done():
+			close(canceled)
+		case <-time.After(5 * time.Second):
+		}
 	}))
 	defer destination.Close()
 
@@ -311,50 +749,344 @@ func TestModification(t *testing.T) {
 	}
 	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
 	require.NoError(t, err)
-	proxy, err := New(m,
-		WithRequestModifier(func(r *http.Request) {
-			r.Header.Add("Direction", "in")
-		}),
-		WithResponseModifier(func(r *http.Response) error {
-			r.Header.Add("Direction", "out")
-			return nil
-		}),
-	)
-	require.NoError(t, err)
 
+	handled := make(chan error, 1)
+	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+		handled <- err
+	}
+	proxy, err := New(m, WithErrorHandler(errorHandler))
+	require.NoError(t, err)
 	server := httptest.NewServer(proxy)
 	defer server.Close()
-	client := &http.Client{Timeout: 500 * time.Millisecond}
 
-	req, err := http.NewRequest(http.MethodGet, server.URL+"/accounts", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/accounts", nil)
 	require.NoError(t, err)
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, err = http.DefaultClient.Do(req)
+	require.Error(t, err)
 
-	resp, err := client.Do(req)
-	require.NoError(t, err)
-	require.Equal(t, http.StatusOK, resp.StatusCode)
-	require.Equal(t, "out", resp.Header.Get("Direction"))
-	require.Equal(t, "in", requestHeader)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("upstream request wasn't canceled")
+	}
+	select {
+	case err := <-handled:
+		require.True(t, errors.Is(err, ErrClientDisconnected))
+	case <-time.After(time.Second):
+		t.Fatal("error handler wasn't called")
+	}
 }
 
-func TestMissingScheme(t *testing.T) {
+func TestGatewayErrorResponse(t *testing.T) {
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, fmt.Errorf("broken transport")
+	})
+
 	ectx := &hcl.EvalContext{
 		Variables: map[string]cty.Value{
-			"destination": cty.StringVal("noscheme.local"),
+			"destination": cty.StringVal("http://badhost.local"),
 		},
 	}
 	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
 	require.NoError(t, err)
-	_, err = New(m)
-	require.Error(t, err)
-	require.Equal(t, err.Error(), `missing scheme: "noscheme.local"`)
-}
+	body := []byte(`{"error":"upstream unavailable"}`)
 
-func TestEmptyRoot(t *testing.T) {
-	m := &Manifest{}
-	proxy, err := New(m)
-	require.NoError(t, err)
-	require.Equal(t, "/", proxy.Root())
-}
+	t.Run("custom response", func(t *testing.T) {
+		proxy, err := New(m,
+			WithGatewayErrorResponse(http.StatusServiceUnavailable, body, "application/json"),
+			WithTransport(transport),
+		)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 500 * time.Millisecond}
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, body, b)
+	})
+
+	t.Run("default status", func(t *testing.T) {
+		proxy, err := New(m,
+			WithGatewayErrorResponse(0, body, "application/json"),
+			WithTransport(transport),
+		)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 500 * time.Millisecond}
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("error handler takes precedence", func(t *testing.T) {
+		errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusTeapot)
+		}
+		proxy, err := New(m,
+			WithGatewayErrorResponse(http.StatusServiceUnavailable, body, "application/json"),
+			WithErrorHandler(errorHandler),
+			WithTransport(transport),
+		)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 500 * time.Millisecond}
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTeapot, resp.StatusCode)
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Empty(t, b)
+	})
+}
+
+func TestStripRequestHeaders(t *testing.T) {
+	var received http.Header
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/strip_headers.hcl", ectx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"x-internal-token"}, m.Upstreams[0].StripRequestHeaders)
+
+	proxy, err := New(m, WithStripRequestHeaders("authorization", "Cookie"))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	send := func(path string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("Cookie", "session=secret")
+		req.Header.Set("X-Internal-Token", "secret")
+		req.Header.Set("X-Hop", "secret")
+		req.Header.Set("Connection", "X-Hop")
+		req.Header.Set("Accept", "text/plain")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	send("/partner")
+	require.Empty(t, received.Get("Authorization"))
+	require.Empty(t, received.Get("Cookie"))
+	require.Empty(t, received.Get("X-Internal-Token"))
+	require.Empty(t, received.Get("X-Hop"))
+	require.Equal(t, "text/plain", received.Get("Accept"))
+
+	send("/internal")
+	require.Empty(t, received.Get("Authorization"))
+	require.Empty(t, received.Get("Cookie"))
+	require.Equal(t, "secret", received.Get("X-Internal-Token"))
+}
+
+func TestUpstreamDirector(t *testing.T) {
+	var (
+		path      string
+		direction []string
+	)
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		direction = r.Header.Values("Direction")
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/strip_headers.hcl", ectx)
+	require.NoError(t, err)
+	proxy, err := New(m,
+		WithRequestModifier(func(r *http.Request) {
+			r.Header.Add("Direction", "global")
+		}),
+		WithUpstreamDirector("partner", func(r *http.Request) {
+			r.Header.Add("Direction", "upstream")
+			r.URL.Path = "/v2" + r.URL.Path
+		}),
+	)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 500 * time.Millisecond}
+
+	resp, err := client.Get(server.URL + "/partner")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "/v2/partner", path)
+	require.Equal(t, []string{"global", "upstream"}, direction)
+
+	resp, err = client.Get(server.URL + "/internal")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "/internal", path)
+	require.Equal(t, []string{"global"}, direction)
+
+	_, err = New(m, WithUpstreamDirector("missing", func(r *http.Request) {}))
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+}
+
+func TestModification(t *testing.T) {
+	var requestHeader string
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestHeader = r.Header.Get("Direction")
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+	proxy, err := New(m,
+		WithRequestModifier(func(r *http.Request) {
+			r.Header.Add("Direction", "in")
+		}),
+		WithResponseModifier(func(r *http.Response) error {
+			r.Header.Add("Direction", "out")
+			return nil
+		}),
+	)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 500 * time.Millisecond}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/accounts", nil)
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "out", resp.Header.Get("Direction"))
+	require.Equal(t, "in", requestHeader)
+}
+
+func TestUpstreamResponseModifier(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/strip_headers.hcl", ectx)
+	require.NoError(t, err)
+
+	add := func(direction string) ResponseModifier {
+		return func(resp *http.Response) error {
+			resp.Header.Add("Direction", direction)
+			return nil
+		}
+	}
+	errRejected := errors.New("rejected")
+	var handled error
+	proxy, err := New(m,
+		WithResponseModifier(add("global")),
+		WithUpstreamResponseModifier("partner", add("first"), add("second")),
+		WithUpstreamResponseModifier("partner", add("third")),
+		WithUpstreamResponseModifier("internal", add("first"), func(resp *http.Response) error {
+			return errRejected
+		}, add("second")),
+		WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			w.WriteHeader(http.StatusBadGateway)
+		}),
+	)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 500 * time.Millisecond}
+
+	resp, err := client.Get(server.URL + "/partner")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, []string{"global", "first", "second", "third"}, resp.Header.Values("Direction"))
+
+	resp, err = client.Get(server.URL + "/internal")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.Empty(t, resp.Header.Values("Direction"))
+	require.True(t, errors.Is(handled, errRejected))
+
+	_, err = New(m, WithUpstreamResponseModifier("missing", add("first")))
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+}
+
+func TestResponsePipeline(t *testing.T) {
+	var calls []string
+	step := func(name string, err error) ResponseModifier {
+		return func(*http.Response) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	errStop := errors.New("stop")
+
+	p := ResponsePipeline{step("a", nil), step("b", nil)}
+	require.NoError(t, p.ModifyResponse(&http.Response{}))
+	require.Equal(t, []string{"a", "b"}, calls)
+
+	calls = nil
+	p = ResponsePipeline{step("a", nil), step("b", errStop), step("c", nil)}
+	require.True(t, errors.Is(p.ModifyResponse(&http.Response{}), errStop))
+	require.Equal(t, []string{"a", "b"}, calls)
+
+	require.NoError(t, ResponsePipeline(nil).ModifyResponse(&http.Response{}))
+}
+
+func TestMissingScheme(t *testing.T) {
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal("noscheme.local"),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+	_, err = New(m)
+	require.Error(t, err)
+	require.Equal(t, err.Error(), `missing scheme: "noscheme.local"`)
+}
+
+func TestEmptyRoot(t *testing.T) {
+	m := &Manifest{}
+	proxy, err := New(m)
+	require.NoError(t, err)
+	require.Equal(t, "/", proxy.Root())
+}
 
 func TestDuplicateUpstreamIdentifier(t *testing.T) {
 	_, err := LoadManifest("testdata/duplicate_identifier.hcl", nil)
@@ -370,8 +1102,1177 @@ func TestMissingUpstreamForMiddleware(t *testing.T) {
 	require.Equal(t, `upstream missing for middleware stack: "doesnt-exist"`, err.Error())
 }
 
-type roundTripperFunc func(*http.Request) (*http.Response, error)
+func TestSplit(t *testing.T) {
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "blue")
+	}))
+	defer blue.Close()
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "green")
+	}))
+	defer green.Close()
 
-func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
-	return f(r)
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"blue":  cty.StringVal(blue.URL),
+			"green": cty.StringVal(green.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/split.hcl", ectx)
+	require.NoError(t, err)
+	require.Equal(t, []Destination{
+		{Identifier: "blue", URL: blue.URL, Weight: 100},
+		{Identifier: "green", URL: green.URL, Weight: 0},
+	}, m.Upstreams[0].Destinations)
+
+	var captured *RouteInfo
+	observe := func(r *http.Request, info *RouteInfo) {
+		captured = info
+	}
+	proxy, err := New(m, WithObserveFunction(observe))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	get := func() string {
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	for i := 0; i < 10; i++ {
+		require.Equal(t, "blue", get())
+	}
+	require.Equal(t, "blue", captured.UpstreamDestination)
+	require.Equal(t, blue.URL, captured.UpstreamHost)
+
+	err = proxy.SetSplit("accounts", map[string]int{"green": 1})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.Equal(t, "green", get())
+	}
+	require.Equal(t, "green", captured.UpstreamDestination)
+	require.Equal(t, green.URL, captured.UpstreamHost)
+
+	err = proxy.SetSplit("doesnt-exist", map[string]int{"green": 1})
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+
+	err = proxy.SetSplit("accounts", map[string]int{"red": 1})
+	require.True(t, errors.Is(err, ErrUnknownDestination))
+
+	err = proxy.SetSplit("accounts", map[string]int{"blue": 0, "green": 0})
+	require.True(t, errors.Is(err, ErrInvalidWeights))
+
+	err = proxy.SetSplit("accounts", map[string]int{"blue": -1, "green": 2})
+	require.True(t, errors.Is(err, ErrInvalidWeights))
+
+	// Invalid splits leave the existing weights in place.
+	require.Equal(t, "green", get())
+}
+
+func TestConflictingDestination(t *testing.T) {
+	_, err := LoadManifest("testdata/conflicting_destination.hcl", nil)
+	require.Error(t, err)
+	require.Equal(t, `destination attribute conflicts with destination blocks: "accounts"`, err.Error())
+}
+
+func TestFlushInterval(t *testing.T) {
+	m, err := LoadManifest("testdata/flush_interval.hcl", nil)
+	require.NoError(t, err)
+
+	expect := map[string]time.Duration{
+		"duration":     250 * time.Millisecond,
+		"immediate":    -1,
+		"milliseconds": time.Second,
+		"both":         2 * time.Second,
+	}
+	for _, u := range m.Upstreams {
+		require.Equal(t, expect[u.Identifier], u.FlushInterval(), u.Identifier)
+	}
+
+	b := bytes.NewBuffer(nil)
+	_, err = New(m, WithErrorLog(log.New(b, "", 0)))
+	require.NoError(t, err)
+	require.Equal(t, "upstream \"both\" sets both flush_interval and flush_interval_ms; using flush_interval\n", b.String())
+
+	_, err = LoadManifest("testdata/invalid_flush_interval.hcl", nil)
+	require.True(t, errors.Is(err, ErrInvalidFlushInterval))
+}
+
+func TestRouteFlushInterval(t *testing.T) {
+	release := make(chan struct{})
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A known length keeps the ReverseProxy from flushing immediately
+		// on its own.
+		w.Header().Set("Content-Length", strconv.Itoa(len("first")+len("second")))
+		fmt.Fprint(w, "first")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "second")
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/route_flush_interval.hcl", ectx)
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), m.Upstreams[0].Routes[0].FlushInterval(m.Upstreams[0]))
+	require.Equal(t, time.Duration(-1), m.Upstreams[0].Routes[1].FlushInterval(m.Upstreams[0]))
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	defer close(release)
+
+	// The streaming route flushes the first write while the upstream is
+	// still responding; the buffered route doesn't.
+	read := func(path string) <-chan string {
+		ch := make(chan string, 1)
+		go func() {
+			resp, err := http.Get(server.URL + path)
+			if err != nil {
+				ch <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			b := make([]byte, len("first"))
+			n, _ := resp.Body.Read(b)
+			ch <- string(b[:n])
+		}()
+		return ch
+	}
+
+	select {
+	case s := <-read("/stream"):
+		require.Equal(t, "first", s)
+	case <-time.After(time.Second):
+		t.Fatal("streaming route wasn't flushed")
+	}
+
+	select {
+	case s := <-read("/buffered"):
+		t.Fatalf("buffered route was flushed: %q", s)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestLoadManifestDir(t *testing.T) {
+	m, err := LoadManifestDir("testdata/manifest_dir", nil)
+	require.NoError(t, err)
+	require.Equal(t, "/api", m.PrefixPath)
+	require.Len(t, m.Upstreams, 2)
+	require.Equal(t, "accounts", m.Upstreams[0].Identifier)
+	require.Equal(t, "widgets", m.Upstreams[1].Identifier)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	require.Equal(t, "/api", proxy.Root())
+
+	_, err = LoadManifestDir("testdata/manifest_dir_inconsistent", nil)
+	require.True(t, errors.Is(err, ErrInconsistentManifest))
+
+	_, err = LoadManifestDir("testdata/manifest_dir_duplicate", nil)
+	require.True(t, errors.Is(err, ErrDuplicateUpstreamIdentifier))
+}
+
+func TestRouteMatch(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/route_match.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/files", http.StatusOK},
+		{"/files/readme.txt", http.StatusNotFound},
+		{"/assets", http.StatusOK},
+		{"/assets/logo.png", http.StatusOK},
+		{"/assets/images/logo.png", http.StatusOK},
+		{"/assetsfoo", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tt.path)
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+			if tt.status == http.StatusOK {
+				b, err := ioutil.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.path, string(b))
+			}
+		})
+	}
+
+	_, err = LoadManifest("testdata/invalid_route_match.hcl", nil)
+	require.True(t, errors.Is(err, ErrInvalidRouteMatch))
+}
+
+func TestTimeout(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/timeout.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 2 * time.Second}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"upstream timeout", "/reports", http.StatusGatewayTimeout},
+		{"longer route timeout", "/reports/export", http.StatusOK},
+		{"upstream timeout not reached", "/search", http.StatusOK},
+		{"shorter route timeout", "/search/strict", http.StatusGatewayTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tt.path)
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestRequestTimeoutHeader(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/timeout.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m,
+		WithRequestTimeoutHeader("X-Timeout-Ms"),
+		WithMaxRequestTimeoutHeader(50*time.Millisecond),
+	)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 2 * time.Second}
+
+	tests := []struct {
+		name    string
+		path    string
+		timeout string
+		status  int
+	}{
+		{"no header", "/search", "", http.StatusOK},
+		{"shorter than route timeout", "/search", "20", http.StatusGatewayTimeout},
+		{"clamped to max", "/search", "100000", http.StatusGatewayTimeout},
+		{"invalid", "/search", "soon", http.StatusOK},
+		{"negative", "/search", "-20", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			require.NoError(t, err)
+			if tt.timeout != "" {
+				req.Header.Set("X-Timeout-Ms", tt.timeout)
+			}
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestTransportTimeouts(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	load := func(t *testing.T, destination string) *Manifest {
+		ectx := &hcl.EvalContext{
+			Variables: map[string]cty.Value{
+				"destination": cty.StringVal(destination),
+			},
+		}
+		m, err := LoadManifest("testdata/transport_timeouts.hcl", ectx)
+		require.NoError(t, err)
+		return m
+	}
+
+	tests := []struct {
+		name        string
+		destination string
+		statuses    []int
+	}{
+		// Addresses in this range are reserved and never answer, though some
+		// networks reject them outright rather than timing out.
+		{"dial timeout", "http://10.255.255.1", []int{http.StatusBadGateway, http.StatusGatewayTimeout}},
+		{"response header timeout", slow.URL, []int{http.StatusGatewayTimeout}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := New(load(t, tt.destination))
+			require.NoError(t, err)
+			server := httptest.NewServer(proxy)
+			defer server.Close()
+			client := &http.Client{Timeout: 2 * time.Second}
+
+			start := time.Now()
+			resp, err := client.Get(server.URL + "/widgets")
+			require.NoError(t, err)
+			require.Contains(t, tt.statuses, resp.StatusCode)
+			require.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+		})
+	}
+
+	t.Run("slow body after headers", func(t *testing.T) {
+		// Only the wait for headers is limited, so bodies can stream for longer.
+		streaming := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			time.Sleep(300 * time.Millisecond)
+			w.Write([]byte("done"))
+		}))
+		defer streaming.Close()
+
+		proxy, err := New(load(t, streaming.URL))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 2 * time.Second}
+
+		resp, err := client.Get(server.URL + "/widgets")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "done", string(body))
+	})
+
+	t.Run("custom round tripper", func(t *testing.T) {
+		rt := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			return nil, errors.New("unused")
+		})
+		_, err := New(load(t, slow.URL), WithTransport(rt))
+		require.Error(t, err)
+	})
+
+	t.Run("negative timeout", func(t *testing.T) {
+		m := load(t, slow.URL)
+		m.Upstreams[0].DialTimeoutMS = -1
+		require.True(t, errors.Is(m.Validate(), ErrInvalidTimeout))
+	})
+}
+
+func TestStripPrefix(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/strip_prefix.hcl", ectx)
+	require.NoError(t, err)
+	require.True(t, m.Upstreams[0].StripsPrefix())
+	require.False(t, m.Upstreams[1].StripsPrefix())
+
+	proxy, err := New(m, WithRoot("/root"))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"stripped", "/root/api/stripped/widgets/1", "/widgets/1"},
+		{"unstripped", "/root/api/unstripped/widgets/1", "/root/api/unstripped/widgets/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tt.path)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			b, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(b))
+		})
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/response_headers.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithResponseHeaders(map[string]string{
+		"Strict-Transport-Security": "max-age=31536000",
+		"X-Content-Type-Options":    "nosniff",
+	}))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{"/web", map[string]string{
+			"Strict-Transport-Security": "max-age=63072000",
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+		}},
+		{"/api", map[string]string{
+			"Strict-Transport-Security": "max-age=31536000",
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "SAMEORIGIN",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := client.Get(server.URL + tt.path)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			for k, v := range tt.want {
+				require.Equal(t, []string{v}, resp.Header.Values(k), k)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	basic, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+	routing, err := LoadManifest("testdata/routing.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(basic)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	resp, err := client.Get(server.URL + "/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	err = proxy.Reload(routing)
+	require.NoError(t, err)
+	require.Equal(t, "/api/v2", proxy.Root())
+	require.Equal(t, routing.Upstreams, proxy.Upstreams())
+
+	resp, err = client.Get(server.URL + "/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = client.Get(server.URL + "/api/v2/private/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestSetRoot(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/routing.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithRoot("/a"))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	resp, err := client.Get(server.URL + "/a/api/v2/private/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.NoError(t, proxy.SetRoot("/b"))
+	require.Equal(t, "/b/api/v2", proxy.Root())
+
+	resp, err = client.Get(server.URL + "/a/api/v2/private/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = client.Get(server.URL + "/b/api/v2/private/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "/accounts", string(b))
+
+	// The new root is kept when the Proxy is reloaded.
+	require.NoError(t, proxy.Reload(m))
+	require.Equal(t, "/b/api/v2", proxy.Root())
+
+	err = proxy.SetRoot("c")
+	require.True(t, errors.Is(err, ErrInvalidRoot))
+	require.Equal(t, "/b/api/v2", proxy.Root())
+
+	// New accepts roots without a leading slash, adding one.
+	proxy, err = New(m, WithRoot("c"))
+	require.NoError(t, err)
+	require.Equal(t, "/c/api/v2", proxy.Root())
+}
+
+func TestSetRootConcurrentRequests(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+	proxy, err := New(m,
+		WithPreRouteRewrite(func(*http.Request) {}),
+		WithMethodOverride("X-HTTP-Method-Override"),
+		WithAccessLog(ioutil.Discard, CommonLogFormat),
+	)
+	require.NoError(t, err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			proxy.SetRoot(fmt.Sprintf("/r%d", i%2))
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/r0/accounts", nil))
+		proxy.Describe()
+	}
+	<-done
+}
+
+func TestReplaceUpstream(t *testing.T) {
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "blue"+r.URL.Path)
+	}))
+	defer blue.Close()
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "green"+r.URL.Path)
+	}))
+	defer green.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"blue":  cty.StringVal(blue.URL),
+			"green": cty.StringVal(green.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/replace.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	get := func(path string) (int, string) {
+		resp, err := client.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	require.NoError(t, proxy.SetSplit("accounts", map[string]int{"green": 100}))
+	require.NoError(t, proxy.SetUpstreamEnabled("widgets", false))
+
+	err = proxy.ReplaceUpstream(Upstream{
+		Identifier:  "widgets",
+		Destination: green.URL,
+		Routes: []Route{
+			{Methods: []string{http.MethodGet}, Path: "/gizmos"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, proxy.Upstreams(), 2)
+
+	// Runtime state of the replaced Upstream is kept.
+	status, _ := get("/gizmos")
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.NoError(t, proxy.SetUpstreamEnabled("widgets", true))
+
+	status, body := get("/gizmos")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "green/gizmos", body)
+
+	status, _ = get("/widgets")
+	require.Equal(t, http.StatusNotFound, status)
+
+	// Other Upstreams keep their destinations and splits.
+	status, body = get("/accounts")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "green/accounts", body)
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		err := proxy.ReplaceUpstream(Upstream{Identifier: "doesnt-exist", Destination: green.URL})
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+
+	t.Run("missing scheme", func(t *testing.T) {
+		err := proxy.ReplaceUpstream(Upstream{
+			Identifier:  "widgets",
+			Destination: "widgets.local",
+			Routes: []Route{
+				{Methods: []string{http.MethodGet}, Path: "/widgets"},
+			},
+		})
+		require.Error(t, err)
+		require.Equal(t, `missing scheme: "widgets.local"`, err.Error())
+	})
+
+	t.Run("invalid route", func(t *testing.T) {
+		err := proxy.ReplaceUpstream(Upstream{
+			Identifier:  "widgets",
+			Destination: green.URL,
+			Routes: []Route{
+				{Path: "/widgets"},
+			},
+		})
+		require.True(t, errors.Is(err, ErrInvalidRoute))
+	})
+
+	// Failed replacements leave the Proxy as it was.
+	status, body = get("/gizmos")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "green/gizmos", body)
+}
+
+func TestSetUpstreamEnabled(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	t.Run("default response", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		err = proxy.SetUpstreamEnabled("accounts", false)
+		require.NoError(t, err)
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+		err = proxy.SetUpstreamEnabled("accounts", true)
+		require.NoError(t, err)
+
+		resp, err = client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("error handler", func(t *testing.T) {
+		var capturedErr error
+		errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+			w.WriteHeader(http.StatusTeapot)
+			capturedErr = err
+		}
+
+		proxy, err := New(m, WithErrorHandler(errorHandler))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		err = proxy.SetUpstreamEnabled("accounts", false)
+		require.NoError(t, err)
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTeapot, resp.StatusCode)
+		require.Equal(t, ErrUpstreamDisabled, capturedErr)
+	})
+
+	t.Run("survives reload", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		err = proxy.SetUpstreamEnabled("accounts", false)
+		require.NoError(t, err)
+
+		reloaded, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+		require.NoError(t, err)
+		err = proxy.Reload(reloaded)
+		require.NoError(t, err)
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+
+		err = proxy.SetUpstreamEnabled("doesnt-exist", false)
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestUnknownAttributes(t *testing.T) {
+	t.Run("strict", func(t *testing.T) {
+		_, err := LoadManifest("testdata/unknown_attribute.hcl", nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "testdata/unknown_attribute.hcl:3,5")
+		require.Contains(t, err.Error(), "retry_policy")
+	})
+
+	t.Run("lenient", func(t *testing.T) {
+		m, err := LoadManifestLenient("testdata/unknown_attribute.hcl", nil)
+		require.NoError(t, err)
+		require.Equal(t, "http://widgets.local", m.Upstreams[0].Destination)
+		require.Len(t, m.Upstreams[0].Routes, 1)
+
+		err = m.Validate()
+		require.True(t, errors.Is(err, ErrUnknownAttribute))
+		var verr *ValidationError
+		require.True(t, errors.As(err, &verr))
+		require.False(t, verr.Fatal())
+		require.Len(t, verr.Warnings, 2)
+		require.Contains(t, verr.Warnings[0].Error()+verr.Warnings[1].Error(), "testdata/unknown_attribute.hcl:3,5")
+	})
+
+	t.Run("lenient still fails on invalid manifests", func(t *testing.T) {
+		_, err := LoadManifestLenient("testdata/invalid_method.hcl", nil)
+		require.True(t, errors.Is(err, ErrInvalidMethod))
+	})
+}
+
+func TestLocals(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/locals.hcl", ectx)
+	require.NoError(t, err)
+	require.Equal(t, destination.URL, m.Upstreams[0].Destination)
+
+	var paths []string
+	for _, r := range m.Upstreams[0].Routes {
+		paths = append(paths, r.Path)
+	}
+	require.Equal(t, []string{
+		"/v2/accounts",
+		"/v2/accounts/{id:[0-9]+}",
+		"/v2/accounts/{id:[0-9]+}/orders",
+	}, paths)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/v2/accounts/123/orders", nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "/v2/accounts/123/orders", w.Body.String())
+
+	_, err = LoadManifest("testdata/cyclic_locals.hcl", nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "a, b")
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("unrouted upstreams", func(t *testing.T) {
+		m, err := LoadManifest("testdata/unrouted.hcl", nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"gadgets"}, m.UnroutedUpstreams())
+
+		err = m.Validate()
+		require.True(t, errors.Is(err, ErrUnroutedUpstream))
+		var verr *ValidationError
+		require.True(t, errors.As(err, &verr))
+		require.False(t, verr.Fatal())
+		require.Empty(t, verr.Errors)
+		require.Len(t, verr.Warnings, 1)
+	})
+
+	t.Run("valid", func(t *testing.T) {
+		m, err := LoadManifest("testdata/basic.hcl", nil)
+		require.NoError(t, err)
+		require.Empty(t, m.UnroutedUpstreams())
+		require.NoError(t, m.Validate())
+	})
+
+	t.Run("every problem", func(t *testing.T) {
+		m := Manifest{
+			Upstreams: []Upstream{
+				{Identifier: "widgets", Routes: []Route{{Methods: []string{http.MethodGet}, Path: "/widgets"}}},
+				{Identifier: "widgets", Destination: "http://widgets.local", TimeoutMS: -1},
+			},
+		}
+
+		err := m.Validate()
+		var verr *ValidationError
+		require.True(t, errors.As(err, &verr))
+		require.True(t, verr.Fatal())
+		require.Len(t, verr.Errors, 3)
+		require.Len(t, verr.Warnings, 1)
+		require.True(t, errors.Is(err, ErrDuplicateUpstreamIdentifier))
+		require.True(t, errors.Is(err, ErrMissingDestination))
+		require.True(t, errors.Is(err, ErrInvalidTimeout))
+		require.True(t, errors.Is(err, ErrUnroutedUpstream))
+	})
+}
+
+func TestRelativeRoutePath(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/relative_route.hcl", ectx)
+	require.NoError(t, err)
+	require.Equal(t, "/widgets", m.Upstreams[0].Routes[0].Path)
+
+	// Routes without methods load, but are reported as a warning.
+	err = m.Validate()
+	require.True(t, errors.Is(err, ErrInvalidRoute))
+	var verr *ValidationError
+	require.True(t, errors.As(err, &verr))
+	require.False(t, verr.Fatal())
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/widgets", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "/widgets", w.Body.String())
+}
+
+func TestStreamingUploads(t *testing.T) {
+	var received int64
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 32<<10)
+		for {
+			n, err := r.Body.Read(buf)
+			atomic.AddInt64(&received, int64(n))
+			if err != nil {
+				break
+			}
+		}
+	}))
+	defer primary.Close()
+	var mirrored int32
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&mirrored, 1)
+	}))
+	defer secondary.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(primary.URL),
+			"secondary": cty.StringVal(secondary.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	// Without WithStreamingUploads, both of these would read the whole body
+	// before proxying it.
+	proxy, err := New(m,
+		WithStreamingUploads(),
+		WithBufferRequestBody(64<<20),
+		WithShadow("primary", "secondary", 1),
+	)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	const chunk, chunks = 256 << 10, 64
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	done := make(chan *http.Response)
+	go func() {
+		resp, err := http.Post(server.URL+"/widgets", "application/octet-stream", pr)
+		if err != nil {
+			pr.CloseWithError(err)
+			close(done)
+			return
+		}
+		done <- resp
+	}()
+
+	// Each chunk reaches the upstream before the next one is sent, so at most
+	// a chunk of the body is held at a time.
+	data := bytes.Repeat([]byte("a"), chunk)
+	for i := 1; i <= chunks; i++ {
+		_, err := pw.Write(data)
+		require.NoError(t, err)
+		want := int64(i * chunk)
+		require.Eventually(t, func() bool {
+			return atomic.LoadInt64(&received) == want
+		}, 5*time.Second, time.Millisecond, "chunk %d", i)
+	}
+	require.NoError(t, pw.Close())
+
+	resp, ok := <-done
+	require.True(t, ok)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int64(chunk*chunks), atomic.LoadInt64(&received))
+	require.Equal(t, int32(0), atomic.LoadInt32(&mirrored))
+}
+
+func TestUpstreamIdentifierHeader(t *testing.T) {
+	var received []string
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Values("X-Pass-Upstream")
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal(destination.URL),
+			"secondary": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	serve := func(t *testing.T, proxy *Proxy, path string) {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("X-Pass-Upstream", "spoofed")
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	proxy, err := New(m, WithUpstreamIdentifierHeader("X-Pass-Upstream"))
+	require.NoError(t, err)
+	serve(t, proxy, "/widgets")
+	require.Equal(t, []string{"primary"}, received)
+	serve(t, proxy, "/gadgets")
+	require.Equal(t, []string{"secondary"}, received)
+
+	proxy, err = New(m)
+	require.NoError(t, err)
+	serve(t, proxy, "/widgets")
+	require.Equal(t, []string{"spoofed"}, received)
+}
+
+func TestCollapseSlashes(t *testing.T) {
+	var received string
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.RequestURI()
+	}))
+	defer destination.Close()
+
+	load := func(t *testing.T, dest string) *Manifest {
+		ectx := &hcl.EvalContext{
+			Variables: map[string]cty.Value{
+				"destination": cty.StringVal(dest),
+			},
+		}
+		m, err := LoadManifest("testdata/collapse_slashes.hcl", ectx)
+		require.NoError(t, err)
+		return m
+	}
+
+	tests := []struct {
+		name        string
+		destination string
+		path        string
+		expect      string
+	}{
+		{"after prefix", destination.URL, "/api/v2//accounts", "/accounts"},
+		{"within path", destination.URL, "/api/v2/accounts///123", "/accounts/123"},
+		{"query untouched", destination.URL, "/api/v2//accounts?next=//a//b", "/accounts?next=//a//b"},
+		{"destination path", destination.URL + "/base/", "/api/v2//accounts", "/base/accounts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := New(load(t, tt.destination), WithCollapseSlashes())
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, tt.expect, received)
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		proxy, err := New(load(t, destination.URL))
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v2//accounts", nil)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "//accounts", received)
+	})
+}
+
+// Routes for "/" are the root of their prefix, which is reached with or without
+// a trailing slash. Unless the prefix is stripped, the path is sent upstream as
+// it arrived.
+func TestRootPathRoutes(t *testing.T) {
+	var received string
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.URL.RequestURI()
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+
+	tests := []struct {
+		manifest string
+		path     string
+		expect   string
+	}{
+		{"testdata/root_path.hcl", "/api/v2/private", "/"},
+		{"testdata/root_path.hcl", "/api/v2/private/", "/"},
+		{"testdata/root_path.hcl", "/api/v2/private/?q=1", "/?q=1"},
+		{"testdata/root_path.hcl", "/api/v2/public", "/api/v2/public"},
+		{"testdata/root_path.hcl", "/api/v2/public/", "/api/v2/public/"},
+		{"testdata/root_path_unprefixed.hcl", "/", "/"},
+	}
+	for _, keep := range []bool{false, true} {
+		for _, tt := range tests {
+			m, err := LoadManifest(tt.manifest, ectx)
+			require.NoError(t, err)
+			var opts []MountOption
+			if keep {
+				opts = append(opts, WithTrailingSlashes())
+			}
+			proxy, err := New(m, opts...)
+			require.NoError(t, err)
+
+			t.Run(fmt.Sprintf("%s keep=%t", tt.path, keep), func(t *testing.T) {
+				received = ""
+				r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+				w := httptest.NewRecorder()
+				proxy.ServeHTTP(w, r)
+				require.Equal(t, http.StatusOK, w.Code)
+				require.Equal(t, tt.expect, received)
+			})
+		}
+	}
 }
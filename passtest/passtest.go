@@ -0,0 +1,61 @@
+// Package passtest provides helpers for testing Manifests and Proxies.
+package passtest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/brettbuddin/pass"
+)
+
+// RouteCase is a request and the route it's expected to match. An empty
+// Upstream expects the request to match no route.
+type RouteCase struct {
+	Method       string      // Request method. Defaults to GET.
+	Path         string      // Request path, which may include a query
+	Host         string      // Request host, if routes match on it
+	Header       http.Header // Request headers, if routes match on them
+	Upstream     string      // Identifier of the Upstream expected to serve the request
+	UpstreamPath string      // Path expected to be sent to the Upstream. Not checked if empty.
+}
+
+// ExpectRoutes checks that each case's request is routed to the expected
+// Upstream, using Proxy.Match, and reports the route that actually matched for
+// those that aren't.
+func ExpectRoutes(t testing.TB, proxy *pass.Proxy, cases []RouteCase) {
+	t.Helper()
+
+	for _, c := range cases {
+		method := c.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		r := httptest.NewRequest(method, c.Path, nil)
+		if c.Host != "" {
+			r.Host = c.Host
+		}
+		for k, v := range c.Header {
+			r.Header[k] = v
+		}
+
+		m, ok := proxy.Match(r)
+		switch {
+		case !ok && c.Upstream != "":
+			t.Errorf("%s %s: expected upstream %q, but no route matched", method, c.Path, c.Upstream)
+		case ok && c.Upstream == "":
+			t.Errorf("%s %s: expected no route to match, but matched %s", method, c.Path, describe(m))
+		case ok && m.Upstream != c.Upstream:
+			t.Errorf("%s %s: expected upstream %q, but matched %s", method, c.Path, c.Upstream, describe(m))
+		case ok && c.UpstreamPath != "" && m.UpstreamPath != c.UpstreamPath:
+			t.Errorf("%s %s: expected upstream path %q, but got %q from %s", method, c.Path, c.UpstreamPath, m.UpstreamPath, describe(m))
+		}
+	}
+}
+
+// describe summarizes the matched route for failure messages.
+func describe(m pass.RouteMatch) string {
+	return fmt.Sprintf("upstream %q route %s %s", m.Upstream, m.Method, path.Join(m.Prefix, m.Path))
+}
@@ -0,0 +1,60 @@
+package passtest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/brettbuddin/pass"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// recorder is a testing.TB that records failures instead of failing.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestExpectRoutes(t *testing.T) {
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal("http://localhost"),
+		},
+	}
+	m, err := pass.LoadManifest("../testdata/routing.hcl", ectx)
+	require.NoError(t, err)
+	proxy, err := pass.New(m)
+	require.NoError(t, err)
+
+	t.Run("passing", func(t *testing.T) {
+		ExpectRoutes(t, proxy, []RouteCase{
+			{Path: "/api/v2/private/accounts", Upstream: "accounts", UpstreamPath: "/accounts"},
+			{Path: "/api/v2/private/accounts/123", Upstream: "accounts", UpstreamPath: "/accounts/123"},
+			{Method: "DELETE", Path: "/api/v2/private/accounts"},
+			{Path: "/unknown"},
+		})
+	})
+
+	t.Run("failing", func(t *testing.T) {
+		rec := &recorder{TB: t}
+		ExpectRoutes(rec, proxy, []RouteCase{
+			{Path: "/api/v2/private/accounts", Upstream: "widgets"},
+			{Path: "/api/v2/private/accounts", Upstream: "accounts", UpstreamPath: "/private/accounts"},
+			{Path: "/api/v2/private/accounts/123"},
+			{Path: "/unknown", Upstream: "accounts"},
+		})
+		require.Equal(t, []string{
+			`GET /api/v2/private/accounts: expected upstream "widgets", but matched upstream "accounts" route GET /api/v2/private/accounts`,
+			`GET /api/v2/private/accounts: expected upstream path "/private/accounts", but got "/accounts" from upstream "accounts" route GET /api/v2/private/accounts`,
+			`GET /api/v2/private/accounts/123: expected no route to match, but matched upstream "accounts" route GET /api/v2/private/accounts/{id}`,
+			`GET /unknown: expected upstream "accounts", but no route matched`,
+		}, rec.errors)
+	})
+}
@@ -0,0 +1,52 @@
+// Package passutil provides helpers for use alongside package pass.
+package passutil
+
+import (
+	"sync"
+
+	"github.com/brettbuddin/pass"
+)
+
+// DefaultBufferSize is the size of the buffers httputil.ReverseProxy allocates
+// for copying response bodies when it isn't given a BufferPool.
+const DefaultBufferSize = 32 * 1024
+
+// NewBufferPool creates a pass.BufferPool, for use with pass.WithBufferPool,
+// that hands out byte slices of a fixed size. Buffers are reused across
+// responses, which reduces allocations when proxying large response bodies.
+//
+// A body is copied in chunks of the buffer's size, so buffers larger than most
+// response bodies waste memory while buffers that are much smaller mean more
+// writes to the client. The default of DefaultBufferSize suits most responses;
+// consider something larger (e.g. 64-128KB) when responses are typically
+// megabytes in size. If size isn't positive, DefaultBufferSize is used.
+func NewBufferPool(size int) pass.BufferPool {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+	p := &bufferPool{size: size}
+	p.pool.New = func() interface{} {
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+type bufferPool struct {
+	size int
+	pool sync.Pool
+}
+
+func (p *bufferPool) Get() []byte {
+	return *p.pool.Get().(*[]byte)
+}
+
+// Put returns a buffer to the pool. Buffers too small to be handed out again
+// are dropped.
+func (p *bufferPool) Put(b []byte) {
+	if cap(b) < p.size {
+		return
+	}
+	b = b[:p.size]
+	p.pool.Put(&b)
+}
@@ -0,0 +1,53 @@
+package passutil
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferPool(t *testing.T) {
+	p := NewBufferPool(1024)
+
+	b := p.Get()
+	require.Len(t, b, 1024)
+	p.Put(b[:10])
+	require.Len(t, p.Get(), 1024)
+
+	// Buffers that are too small aren't reused.
+	p.Put(make([]byte, 10))
+	require.Len(t, p.Get(), 1024)
+
+	require.Len(t, NewBufferPool(0).Get(), DefaultBufferSize)
+}
+
+// The benchmarks copy a response body the way httputil.ReverseProxy does, with
+// and without a pool.
+
+var body = bytes.Repeat([]byte("a"), 1024*1024)
+
+// copyBody copies the body using buf. The reader and writer are wrapped so
+// io.CopyBuffer can't bypass the buffer.
+func copyBody(buf []byte) {
+	_, _ = io.CopyBuffer(struct{ io.Writer }{ioutil.Discard}, struct{ io.Reader }{bytes.NewReader(body)}, buf)
+}
+
+func BenchmarkCopyWithoutPool(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		copyBody(make([]byte, DefaultBufferSize))
+	}
+}
+
+func BenchmarkCopyWithPool(b *testing.B) {
+	p := NewBufferPool(DefaultBufferSize)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := p.Get()
+		copyBody(buf)
+		p.Put(buf)
+	}
+}
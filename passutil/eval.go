@@ -0,0 +1,117 @@
+package passutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+)
+
+// EnvEvalContext returns an hcl.EvalContext, for use with pass.LoadManifest,
+// that exposes the process's environment variables to the manifest as
+// env.NAME. This keeps secrets, such as an Upstream's credentials, out of the
+// manifest itself:
+//
+//	auth {
+//	    type = "bearer"
+//	    token = env.WIDGETS_TOKEN
+//	}
+//
+// Referring to a variable that isn't set is an error when the manifest is
+// loaded.
+func EnvEvalContext() *hcl.EvalContext {
+	vars := map[string]cty.Value{}
+	for _, kv := range os.Environ() {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			vars[kv[:i]] = cty.StringVal(kv[i+1:])
+		}
+	}
+	return &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"env": cty.ObjectVal(vars),
+		},
+	}
+}
+
+// SecretsEvalContext returns an hcl.EvalContext, for use with pass.LoadManifest,
+// that exposes the values in a file of secrets, such as one mounted into a
+// container, to the manifest as secret.NAME. The file holds string attributes,
+// as HCL unless it's JSON:
+//
+//	widgets_token = "s3cr3t"
+//
+// It can be combined with EnvEvalContext using MergeEvalContexts, so the
+// manifest can refer to both env.NAME and secret.NAME. The Manifest keeps only
+// the attributes secrets are interpolated into, and Proxy.Describe redacts
+// credentials and URL passwords, so secrets used for those don't appear in its
+// output. Referring to a secret that isn't in the file is an error when the
+// manifest is loaded.
+func SecretsEvalContext(path string) (*hcl.EvalContext, error) {
+	parser := hclparse.NewParser()
+	var (
+		file  *hcl.File
+		diags hcl.Diagnostics
+	)
+	if filepath.Ext(path) == ".json" {
+		file, diags = parser.ParseJSONFile(path)
+	} else {
+		file, diags = parser.ParseHCLFile(path)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	vars := map[string]cty.Value{}
+	for name, attr := range attrs {
+		v, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		if !v.Type().Equals(cty.String) {
+			return nil, fmt.Errorf("secret %q in %s: want a string, got %s", name, path, v.Type().FriendlyName())
+		}
+		vars[name] = v
+	}
+	return &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"secret": cty.ObjectVal(vars),
+		},
+	}, nil
+}
+
+// MergeEvalContexts returns an hcl.EvalContext with the variables and functions
+// of each of the contexts given. Where contexts share a name, the last one
+// wins.
+//
+//	secrets, err := passutil.SecretsEvalContext("/run/secrets/pass.hcl")
+//	if err != nil {
+//	    return err
+//	}
+//	ectx := passutil.MergeEvalContexts(passutil.EnvEvalContext(), secrets)
+func MergeEvalContexts(ctxs ...*hcl.EvalContext) *hcl.EvalContext {
+	merged := &hcl.EvalContext{
+		Variables: map[string]cty.Value{},
+		Functions: map[string]function.Function{},
+	}
+	for _, ctx := range ctxs {
+		if ctx == nil {
+			continue
+		}
+		for k, v := range ctx.Variables {
+			merged.Variables[k] = v
+		}
+		for k, fn := range ctx.Functions {
+			merged.Functions[k] = fn
+		}
+	}
+	return merged
+}
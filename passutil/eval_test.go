@@ -0,0 +1,44 @@
+package passutil
+
+import (
+	"os"
+	"testing"
+
+	"github.com/brettbuddin/pass"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvEvalContext(t *testing.T) {
+	os.Setenv("PASS_TEST_TOKEN", "s3cr3t")
+	defer os.Unsetenv("PASS_TEST_TOKEN")
+
+	m, err := pass.LoadManifest("../testdata/env_auth.hcl", EnvEvalContext())
+	require.NoError(t, err)
+	require.Equal(t, "s3cr3t", m.Upstreams[0].Auth.Token)
+
+	os.Unsetenv("PASS_TEST_TOKEN")
+	_, err = pass.LoadManifest("../testdata/env_auth.hcl", EnvEvalContext())
+	require.Error(t, err)
+}
+
+func TestSecretsEvalContext(t *testing.T) {
+	os.Setenv("PASS_TEST_TOKEN", "s3cr3t")
+	defer os.Unsetenv("PASS_TEST_TOKEN")
+
+	secrets, err := SecretsEvalContext("../testdata/secrets.hcl")
+	require.NoError(t, err)
+
+	m, err := pass.LoadManifest("../testdata/secret_destination.hcl", MergeEvalContexts(EnvEvalContext(), secrets))
+	require.NoError(t, err)
+	require.Equal(t, "http://widgets.internal:8080", m.Upstreams[0].Destination)
+	require.Equal(t, "s3cr3t", m.Upstreams[0].Auth.Token)
+
+	_, err = pass.LoadManifest("../testdata/secret_destination.hcl", EnvEvalContext())
+	require.Error(t, err)
+
+	_, err = SecretsEvalContext("../testdata/invalid_secrets.hcl")
+	require.Error(t, err)
+
+	_, err = SecretsEvalContext("../testdata/missing_secrets.hcl")
+	require.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package passutil
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnEvent is a change in a connection's state reported to a ConnStatsFunc.
+type ConnEvent int
+
+// Connection events.
+const (
+	ConnOpened ConnEvent = iota
+	ConnClosed
+)
+
+func (e ConnEvent) String() string {
+	switch e {
+	case ConnOpened:
+		return "opened"
+	case ConnClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// ConnStats describes a connection when it's opened or closed.
+type ConnStats struct {
+	Event        ConnEvent
+	RemoteAddr   net.Addr
+	Open         int64         // Connections open once the event has happened
+	Duration     time.Duration // How long the connection was open; zero when it's opened
+	BytesRead    int64         // Bytes read from the connection; zero when it's opened
+	BytesWritten int64         // Bytes written to the connection; zero when it's opened
+}
+
+// ConnStatsFunc is called with the ConnStats of each connection as it's
+// opened and closed. It's called on the goroutine that accepts or closes the
+// connection, so it should return quickly.
+type ConnStatsFunc func(ConnStats)
+
+// InstrumentedListener wraps a listener so that fn is called for each
+// connection it accepts, as it's opened and as it's closed. This gives
+// connection-level visibility, such as the number of open connections, to go
+// along with the request-level pass.Metrics. Bytes are counted as they pass
+// through the listener, so they include TLS records when the listener is
+// served over HTTPS.
+func InstrumentedListener(l net.Listener, fn ConnStatsFunc) net.Listener {
+	return &instrumentedListener{Listener: l, fn: fn}
+}
+
+type instrumentedListener struct {
+	net.Listener
+	fn   ConnStatsFunc
+	open int64 // Accessed atomically
+}
+
+func (l *instrumentedListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	c := &instrumentedConn{Conn: conn, listener: l, opened: time.Now()}
+	l.fn(ConnStats{
+		Event:      ConnOpened,
+		RemoteAddr: conn.RemoteAddr(),
+		Open:       atomic.AddInt64(&l.open, 1),
+	})
+	return c, nil
+}
+
+// instrumentedConn counts the bytes passing through a connection and reports
+// when it's closed.
+type instrumentedConn struct {
+	net.Conn
+	read    int64 // Accessed atomically
+	written int64 // Accessed atomically
+
+	listener *instrumentedListener
+	opened   time.Time
+	once     sync.Once
+}
+
+func (c *instrumentedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.read, int64(n))
+	return n, err
+}
+
+func (c *instrumentedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.written, int64(n))
+	return n, err
+}
+
+// Close closes the connection. It's reported the first time it's called.
+func (c *instrumentedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.listener.fn(ConnStats{
+			Event:        ConnClosed,
+			RemoteAddr:   c.Conn.RemoteAddr(),
+			Open:         atomic.AddInt64(&c.listener.open, -1),
+			Duration:     time.Since(c.opened),
+			BytesRead:    atomic.LoadInt64(&c.read),
+			BytesWritten: atomic.LoadInt64(&c.written),
+		})
+	})
+	return err
+}
@@ -0,0 +1,130 @@
+package passutil
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brettbuddin/pass"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type connRecorder struct {
+	mu    sync.Mutex
+	stats []ConnStats
+}
+
+func (r *connRecorder) record(s ConnStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stats = append(r.stats, s)
+}
+
+func (r *connRecorder) events() []ConnStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]ConnStats{}, r.stats...)
+}
+
+func TestInstrumentedListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	rec := &connRecorder{}
+	ln := InstrumentedListener(inner, rec.record)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			close(accepted)
+			return
+		}
+		accepted <- conn
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	server := <-accepted
+	require.NotNil(t, server)
+
+	events := rec.events()
+	require.Len(t, events, 1)
+	require.Equal(t, ConnOpened, events[0].Event)
+	require.Equal(t, int64(1), events[0].Open)
+	require.Equal(t, client.LocalAddr().String(), events[0].RemoteAddr.String())
+
+	_, err = client.Write([]byte("ping"))
+	require.NoError(t, err)
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(server, buf)
+	require.NoError(t, err)
+	_, err = server.Write([]byte("pong!"))
+	require.NoError(t, err)
+
+	require.NoError(t, server.Close())
+	require.Error(t, server.Close())
+
+	events = rec.events()
+	require.Len(t, events, 2)
+	require.Equal(t, ConnClosed, events[1].Event)
+	require.Equal(t, int64(0), events[1].Open)
+	require.Equal(t, int64(4), events[1].BytesRead)
+	require.Equal(t, int64(5), events[1].BytesWritten)
+	require.True(t, events[1].Duration > 0)
+}
+
+func TestServeWithListenerMetrics(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := pass.LoadManifest("../testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+	proxy, err := pass.New(m)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rec := &connRecorder{}
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, proxy, ln, WithListenerMetrics(rec.record))
+	}()
+
+	client := &http.Client{
+		Timeout:   time.Second,
+		Transport: &http.Transport{DisableKeepAlives: true},
+	}
+	resp, err := client.Get("http://" + ln.Addr().String() + "/accounts")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	require.Eventually(t, func() bool {
+		return len(rec.events()) == 2
+	}, time.Second, 10*time.Millisecond)
+	events := rec.events()
+	require.Equal(t, ConnOpened, events[0].Event)
+	require.Equal(t, ConnClosed, events[1].Event)
+	require.True(t, events[1].BytesRead > 0)
+	require.True(t, events[1].BytesWritten > 0)
+
+	cancel()
+	require.NoError(t, <-served)
+}
@@ -0,0 +1,58 @@
+package passutil
+
+import "strings"
+
+// CollapseSlashes is a path normalizer, for use with pass.WithPathNormalizer,
+// that replaces runs of slashes with a single slash.
+func CollapseSlashes(p string) string {
+	if !strings.Contains(p, "//") {
+		return p
+	}
+
+	var b strings.Builder
+	b.Grow(len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] == '/' && i > 0 && p[i-1] == '/' {
+			continue
+		}
+		b.WriteByte(p[i])
+	}
+	return b.String()
+}
+
+// CleanDotSegments is a path normalizer, for use with pass.WithPathNormalizer,
+// that resolves "." and ".." segments. Segments can't climb above the root.
+// Unlike path.Clean, other segments (including empty ones) and trailing
+// slashes are left alone.
+func CleanDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+
+	segments := strings.Split(p, "/")
+	out := make([]string, 0, len(segments))
+	for i, s := range segments {
+		last := i == len(segments)-1
+		switch s {
+		case ".":
+		case "..":
+			// Keep the leading empty segment so the result stays absolute.
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+		default:
+			out = append(out, s)
+			continue
+		}
+		// A trailing dot segment refers to a directory.
+		if last {
+			out = append(out, "")
+		}
+	}
+
+	cleaned := strings.Join(out, "/")
+	if strings.HasPrefix(p, "/") && !strings.HasPrefix(cleaned, "/") {
+		cleaned = "/" + cleaned
+	}
+	return cleaned
+}
@@ -0,0 +1,39 @@
+package passutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollapseSlashes(t *testing.T) {
+	tests := map[string]string{
+		"/":                  "/",
+		"//":                 "/",
+		"/widgets":           "/widgets",
+		"//widgets//1///":    "/widgets/1/",
+		"/widgets/./1":       "/widgets/./1",
+		"/widgets//../gears": "/widgets/../gears",
+	}
+	for in, expect := range tests {
+		require.Equal(t, expect, CollapseSlashes(in), in)
+	}
+}
+
+func TestCleanDotSegments(t *testing.T) {
+	tests := map[string]string{
+		"/":                   "/",
+		"/widgets":            "/widgets",
+		"/widgets/./1":        "/widgets/1",
+		"/widgets/../gears":   "/gears",
+		"/widgets/1/..":       "/widgets/",
+		"/widgets/1/.":        "/widgets/1/",
+		"/../../widgets":      "/widgets",
+		"/widgets//../gears":  "/widgets/gears",
+		"/widgets/v1.2/":      "/widgets/v1.2/",
+		"/widgets/.hidden/..": "/widgets/",
+	}
+	for in, expect := range tests {
+		require.Equal(t, expect, CleanDotSegments(in), in)
+	}
+}
@@ -0,0 +1,221 @@
+package passutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/brettbuddin/pass"
+)
+
+// Defaults for the http.Server created by Serve.
+const (
+	DefaultReadHeaderTimeout = 10 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+	DefaultShutdownTimeout   = 30 * time.Second
+)
+
+// ServeOption is a functional option used when serving a Proxy with Serve.
+type ServeOption func(*serveConfig)
+
+// WithTLS serves HTTPS using the certificate and key in the given files.
+func WithTLS(certFile, keyFile string) ServeOption {
+	return func(c *serveConfig) {
+		c.certFile = certFile
+		c.keyFile = keyFile
+	}
+}
+
+// WithTLSConfig serves HTTPS using the given tls.Config, which must provide
+// certificates through its Certificates or GetCertificate fields. Use it for
+// certificates that are managed automatically, such as those from an ACME
+// client like golang.org/x/crypto/acme/autocert:
+//
+//	passutil.Serve(proxy, ":443", passutil.WithTLSConfig(manager.TLSConfig()))
+func WithTLSConfig(cfg *tls.Config) ServeOption {
+	return func(c *serveConfig) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithHTTPRedirect also listens for plain HTTP on addr and redirects every
+// request there to the same URL over HTTPS. It's only useful when serving
+// HTTPS.
+func WithHTTPRedirect(addr string) ServeOption {
+	return func(c *serveConfig) {
+		c.redirectAddr = addr
+	}
+}
+
+// WithReadHeaderTimeout specifies how long clients have to send request
+// headers. It defaults to DefaultReadHeaderTimeout.
+func WithReadHeaderTimeout(d time.Duration) ServeOption {
+	return func(c *serveConfig) {
+		c.readHeaderTimeout = d
+	}
+}
+
+// WithIdleTimeout specifies how long idle keep-alive connections are kept
+// open. It defaults to DefaultIdleTimeout.
+func WithIdleTimeout(d time.Duration) ServeOption {
+	return func(c *serveConfig) {
+		c.idleTimeout = d
+	}
+}
+
+// WithShutdownTimeout specifies how long requests in flight have to finish
+// once shutdown begins. It defaults to DefaultShutdownTimeout.
+func WithShutdownTimeout(d time.Duration) ServeOption {
+	return func(c *serveConfig) {
+		c.shutdownTimeout = d
+	}
+}
+
+// WithListenerMetrics reports the connections the server accepts to fn, as
+// they're opened and closed, using InstrumentedListener.
+func WithListenerMetrics(fn ConnStatsFunc) ServeOption {
+	return func(c *serveConfig) {
+		c.connStats = fn
+	}
+}
+
+// serveConfig contains realized configuration for Serve.
+type serveConfig struct {
+	certFile          string
+	keyFile           string
+	tlsConfig         *tls.Config
+	redirectAddr      string
+	readHeaderTimeout time.Duration
+	idleTimeout       time.Duration
+	shutdownTimeout   time.Duration
+	connStats         ConnStatsFunc
+}
+
+// Serve serves a Proxy on addr until the process receives SIGINT or SIGTERM.
+// It then stops accepting connections and waits for requests in flight to
+// finish, up to the shutdown timeout, before returning. Unlike
+// http.ListenAndServe, the server has timeouts that keep slow or idle clients
+// from holding connections open indefinitely.
+func Serve(proxy *pass.Proxy, addr string, opts ...ServeOption) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return serve(ctx, proxy, ln, opts...)
+}
+
+// ServeTLSFiles serves a Proxy over HTTPS on addr, using the certificate and
+// key in the given files, until the process receives SIGINT or SIGTERM. It's
+// shorthand for Serve with WithTLS.
+func ServeTLSFiles(proxy *pass.Proxy, addr, certFile, keyFile string, opts ...ServeOption) error {
+	return Serve(proxy, addr, append(opts, WithTLS(certFile, keyFile))...)
+}
+
+// serve serves a Proxy on a listener until the context is done, and then shuts
+// down gracefully.
+func serve(ctx context.Context, proxy *pass.Proxy, ln net.Listener, opts ...ServeOption) error {
+	cfg := serveConfig{
+		readHeaderTimeout: DefaultReadHeaderTimeout,
+		idleTimeout:       DefaultIdleTimeout,
+		shutdownTimeout:   DefaultShutdownTimeout,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if cfg.connStats != nil {
+		ln = InstrumentedListener(ln, cfg.connStats)
+	}
+
+	srv := &http.Server{
+		Handler:           proxy,
+		ReadHeaderTimeout: cfg.readHeaderTimeout,
+		IdleTimeout:       cfg.idleTimeout,
+		TLSConfig:         cfg.tlsConfig,
+	}
+	servers := []*http.Server{srv}
+
+	var redirectLn net.Listener
+	if cfg.redirectAddr != "" {
+		var err error
+		redirectLn, err = net.Listen("tcp", cfg.redirectAddr)
+		if err != nil {
+			ln.Close()
+			return err
+		}
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		servers = append(servers, &http.Server{
+			Handler:           redirectHTTPS(port),
+			ReadHeaderTimeout: cfg.readHeaderTimeout,
+			IdleTimeout:       cfg.idleTimeout,
+		})
+	}
+
+	errs := make(chan error, len(servers))
+	go func() {
+		if cfg.certFile != "" || cfg.keyFile != "" || cfg.tlsConfig != nil {
+			errs <- srv.ServeTLS(ln, cfg.certFile, cfg.keyFile)
+			return
+		}
+		errs <- srv.Serve(ln)
+	}()
+	if redirectLn != nil {
+		go func() {
+			errs <- servers[1].Serve(redirectLn)
+		}()
+	}
+
+	var serveErr error
+	select {
+	case serveErr = <-errs:
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+	defer cancel()
+	for _, s := range servers {
+		if err := s.Shutdown(shutdownCtx); err != nil && serveErr == nil {
+			serveErr = err
+		}
+	}
+	if serveErr != nil {
+		return serveErr
+	}
+	for range servers {
+		if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+	}
+	return nil
+}
+
+// redirectHTTPS returns a handler that redirects requests to the same URL over
+// HTTPS on the given port.
+func redirectHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		// Only GET and HEAD can be safely redirected with 301; 308 keeps the
+		// method and body of other requests.
+		status := http.StatusPermanentRedirect
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			status = http.StatusMovedPermanently
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
+}
@@ -0,0 +1,121 @@
+package passutil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brettbuddin/pass"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestServe(t *testing.T) {
+	started := make(chan struct{})
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := pass.LoadManifest("../testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+	proxy, err := pass.New(m)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, proxy, ln, WithShutdownTimeout(time.Second))
+	}()
+
+	// A request in flight when shutdown begins is allowed to finish.
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/accounts")
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-started
+	cancel()
+
+	require.Equal(t, http.StatusOK, <-status)
+	require.NoError(t, <-served)
+
+	_, err = http.Get("http://" + ln.Addr().String() + "/accounts")
+	require.Error(t, err)
+}
+
+func TestServeTLS(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := pass.LoadManifest("../testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+	proxy, err := pass.New(m)
+	require.NoError(t, err)
+
+	// Borrow httptest's certificate, which its client trusts.
+	certs := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certs.Close()
+	client := certs.Client()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, proxy, ln, WithTLSConfig(certs.TLS.Clone()), WithHTTPRedirect("127.0.0.1:0"))
+	}()
+
+	resp, err := client.Get("https://" + ln.Addr().String() + "/accounts")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	require.NoError(t, <-served)
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		method   string
+		target   string
+		port     string
+		status   int
+		location string
+	}{
+		{"GET", "http://example.com/accounts?id=1", "443", http.StatusMovedPermanently, "https://example.com/accounts?id=1"},
+		{"GET", "http://example.com:8080/accounts", "8443", http.StatusMovedPermanently, "https://example.com:8443/accounts"},
+		{"POST", "http://example.com/accounts", "443", http.StatusPermanentRedirect, "https://example.com/accounts"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		redirectHTTPS(tt.port).ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+		require.Equal(t, tt.status, w.Code, tt.target)
+		require.Equal(t, tt.location, w.Header().Get("Location"), tt.target)
+	}
+}
@@ -0,0 +1,61 @@
+package pass
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi"
+)
+
+// addRedirectPrefix records a prefix that WithPrefixRedirect can redirect
+// unprefixed requests to.
+func (rt *routing) addRedirectPrefix(prefix string) {
+	if prefix == "" || prefix == "/" {
+		return
+	}
+	for _, p := range rt.redirectPrefixes {
+		if p == prefix {
+			return
+		}
+	}
+	rt.redirectPrefixes = append(rt.redirectPrefixes, prefix)
+	sort.Slice(rt.redirectPrefixes, func(i, j int) bool {
+		return len(rt.redirectPrefixes[i]) > len(rt.redirectPrefixes[j])
+	})
+}
+
+// redirectToPrefix redirects a request that no route matched to the same path
+// under a prefix, if a route matches it there. It reports false if there's no
+// such route.
+func (rt *routing) redirectToPrefix(w http.ResponseWriter, r *http.Request) bool {
+	for _, prefix := range rt.redirectPrefixes {
+		if r.URL.Path == prefix || strings.HasPrefix(r.URL.Path, prefix+"/") {
+			continue
+		}
+
+		// Routing starts afresh, rather than from the router's state for
+		// the original request.
+		var m RouteMatch
+		ctx := context.WithValue(r.Context(), chi.RouteCtxKey, nil)
+		pr := r.Clone(context.WithValue(ctx, matchOnlyKey{}, &m))
+		pr.URL.Path = prefix + r.URL.Path
+		pr.URL.RawPath = ""
+		rt.router.ServeHTTP(&discardResponseWriter{header: http.Header{}}, pr)
+		if m.Upstream == "" {
+			continue
+		}
+
+		to := *r.URL
+		to.Path = pr.URL.Path
+		to.RawPath = ""
+		status := http.StatusMovedPermanently
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
+		}
+		http.Redirect(w, r, to.RequestURI(), status)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package pass
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestPrefixRedirect(t *testing.T) {
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal("http://accounts.local"),
+		},
+	}
+	m, err := LoadManifest("testdata/routing.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithPrefixRedirect())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{"bare path", http.MethodGet, "/accounts", http.StatusMovedPermanently, "/api/v2/private/accounts"},
+		{"bare path with params", http.MethodGet, "/accounts/123?expand=true", http.StatusMovedPermanently, "/api/v2/private/accounts/123?expand=true"},
+		{"unknown path", http.MethodGet, "/widgets", http.StatusNotFound, ""},
+		{"unknown path under prefix", http.MethodGet, "/api/v2/private/widgets", http.StatusNotFound, ""},
+		{"method not routed", http.MethodPost, "/accounts", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.location, w.Header().Get("Location"))
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
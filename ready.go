@@ -0,0 +1,136 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+)
+
+// ReadinessPolicy decides whether a Proxy is ready to serve from the health of
+// its Upstreams. See WithReadinessPolicy.
+type ReadinessPolicy struct {
+	any      bool
+	critical []string
+}
+
+// ReadyWhenAllHealthy is a ReadinessPolicy under which the Proxy is ready only
+// while every Upstream is healthy. It's the default.
+func ReadyWhenAllHealthy() ReadinessPolicy {
+	return ReadinessPolicy{}
+}
+
+// ReadyWhenAnyHealthy is a ReadinessPolicy under which the Proxy is ready while
+// at least one Upstream is healthy.
+func ReadyWhenAnyHealthy() ReadinessPolicy {
+	return ReadinessPolicy{any: true}
+}
+
+// ReadyWhenHealthy is a ReadinessPolicy under which the Proxy is ready while
+// each of the critical Upstreams is healthy, regardless of the others.
+func ReadyWhenHealthy(critical ...string) ReadinessPolicy {
+	return ReadinessPolicy{critical: critical}
+}
+
+// ready applies the policy to the Upstreams of a routing.
+func (p ReadinessPolicy) ready(rt *routing) bool {
+	if len(p.critical) > 0 {
+		for _, id := range p.critical {
+			if !rt.healthy(id) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, u := range rt.manifest.Upstreams {
+		healthy := rt.healthy(u.Identifier)
+		if p.any && healthy {
+			return true
+		}
+		if !p.any && !healthy {
+			return false
+		}
+	}
+	return !p.any
+}
+
+// healthy reports whether the Upstream is enabled and hasn't been reported
+// unhealthy.
+func (s *upstreamState) healthy() bool {
+	return s.enabled() && atomic.LoadInt32(&s.unhealthy) == 0
+}
+
+// healthy reports whether an Upstream is healthy and has a destination that
+// hasn't been reported unhealthy.
+func (rt *routing) healthy(identifier string) bool {
+	state := rt.upstreams[identifier]
+	return state.healthy() && state.health.anyHealthy(rt.destinations[identifier])
+}
+
+// SetUpstreamHealthy records the result of checking an Upstream's health, for
+// use by Ready. Upstreams are healthy until reported otherwise. Requests routed
+// to an unhealthy Upstream are handled as WithNoHealthyDestinations says. The
+// result survives reloads that keep the Upstream's identifier.
+func (p *Proxy) SetUpstreamHealthy(identifier string, healthy bool) error {
+	state, ok := p.current().upstreams[identifier]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownUpstream, identifier)
+	}
+
+	var unhealthy int32
+	if !healthy {
+		unhealthy = 1
+	}
+	atomic.StoreInt32(&state.unhealthy, unhealthy)
+	return nil
+}
+
+// SetDestinationHealthy records the result of checking one of an Upstream's
+// destinations, identified as with DestinationHealthy. An Upstream is
+// unhealthy once all of its destinations are. The result survives reloads
+// that keep the Upstream and destination identifiers.
+func (p *Proxy) SetDestinationHealthy(upstream, destination string, healthy bool) error {
+	state, err := p.current().destinationState(upstream, destination)
+	if err != nil {
+		return err
+	}
+	state.health.set(destination, healthy)
+	return nil
+}
+
+// destinationState returns the state of an Upstream after checking that it
+// has the destination.
+func (rt *routing) destinationState(upstream, destination string) (*upstreamState, error) {
+	state, ok := rt.upstreams[upstream]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownUpstream, upstream)
+	}
+	for _, d := range rt.destinations[upstream] {
+		if d.identifier == destination {
+			return state, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %q in %q", ErrUnknownDestination, destination, upstream)
+}
+
+// Ready reports whether the Proxy is ready to serve according to its
+// ReadinessPolicy. An Upstream counts as healthy unless it's disabled with
+// SetUpstreamEnabled, reported unhealthy with SetUpstreamHealthy, or all of
+// its destinations are reported unhealthy with SetDestinationHealthy.
+func (p *Proxy) Ready() bool {
+	rt := p.current()
+	return rt.readiness.ready(rt)
+}
+
+// ReadyHandler returns a handler for readiness probes, such as Kubernetes'. It
+// responds with 200 OK while the Proxy is Ready and 503 Service Unavailable
+// otherwise.
+func (p *Proxy) ReadyHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.Ready() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ready\n"))
+	}
+}
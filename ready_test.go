@@ -0,0 +1,78 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestReady(t *testing.T) {
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary":   cty.StringVal("http://primary.local"),
+			"secondary": cty.StringVal("http://secondary.local"),
+		},
+	}
+	m, err := LoadManifest("testdata/fallback.hcl", ectx)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		policy    ReadinessPolicy
+		unhealthy []string
+		disabled  []string
+		ready     bool
+	}{
+		{"all healthy", ReadyWhenAllHealthy(), nil, nil, true},
+		{"one unhealthy", ReadyWhenAllHealthy(), []string{"secondary"}, nil, false},
+		{"one disabled", ReadyWhenAllHealthy(), nil, []string{"secondary"}, false},
+		{"any with one healthy", ReadyWhenAnyHealthy(), []string{"primary"}, nil, true},
+		{"any with none healthy", ReadyWhenAnyHealthy(), []string{"primary"}, []string{"secondary"}, false},
+		{"critical healthy", ReadyWhenHealthy("primary"), []string{"secondary"}, nil, true},
+		{"critical unhealthy", ReadyWhenHealthy("primary"), []string{"primary"}, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := New(m, WithReadinessPolicy(tt.policy))
+			require.NoError(t, err)
+			for _, id := range tt.unhealthy {
+				require.NoError(t, proxy.SetUpstreamHealthy(id, false))
+			}
+			for _, id := range tt.disabled {
+				require.NoError(t, proxy.SetUpstreamEnabled(id, false))
+			}
+			require.Equal(t, tt.ready, proxy.Ready())
+
+			w := httptest.NewRecorder()
+			proxy.ReadyHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if tt.ready {
+				require.Equal(t, http.StatusOK, w.Code)
+			} else {
+				require.Equal(t, http.StatusServiceUnavailable, w.Code)
+			}
+		})
+	}
+
+	t.Run("recovers", func(t *testing.T) {
+		proxy, err := New(m)
+		require.NoError(t, err)
+		require.NoError(t, proxy.SetUpstreamHealthy("primary", false))
+		require.False(t, proxy.Ready())
+		require.NoError(t, proxy.SetUpstreamHealthy("primary", true))
+		require.True(t, proxy.Ready())
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		_, err := New(m, WithReadinessPolicy(ReadyWhenHealthy("unknown")))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+
+		proxy, err := New(m)
+		require.NoError(t, err)
+		require.True(t, errors.Is(proxy.SetUpstreamHealthy("unknown", false), ErrUnknownUpstream))
+	})
+}
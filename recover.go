@@ -0,0 +1,41 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+)
+
+// ErrPanic is passed to the ErrorHandler when a request is recovered from a
+// panic by WithRecovery's default handler.
+var ErrPanic = fmt.Errorf("panic serving request")
+
+// RecoveryHandler responds to a request whose handling panicked. It's given the
+// value passed to panic.
+type RecoveryHandler func(http.ResponseWriter, *http.Request, interface{})
+
+// recoverPanics is middleware that recovers from panics in the handlers and
+// middleware it wraps. Panics with http.ErrAbortHandler are left for the
+// http.Server, which uses them to abort responses that are already underway.
+func recoverPanics(cfg mountConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				rec := recover()
+				if rec == nil {
+					return
+				}
+				if rec == http.ErrAbortHandler {
+					panic(rec)
+				}
+				if cfg.recovery != nil {
+					cfg.recovery(w, r, rec)
+					return
+				}
+				cfg.errorLog.Printf("http: panic serving %s: %v\n%s", r.URL.Path, rec, debug.Stack())
+				serveError(w, r, cfg, fmt.Errorf("%w: %v", ErrPanic, rec), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package pass
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRecovery(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/routing.hcl", ectx)
+	require.NoError(t, err)
+
+	panics := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("panic") != "" {
+				panic("boom")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+
+	t.Run("recovery handler", func(t *testing.T) {
+		var recovered interface{}
+		recovery := func(w http.ResponseWriter, r *http.Request, rec interface{}) {
+			recovered = rec
+			w.WriteHeader(http.StatusTeapot)
+		}
+		proxy, err := New(m, WithUpstreamMiddleware("accounts", panics), WithRecovery(recovery))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/api/v2/private/accounts?panic=1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusTeapot, resp.StatusCode)
+		require.Equal(t, "boom", recovered)
+
+		// The server is still up.
+		resp, err = client.Get(server.URL + "/api/v2/private/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("default", func(t *testing.T) {
+		var logs bytes.Buffer
+		var handled error
+		errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		proxy, err := New(m,
+			WithUpstreamMiddleware("accounts", panics),
+			WithRecovery(nil),
+			WithErrorLog(log.New(&logs, "", 0)),
+			WithErrorHandler(errorHandler),
+		)
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/api/v2/private/accounts?panic=1")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		require.True(t, errors.Is(handled, ErrPanic))
+		require.Contains(t, logs.String(), "boom")
+		require.Contains(t, logs.String(), "goroutine")
+	})
+}
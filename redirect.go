@@ -0,0 +1,27 @@
+package pass
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi"
+)
+
+// redirectParam matches the path parameters in a Redirect's target.
+var redirectParam = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// redirectHandler answers requests with a Redirect. Path parameters in the
+// target are replaced with the values captured from the request's path; "{*}"
+// is replaced with whatever a trailing wildcard matched.
+func redirectHandler(redirect Redirect) http.Handler {
+	status := redirect.Status
+	if status == 0 {
+		status = http.StatusMovedPermanently
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		to := redirectParam.ReplaceAllStringFunc(redirect.To, func(param string) string {
+			return chi.URLParam(r, param[1:len(param)-1])
+		})
+		http.Redirect(w, r, to, status)
+	})
+}
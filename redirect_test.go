@@ -0,0 +1,44 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedirect(t *testing.T) {
+	m, err := LoadManifest("testdata/redirect.hcl", nil)
+	require.NoError(t, err)
+	proxy, err := New(m)
+	require.NoError(t, err)
+
+	tests := []struct {
+		method   string
+		path     string
+		status   int
+		location string
+	}{
+		{"GET", "/widgets/42", http.StatusMovedPermanently, "https://widgets.example.com/v2/widgets/42"},
+		{"GET", "/docs/guides/routing", http.StatusPermanentRedirect, "https://docs.example.com/guides/routing"},
+		{"POST", "/docs/faq", http.StatusPermanentRedirect, "https://docs.example.com/faq"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		require.Equal(t, tt.status, w.Code, tt.path)
+		require.Equal(t, tt.location, w.Header().Get("Location"), tt.path)
+	}
+}
+
+func TestRedirectValidation(t *testing.T) {
+	_, err := LoadManifest("testdata/conflicting_redirect.hcl", nil)
+	require.True(t, errors.Is(err, ErrConflictingRedirect))
+
+	m, err := LoadManifest("testdata/redirect.hcl", nil)
+	require.NoError(t, err)
+	m.Upstreams[0].Redirect.Status = http.StatusOK
+	require.True(t, errors.Is(m.Validate(), ErrInvalidRedirect))
+}
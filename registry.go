@@ -0,0 +1,40 @@
+package pass
+
+import "sync"
+
+// Registry assembles a Manifest from Upstreams registered in code, such as
+// those loaded from a database, instead of from HCL. Upstreams are checked as
+// they're registered, with the same guarantees as LoadManifest. It's safe for
+// concurrent use.
+type Registry struct {
+	mu sync.Mutex
+	m  Manifest
+}
+
+// NewRegistry returns an empty Registry whose Manifests have the prefix path.
+func NewRegistry(prefixPath string) *Registry {
+	return &Registry{m: Manifest{PrefixPath: prefixPath}}
+}
+
+// RegisterUpstream adds an Upstream to the Registry. See Manifest.AddUpstream.
+func (r *Registry) RegisterUpstream(u Upstream) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.m.AddUpstream(u)
+}
+
+// Manifest returns a Manifest with the Upstreams registered so far, in the
+// order they were registered. Upstreams registered later aren't added to it,
+// so it can be given to New or Proxy.Reload while registration continues.
+func (r *Registry) Manifest() *Manifest {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m := &Manifest{
+		Annotations: map[string]string{},
+		Upstreams:   append([]Upstream{}, r.m.Upstreams...),
+		PrefixPath:  r.m.PrefixPath,
+	}
+	m.index()
+	return m
+}
@@ -0,0 +1,108 @@
+package pass
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestAddUpstream(t *testing.T) {
+	upstream := func(id string) Upstream {
+		return Upstream{
+			Identifier:  id,
+			Destination: "http://" + id + ".local",
+			Routes:      []Route{{Methods: []string{http.MethodGet}, Path: "/" + id}},
+		}
+	}
+
+	t.Run("adding", func(t *testing.T) {
+		m := &Manifest{}
+		require.NoError(t, m.AddUpstream(upstream("widgets")))
+		require.Len(t, m.Upstreams, 1)
+		require.NotNil(t, m.Annotations)
+		require.NotNil(t, m.Upstreams[0].Annotations)
+		require.NoError(t, m.Validate())
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		m := &Manifest{}
+		require.NoError(t, m.AddUpstream(upstream("widgets")))
+		err := m.AddUpstream(upstream("widgets"))
+		require.True(t, errors.Is(err, ErrDuplicateUpstreamIdentifier))
+		require.Len(t, m.Upstreams, 1)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		m := &Manifest{}
+		u := upstream("widgets")
+		u.Destination = ""
+		require.True(t, errors.Is(m.AddUpstream(u), ErrMissingDestination))
+
+		u = upstream("widgets")
+		u.TimeoutMS = -1
+		require.True(t, errors.Is(m.AddUpstream(u), ErrInvalidTimeout))
+		require.Empty(t, m.Upstreams)
+	})
+
+	t.Run("index", func(t *testing.T) {
+		m := &Manifest{}
+		for i := 0; i < 20; i++ {
+			require.NoError(t, m.AddUpstream(upstream(fmt.Sprintf("u%d", i))))
+		}
+		require.Len(t, m.upstreamIndex, len(m.Upstreams))
+		for i := range m.Upstreams {
+			require.True(t, m.upstreamIndex[m.Upstreams[i].Identifier] == &m.Upstreams[i])
+		}
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("X-Upstream"))
+	}))
+	defer destination.Close()
+
+	r := NewRegistry("/api")
+	require.NoError(t, r.RegisterUpstream(Upstream{
+		Identifier:  "accounts",
+		Destination: destination.URL,
+		Routes:      []Route{{Methods: []string{http.MethodGet}, Path: "/accounts"}},
+	}))
+	require.True(t, errors.Is(r.RegisterUpstream(Upstream{Identifier: "accounts", Destination: destination.URL}), ErrDuplicateUpstreamIdentifier))
+
+	m := r.Manifest()
+	require.NoError(t, r.RegisterUpstream(Upstream{
+		Identifier:  "widgets",
+		Destination: destination.URL,
+		Routes:      []Route{{Methods: []string{http.MethodGet}, Path: "/widgets"}},
+	}))
+	require.Len(t, m.Upstreams, 1)
+	require.Len(t, r.Manifest().Upstreams, 2)
+
+	// Options that refer to Upstreams by identifier can be used, as they can
+	// with a loaded Manifest.
+	proxy, err := New(r.Manifest(), WithUpstreamDirector("widgets", func(r *http.Request) {
+		r.Header.Set("X-Upstream", "widgets")
+	}))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	resp, err := client.Get(server.URL + "/api/widgets")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "widgets", string(b))
+
+	resp, err = client.Get(server.URL + "/api/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,52 @@
+package pass
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// DefaultRequestIDHeader is the header used for request IDs if one isn't
+// specified.
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// requestIDKey is the context key for a request's ID.
+type requestIDKey struct{}
+
+// requestID is middleware that makes sure each request has an ID. The ID is
+// taken from the header if the client sent one, or generated otherwise. It's
+// set on the request that's proxied upstream and echoed on the response.
+func requestID(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if id == "" {
+				id = newUUID()
+				r.Header.Set(header, id)
+			}
+			w.Header().Set(header, id)
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequestIDFromContext returns the ID of a request from its context. IDs are
+// only present when the Proxy was created with WithRequestID.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// newUUID generates a random (version 4) UUID.
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("generating request id: %s", err))
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // Variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
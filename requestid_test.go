@@ -0,0 +1,76 @@
+package pass
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRequestID(t *testing.T) {
+	var upstreamID string
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamID = r.Header.Get("X-Trace-Id")
+		w.Header().Set("X-Trace-Id", upstreamID)
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	var observedID string
+	observe := func(r *http.Request, info *RouteInfo) {
+		observedID, _ = RequestIDFromContext(r.Context())
+	}
+	proxy, err := New(m, WithRequestID("X-Trace-Id"), WithObserveFunction(observe))
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	t.Run("generated", func(t *testing.T) {
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		id := resp.Header.Get("X-Trace-Id")
+		require.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), id)
+		require.Len(t, resp.Header.Values("X-Trace-Id"), 1)
+		require.Equal(t, id, upstreamID)
+		require.Equal(t, id, observedID)
+	})
+
+	t.Run("propagated", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/accounts", nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Trace-Id", "abc123")
+
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, []string{"abc123"}, resp.Header.Values("X-Trace-Id"))
+		require.Equal(t, "abc123", upstreamID)
+		require.Equal(t, "abc123", observedID)
+	})
+
+	t.Run("default header", func(t *testing.T) {
+		proxy, err := New(m, WithRequestID(""))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.NotEmpty(t, resp.Header.Get(DefaultRequestIDHeader))
+	})
+}
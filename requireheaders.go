@@ -0,0 +1,27 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrMissingRequiredHeader is passed to the ErrorHandler when a request lacks
+// one of its route's require_headers, or the header is empty.
+var ErrMissingRequiredHeader = fmt.Errorf("missing required header")
+
+// requireHeaders is middleware that rejects requests missing any of the
+// headers, or with only whitespace as their value, with the status.
+func requireHeaders(headers []string, status int, cfg mountConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, h := range headers {
+				if strings.TrimSpace(r.Header.Get(h)) == "" {
+					serveError(w, r, cfg, fmt.Errorf("%w: %q", ErrMissingRequiredHeader, h), status)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
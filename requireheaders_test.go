@@ -0,0 +1,69 @@
+package pass
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRequireHeaders(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/require_headers.hcl", ectx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"X-Api-Version", "X-Tenant"}, m.Upstreams[0].Routes[0].RequireHeaders)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		options []MountOption
+		status  int
+	}{
+		{"present", http.MethodPost, map[string]string{"X-Api-Version": "2", "X-Tenant": "acme"}, nil, http.StatusOK},
+		{"missing", http.MethodPost, map[string]string{"X-Api-Version": "2"}, nil, http.StatusBadRequest},
+		{"empty", http.MethodPost, map[string]string{"X-Api-Version": " ", "X-Tenant": "acme"}, nil, http.StatusBadRequest},
+		{"other route", http.MethodGet, nil, nil, http.StatusOK},
+		{"configured status", http.MethodPost, nil, []MountOption{WithRequiredHeaderStatus(http.StatusPreconditionFailed)}, http.StatusPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := New(m, tt.options...)
+			require.NoError(t, err)
+
+			r := httptest.NewRequest(tt.method, "/widgets", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+		})
+	}
+
+	t.Run("error handler", func(t *testing.T) {
+		var handled error
+		proxy, err := New(m, WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+			handled = err
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodPost, "/widgets", nil)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusTeapot, w.Code)
+		require.True(t, errors.Is(handled, ErrMissingRequiredHeader))
+	})
+}
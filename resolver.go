@@ -0,0 +1,127 @@
+package pass
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrDestinationResolution is passed to the ErrorHandler when the
+// DestinationResolver fails to resolve an Upstream's destination.
+var ErrDestinationResolution = fmt.Errorf("destination resolution failed")
+
+// DefaultDestinationResolverTTL is how long a destination returned by a
+// DestinationResolver is used for, unless WithDestinationResolverTTL says
+// otherwise.
+const DefaultDestinationResolverTTL = 5 * time.Second
+
+// maxResolvedDestinations is the number of resolved destinations whose proxies,
+// and their idle connections, are kept for reuse.
+const maxResolvedDestinations = 16
+
+// DestinationResolver is a function that resolves the destination of an
+// Upstream, in the same form as Upstream.Destination, when requests are
+// proxied.
+type DestinationResolver func(u Upstream) (string, error)
+
+// resolvingPicker picks the destination returned by a DestinationResolver. The
+// destination is cached for the TTL.
+type resolvingPicker struct {
+	resolve DestinationResolver
+	ttl     time.Duration
+	build   func(destination string) (*destinationProxy, error)
+	u       Upstream
+	cfg     mountConfig
+	flights singleflight.Group // Resolutions while there's no destination cached
+
+	mu         sync.Mutex
+	current    *destinationProxy
+	expires    time.Time
+	refreshing bool                         // Whether a request is resolving the expired destination
+	proxies    map[string]*destinationProxy // Keyed by destination
+}
+
+func newResolvingPicker(resolve DestinationResolver, ttl time.Duration, u Upstream, state *upstreamState, prefix string, cfg mountConfig) picker {
+	p := &resolvingPicker{
+		resolve: resolve,
+		ttl:     ttl,
+		u:       u,
+		cfg:     cfg,
+		proxies: map[string]*destinationProxy{},
+		build: func(destination string) (*destinationProxy, error) {
+			return newDestinationProxy("", destination, u, state, prefix, cfg)
+		},
+	}
+	return func(_ http.ResponseWriter, r *http.Request) (*destinationProxy, error) {
+		return p.pick(r)
+	}
+}
+
+// pick returns the cached destination. Once it has expired, one request
+// resolves it again while the others keep using it. If that fails, the stale
+// destination is used for another TTL and the error is logged. Until a
+// destination has been resolved, requests share a single resolution and fail
+// along with it.
+func (p *resolvingPicker) pick(r *http.Request) (*destinationProxy, error) {
+	p.mu.Lock()
+	stale := p.current
+	if stale != nil && (p.refreshing || time.Now().Before(p.expires)) {
+		p.mu.Unlock()
+		return stale, nil
+	}
+	p.refreshing = stale != nil
+	p.mu.Unlock()
+
+	if stale == nil {
+		v, err, _ := p.flights.Do("", func() (interface{}, error) {
+			return p.refresh()
+		})
+		if err != nil {
+			return nil, err
+		}
+		return v.(*destinationProxy), nil
+	}
+
+	dest, err := p.refresh()
+	p.mu.Lock()
+	p.refreshing = false
+	if err != nil {
+		p.expires = time.Now().Add(p.ttl)
+	}
+	p.mu.Unlock()
+	if err != nil {
+		logUpstreamError(p.cfg, p.u.Identifier, r, "destination resolution failed, using stale destination", err, "destination", stale.url)
+		return stale, nil
+	}
+	return dest, nil
+}
+
+// refresh resolves the destination and caches it for the TTL.
+func (p *resolvingPicker) refresh() (*destinationProxy, error) {
+	// Resolve without holding the lock so a slow resolver doesn't hold up
+	// requests that could be using a cached destination.
+	destination, err := p.resolve(p.u)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q: %v", ErrDestinationResolution, p.u.Identifier, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dest, ok := p.proxies[destination]
+	if !ok {
+		dest, err = p.build(destination)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrDestinationResolution, p.u.Identifier, err)
+		}
+		if len(p.proxies) >= maxResolvedDestinations {
+			p.proxies = map[string]*destinationProxy{}
+		}
+		p.proxies[destination] = dest
+	}
+	p.current = dest
+	p.expires = time.Now().Add(p.ttl)
+	return dest, nil
+}
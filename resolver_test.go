@@ -0,0 +1,184 @@
+package pass
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDestinationResolver(t *testing.T) {
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "blue")
+	}))
+	defer blue.Close()
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "green")
+	}))
+	defer green.Close()
+
+	m, err := LoadManifest("testdata/resolver.hcl", nil)
+	require.NoError(t, err)
+
+	var (
+		mu          sync.Mutex
+		destination string
+		resolveErr  error
+		resolved    []string
+	)
+	resolver := func(u Upstream) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		resolved = append(resolved, u.Destination)
+		return destination, resolveErr
+	}
+	set := func(d string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		destination, resolveErr = d, err
+	}
+
+	get := func(t *testing.T, proxy *Proxy) (int, string) {
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/widgets")
+		require.NoError(t, err)
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	t.Run("every request", func(t *testing.T) {
+		proxy, err := New(m, WithDestinationResolver(resolver), WithDestinationResolverTTL(0))
+		require.NoError(t, err)
+
+		set(blue.URL, nil)
+		_, body := get(t, proxy)
+		require.Equal(t, "blue", body)
+
+		set(green.URL, nil)
+		_, body = get(t, proxy)
+		require.Equal(t, "green", body)
+		require.Equal(t, "widgets.service.consul", resolved[0])
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		proxy, err := New(m, WithDestinationResolver(resolver), WithDestinationResolverTTL(time.Hour))
+		require.NoError(t, err)
+
+		set(blue.URL, nil)
+		_, body := get(t, proxy)
+		require.Equal(t, "blue", body)
+
+		set(green.URL, nil)
+		_, body = get(t, proxy)
+		require.Equal(t, "blue", body)
+	})
+
+	t.Run("resolution error", func(t *testing.T) {
+		set("", fmt.Errorf("no healthy instances"))
+
+		proxy, err := New(m, WithDestinationResolver(resolver))
+		require.NoError(t, err)
+		status, _ := get(t, proxy)
+		require.Equal(t, http.StatusBadGateway, status)
+
+		var captured error
+		errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+			captured = err
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		proxy, err = New(m, WithDestinationResolver(resolver), WithErrorHandler(errorHandler))
+		require.NoError(t, err)
+		status, _ = get(t, proxy)
+		require.Equal(t, http.StatusServiceUnavailable, status)
+		require.True(t, errors.Is(captured, ErrDestinationResolution))
+
+		// Destinations that can't be proxied to are resolution errors too.
+		set("widgets.local", nil)
+		status, _ = get(t, proxy)
+		require.Equal(t, http.StatusServiceUnavailable, status)
+		require.True(t, errors.Is(captured, ErrDestinationResolution))
+	})
+
+	t.Run("stale destination", func(t *testing.T) {
+		var buf bytes.Buffer
+		proxy, err := New(m,
+			WithDestinationResolver(resolver),
+			WithDestinationResolverTTL(0),
+			WithErrorLog(log.New(&buf, "", 0)),
+		)
+		require.NoError(t, err)
+
+		set(blue.URL, nil)
+		_, body := get(t, proxy)
+		require.Equal(t, "blue", body)
+
+		// The destination resolved last is used while resolution fails.
+		set("", fmt.Errorf("no healthy instances"))
+		status, body := get(t, proxy)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "blue", body)
+		require.Contains(t, buf.String(), "destination resolution failed, using stale destination")
+
+		set(green.URL, nil)
+		_, body = get(t, proxy)
+		require.Equal(t, "green", body)
+	})
+
+	t.Run("concurrent requests", func(t *testing.T) {
+		var calls int32
+		release := make(chan struct{})
+		blocking := func(u Upstream) (string, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			return blue.URL, nil
+		}
+		serve := func(proxy *Proxy, n int) <-chan int {
+			codes := make(chan int, n)
+			for i := 0; i < n; i++ {
+				go func() {
+					w := httptest.NewRecorder()
+					proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/widgets", nil))
+					codes <- w.Code
+				}()
+			}
+			return codes
+		}
+
+		// Requests share the first resolution.
+		proxy, err := New(m, WithDestinationResolver(blocking), WithDestinationResolverTTL(0))
+		require.NoError(t, err)
+		codes := serve(proxy, 10)
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+		release <- struct{}{}
+		for i := 0; i < 10; i++ {
+			require.Equal(t, http.StatusOK, <-codes)
+		}
+
+		// Once the destination has expired, one request resolves it again
+		// and the others use the stale one without waiting.
+		codes = serve(proxy, 10)
+		for i := 0; i < 9; i++ {
+			require.Equal(t, http.StatusOK, <-codes)
+		}
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 2 }, time.Second, time.Millisecond)
+		time.Sleep(20 * time.Millisecond)
+		require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+		release <- struct{}{}
+		require.Equal(t, http.StatusOK, <-codes)
+	})
+}
@@ -0,0 +1,191 @@
+package pass
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrNoRetryBudget is returned when asking for the state of a retry budget
+// that hasn't been configured with WithRetryBudget.
+var ErrNoRetryBudget = fmt.Errorf("no retry budget")
+
+// retryBudgetWindow is the length of the sliding window over which a retry
+// budget compares retries to original requests.
+const retryBudgetWindow = 10 * time.Second
+
+// retryTransport is an http.RoundTripper that retries requests that fail to
+// reach the upstream. Only requests that can be safely replayed are retried.
+type retryTransport struct {
+	base    http.RoundTripper
+	max     int
+	budget  *retryBudget    // Limits retries if set
+	backoff BackoffStrategy // Retries immediately if nil
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.budget != nil {
+		t.budget.request()
+	}
+
+	resp, err := t.base.RoundTrip(r)
+	for attempt := 1; attempt <= t.max && err != nil && replayable(r); attempt++ {
+		if t.budget != nil && !t.budget.withdraw() {
+			break
+		}
+		if !t.wait(r.Context(), attempt) {
+			break
+		}
+		r = r.Clone(r.Context())
+		if rewind(r) != nil {
+			break
+		}
+		resp, err = t.base.RoundTrip(r)
+	}
+	return resp, err
+}
+
+// wait sleeps for the backoff before a retry. It reports false if the request
+// is canceled in the meantime.
+func (t *retryTransport) wait(ctx context.Context, attempt int) bool {
+	if t.backoff == nil {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(t.backoff.Backoff(attempt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// replayable reports whether a request can be sent again after failing. A body
+// buffered by WithBufferRequestBody can be replayed whatever the method.
+// Otherwise the method must be idempotent and there can't be a body that's
+// already been consumed.
+func replayable(r *http.Request) bool {
+	if r.Body != nil && r.Body != http.NoBody {
+		return r.GetBody != nil
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// RetryBudgetState is a snapshot of an Upstream's retry budget over its
+// sliding window.
+type RetryBudgetState struct {
+	Requests   int     // Original requests sent upstream
+	Retries    int     // Retries sent upstream
+	Throttled  int     // Retries withheld because the budget was exhausted
+	Ratio      float64 // Retries as a fraction of original requests
+	Throttling bool    // Whether a retry would be withheld right now
+}
+
+// retryBudget limits retries to a fraction of original requests over a sliding
+// window, so that widespread failures don't multiply the load on an upstream.
+// The window is divided into one second buckets.
+type retryBudget struct {
+	ratio       float64
+	minRequests int
+	now         func() time.Time
+
+	mu      sync.Mutex
+	buckets [int(retryBudgetWindow / time.Second)]retryBucket
+}
+
+type retryBucket struct {
+	second    int64
+	requests  int
+	retries   int
+	throttled int
+}
+
+func newRetryBudget(ratio float64, minRequests int) *retryBudget {
+	return &retryBudget{ratio: ratio, minRequests: minRequests, now: time.Now}
+}
+
+// request records an original request.
+func (b *retryBudget) request() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bucket().requests++
+}
+
+// withdraw records a retry if the budget allows one. Until the window holds
+// minRequests original requests, retries are always allowed.
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.exhausted(b.totals()) {
+		b.bucket().throttled++
+		return false
+	}
+	b.bucket().retries++
+	return true
+}
+
+func (b *retryBudget) state() RetryBudgetState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := b.totals()
+	if s.Requests > 0 {
+		s.Ratio = float64(s.Retries) / float64(s.Requests)
+	}
+	s.Throttling = b.exhausted(s)
+	return s
+}
+
+func (b *retryBudget) exhausted(s RetryBudgetState) bool {
+	if s.Requests == 0 || s.Requests < b.minRequests {
+		return false
+	}
+	return float64(s.Retries+1)/float64(s.Requests) > b.ratio
+}
+
+// bucket returns the bucket for the current second, resetting it if it was
+// last used in an earlier window.
+func (b *retryBudget) bucket() *retryBucket {
+	sec := b.now().Unix()
+	bucket := &b.buckets[sec%int64(len(b.buckets))]
+	if bucket.second != sec {
+		*bucket = retryBucket{second: sec}
+	}
+	return bucket
+}
+
+// totals sums the buckets that fall within the window.
+func (b *retryBudget) totals() RetryBudgetState {
+	var s RetryBudgetState
+	oldest := b.now().Unix() - int64(len(b.buckets))
+	for _, bucket := range b.buckets {
+		if bucket.second <= oldest {
+			continue
+		}
+		s.Requests += bucket.requests
+		s.Retries += bucket.retries
+		s.Throttled += bucket.throttled
+	}
+	return s
+}
+
+// RetryBudget returns the state of an Upstream's retry budget.
+func (p *Proxy) RetryBudget(identifier string) (RetryBudgetState, error) {
+	state, ok := p.current().upstreams[identifier]
+	if !ok {
+		return RetryBudgetState{}, fmt.Errorf("%w: %q", ErrUnknownUpstream, identifier)
+	}
+	if state.retryBudget == nil {
+		return RetryBudgetState{}, ErrNoRetryBudget
+	}
+	return state.retryBudget.state(), nil
+}
@@ -0,0 +1,123 @@
+package pass
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestRetries(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	var attempts int32
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&attempts, 1)%3 != 0 {
+			return nil, fmt.Errorf("broken transport")
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})
+
+	proxy, err := New(m,
+		WithTransport(transport),
+		WithRetries(2),
+		WithRetryBackoff(ConstantBackoff{Delay: 50 * time.Millisecond}),
+	)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	start := time.Now()
+	resp, err := client.Get(server.URL + "/accounts")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+	require.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	_, err = proxy.RetryBudget("accounts")
+	require.True(t, errors.Is(err, ErrNoRetryBudget))
+}
+
+func TestRetryBudget(t *testing.T) {
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal("http://badhost.local"),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	var attempts int32
+	transport := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		atomic.AddInt32(&attempts, 1)
+		return nil, fmt.Errorf("broken transport")
+	})
+
+	proxy, err := New(m,
+		WithTransport(transport),
+		WithRetries(1),
+		WithRetryBudget(0.1, 10),
+	)
+	require.NoError(t, err)
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	client := &http.Client{Timeout: 1 * time.Second}
+
+	for i := 0; i < 20; i++ {
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	}
+
+	// Retries are allowed freely until there are 10 requests in the window,
+	// after which 9 retries out of 10 requests is well over budget.
+	require.Equal(t, int32(29), atomic.LoadInt32(&attempts))
+	state, err := proxy.RetryBudget("accounts")
+	require.NoError(t, err)
+	require.Equal(t, RetryBudgetState{
+		Requests:   20,
+		Retries:    9,
+		Throttled:  11,
+		Ratio:      0.45,
+		Throttling: true,
+	}, state)
+
+	_, err = proxy.RetryBudget("doesnt-exist")
+	require.True(t, errors.Is(err, ErrUnknownUpstream))
+}
+
+func TestRetryBudgetWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := newRetryBudget(0.5, 0)
+	b.now = func() time.Time { return now }
+
+	b.request()
+	require.False(t, b.withdraw())
+	b.request()
+	require.True(t, b.withdraw())
+	require.False(t, b.withdraw())
+
+	// Everything recorded falls out of the window eventually.
+	now = now.Add(retryBudgetWindow)
+	require.Equal(t, RetryBudgetState{}, b.state())
+	b.request()
+	b.request()
+	require.True(t, b.withdraw())
+}
@@ -0,0 +1,130 @@
+package pass
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ManifestSchema returns a JSON Schema describing manifests, for use by editor
+// tooling. It describes the JSON form of HCL, where labeled blocks are objects
+// keyed by their labels and other blocks are arrays. The schema is derived from
+// the hcl tags of Manifest and the types it contains, so it always matches
+// what LoadManifest accepts.
+func ManifestSchema() []byte {
+	schema := bodySchema(reflect.TypeOf(Manifest{}))
+	schema["properties"].(map[string]interface{})["locals"] = map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"type": "object"},
+	}
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	schema["title"] = "pass manifest"
+
+	// Marshaling a map can't fail.
+	b, _ := json.MarshalIndent(schema, "", "  ")
+	return b
+}
+
+// bodySchema returns the schema of the body of a block decoded into a struct.
+func bodySchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("hcl")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name, kind := parts[0], "attr"
+		if len(parts) > 1 {
+			kind = parts[1]
+		}
+
+		var s map[string]interface{}
+		switch kind {
+		case "label":
+			// Labels are the keys of the object containing the block.
+			continue
+		case "block":
+			if f.Type.Kind() == reflect.Ptr {
+				// A single, optional block.
+				s = bodySchema(f.Type.Elem())
+				break
+			}
+			s = blockSchema(f.Type.Elem())
+		case "optional":
+			s = typeSchema(f.Type)
+		default:
+			s = typeSchema(f.Type)
+			required = append(required, name)
+		}
+
+		// An attribute and a block can share a name, as with an Upstream's
+		// destination.
+		if existing, ok := properties[name]; ok {
+			s = map[string]interface{}{"anyOf": []interface{}{existing, s}}
+		}
+		properties[name] = s
+	}
+
+	schema := map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// blockSchema returns the schema of the blocks of a type decoded into a
+// struct.
+func blockSchema(t reflect.Type) map[string]interface{} {
+	body := bodySchema(t)
+	if hasLabel(t) {
+		return map[string]interface{}{
+			"type":                 "object",
+			"additionalProperties": body,
+		}
+	}
+	return map[string]interface{}{
+		"type":  "array",
+		"items": body,
+	}
+}
+
+// hasLabel reports whether blocks decoded into the struct have a label.
+func hasLabel(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("hcl"); strings.HasSuffix(tag, ",label") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeSchema returns the schema of an attribute's value.
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	}
+	return map[string]interface{}{}
+}
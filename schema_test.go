@@ -0,0 +1,61 @@
+package pass
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestSchema(t *testing.T) {
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal(ManifestSchema(), &schema))
+
+	properties := func(s interface{}) map[string]interface{} {
+		return s.(map[string]interface{})["properties"].(map[string]interface{})
+	}
+
+	manifest := properties(schema)
+	require.Equal(t, map[string]interface{}{"type": "string"}, manifest["prefix_path"])
+	require.Equal(t, map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "string"},
+	}, manifest["annotations"])
+
+	require.Equal(t, "array", manifest["locals"].(map[string]interface{})["type"])
+
+	// Labeled blocks are keyed by their labels; others are arrays.
+	upstreams := manifest["upstream"].(map[string]interface{})
+	require.Equal(t, "object", upstreams["type"])
+	upstream := upstreams["additionalProperties"]
+	routes := properties(upstream)["route"].(map[string]interface{})
+	require.Equal(t, "array", routes["type"])
+	route := routes["items"]
+	require.Equal(t, []interface{}{"methods", "path"}, route.(map[string]interface{})["required"])
+	require.Equal(t, map[string]interface{}{"type": "integer"}, properties(route)["timeout_ms"])
+	require.Equal(t, map[string]interface{}{
+		"type":  "array",
+		"items": map[string]interface{}{"type": "string"},
+	}, properties(route)["methods"])
+
+	// An Upstream's destination can be an attribute or blocks.
+	destination := properties(upstream)["destination"].(map[string]interface{})
+	require.Len(t, destination["anyOf"], 2)
+
+	// Every attribute and block of the structs is described.
+	for typ, s := range map[reflect.Type]interface{}{
+		reflect.TypeOf(Upstream{}): upstream,
+		reflect.TypeOf(Route{}):    route,
+	} {
+		for i := 0; i < typ.NumField(); i++ {
+			tag := typ.Field(i).Tag.Get("hcl")
+			name := strings.Split(tag, ",")[0]
+			if name == "" {
+				continue
+			}
+			require.Contains(t, properties(s), name, typ.Name())
+		}
+	}
+}
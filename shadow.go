@@ -0,0 +1,122 @@
+package pass
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// DefaultShadowMaxBodySize is the largest request body that's buffered to be
+// replayed to a shadow Upstream, unless WithShadowMaxBodySize says otherwise.
+const DefaultShadowMaxBodySize = 1 << 20
+
+// DefaultShadowTimeout is the deadline for requests replayed to a shadow
+// Upstream, unless WithShadowTimeout says otherwise.
+const DefaultShadowTimeout = 10 * time.Second
+
+// DefaultMaxShadowRequests is how many requests can be replayed to each shadow
+// Upstream at once, unless WithMaxShadowRequests says otherwise.
+const DefaultMaxShadowRequests = 100
+
+// shadow is the configuration given to WithShadow.
+type shadow struct {
+	identifier string
+	fraction   float64
+}
+
+// withShadow is middleware that replays a fraction of requests to the shadow
+// Upstream. Requests are replayed in the background and the shadow's responses
+// are discarded. Requests with bodies larger than maxBody, or any body when
+// uploads are streamed, aren't replayed, and neither are those that arrive
+// while the shadow has as many replays in flight as it's allowed.
+func (rt *routing) withShadow(s shadow, cfg mountConfig) func(http.Handler) http.Handler {
+	maxBody := cfg.shadowMaxBody
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rand.Float64() >= s.fraction {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			hasBody := r.Body != nil && r.Body != http.NoBody
+			if hasBody && cfg.streamUploads {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var body []byte
+			if hasBody {
+				buf, err := ioutil.ReadAll(io.LimitReader(r.Body, maxBody+1))
+				if err != nil {
+					serveError(w, r, cfg, err, http.StatusBadRequest)
+					return
+				}
+				if int64(len(buf)) > maxBody {
+					// Too large to replay; send what was read ahead of the
+					// rest of the body.
+					r.Body = readCloser{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+					next.ServeHTTP(w, r)
+					return
+				}
+				body = buf
+				r.Body = ioutil.NopCloser(bytes.NewReader(buf))
+			}
+
+			state := rt.upstreams[s.identifier]
+			select {
+			case state.shadows <- struct{}{}:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// The copy isn't canceled along with the original request, but
+			// has a deadline of its own.
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.shadowTimeout)
+			sr := r.Clone(ctx)
+			sr.Body = http.NoBody
+			if body != nil {
+				sr.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+			go func() {
+				defer func() { <-state.shadows }()
+				defer cancel()
+				rt.replay(s.identifier, sr)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// replay sends a copy of a request to the shadow Upstream and discards the
+// response. Errors are discarded too, rather than handed to the ErrorHandler.
+func (rt *routing) replay(identifier string, r *http.Request) {
+	state := rt.upstreams[identifier]
+	state.track(r, func(r *http.Request) {
+		w := &discardResponseWriter{header: http.Header{}}
+		dest, err := rt.pickers[identifier](w, r)
+		if err != nil {
+			return
+		}
+		dest.serve(dest.shadow, w, r)
+	})
+}
+
+// readCloser combines a Reader with the Closer of the body it reads from.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// discardResponseWriter is an http.ResponseWriter that discards the response.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
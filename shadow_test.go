@@ -0,0 +1,227 @@
+package pass
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestShadow(t *testing.T) {
+	primaryBodies := make(chan string, 10)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		primaryBodies <- string(b)
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	release := make(chan struct{})
+	shadowBodies := make(chan string, 10)
+	shadowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		shadowBodies <- r.URL.Path + " " + string(b)
+		<-release
+		w.Write([]byte("shadow"))
+	}))
+	defer shadowServer.Close()
+	defer close(release)
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary": cty.StringVal(primary.URL),
+			"shadow":  cty.StringVal(shadowServer.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/shadow.hcl", ectx)
+	require.NoError(t, err)
+
+	post := func(t *testing.T, proxy *Proxy, body string) {
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		// The response isn't held up by the shadow, which doesn't respond
+		// until it's released.
+		resp, err := client.Post(server.URL+"/widgets", "text/plain", strings.NewReader(body))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, "primary", string(b))
+		require.Equal(t, body, <-primaryBodies)
+	}
+
+	t.Run("mirrored", func(t *testing.T) {
+		proxy, err := New(m, WithShadow("primary", "shadow", 1))
+		require.NoError(t, err)
+		post(t, proxy, "widget")
+
+		select {
+		case got := <-shadowBodies:
+			require.Equal(t, "/widgets widget", got)
+		case <-time.After(time.Second):
+			t.Fatal("request wasn't mirrored")
+		}
+	})
+
+	t.Run("not mirrored", func(t *testing.T) {
+		proxy, err := New(m, WithShadow("primary", "shadow", 0))
+		require.NoError(t, err)
+		post(t, proxy, "widget")
+
+		select {
+		case got := <-shadowBodies:
+			t.Fatalf("request was mirrored: %q", got)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		proxy, err := New(m, WithShadow("primary", "shadow", 1), WithShadowMaxBodySize(4))
+		require.NoError(t, err)
+		post(t, proxy, "widget")
+
+		select {
+		case got := <-shadowBodies:
+			t.Fatalf("request was mirrored: %q", got)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := New(m, WithShadow("primary", "missing", 1))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+
+		_, err = New(m, WithShadow("primary", "primary", 1))
+		require.Error(t, err)
+
+		_, err = New(m, WithShadow("primary", "shadow", 1.5))
+		require.Error(t, err)
+
+		_, err = New(m, WithShadow("primary", "shadow", 1), WithShadowTimeout(0))
+		require.Error(t, err)
+
+		_, err = New(m, WithShadow("primary", "shadow", 1), WithMaxShadowRequests(0))
+		require.Error(t, err)
+	})
+}
+
+func TestShadowLimits(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	// The shadow hangs until its request is canceled.
+	var received, canceled int32
+	shadowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&received, 1)
+		<-r.Context().Done()
+		atomic.AddInt32(&canceled, 1)
+	}))
+	defer shadowServer.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary": cty.StringVal(primary.URL),
+			"shadow":  cty.StringVal(shadowServer.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/shadow.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m,
+		WithShadow("primary", "shadow", 1),
+		WithShadowTimeout(200*time.Millisecond),
+		WithMaxShadowRequests(2),
+	)
+	require.NoError(t, err)
+
+	post := func() {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/widgets", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "primary", w.Body.String())
+	}
+
+	// Replays beyond the limit are dropped while the shadow hangs.
+	for i := 0; i < 5; i++ {
+		post()
+	}
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&received) == 2 }, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(2), atomic.LoadInt32(&received))
+
+	// The replays time out, which frees their slots.
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&canceled) == 2 }, time.Second, 5*time.Millisecond)
+	require.Eventually(t, func() bool {
+		post()
+		return atomic.LoadInt32(&received) > 2
+	}, time.Second, 20*time.Millisecond)
+}
+
+func TestShadowErrors(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	// The shadow refuses connections.
+	shadowServer := httptest.NewServer(http.NotFoundHandler())
+	shadowServer.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"primary": cty.StringVal(primary.URL),
+			"shadow":  cty.StringVal(shadowServer.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/shadow.hcl", ectx)
+	require.NoError(t, err)
+
+	// Serves a request and waits for its replay to finish.
+	post := func(t *testing.T, proxy *Proxy) {
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/widgets", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "primary", w.Body.String())
+		require.Eventually(t, func() bool {
+			return len(proxy.current().upstreams["shadow"].shadows) == 0
+		}, time.Second, 5*time.Millisecond)
+	}
+
+	t.Run("error handler", func(t *testing.T) {
+		var handled int32
+		proxy, err := New(m,
+			WithShadow("primary", "shadow", 1),
+			WithErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+				atomic.AddInt32(&handled, 1)
+			}),
+		)
+		require.NoError(t, err)
+		post(t, proxy)
+		require.Equal(t, int32(0), atomic.LoadInt32(&handled))
+	})
+
+	t.Run("error log", func(t *testing.T) {
+		var buf bytes.Buffer
+		proxy, err := New(m,
+			WithShadow("primary", "shadow", 1),
+			WithErrorLog(log.New(&buf, "", 0)),
+		)
+		require.NoError(t, err)
+		post(t, proxy)
+		require.Empty(t, buf.String())
+	})
+}
@@ -0,0 +1,18 @@
+//go:build go1.21
+// +build go1.21
+
+package pass
+
+import (
+	"log/slog"
+)
+
+// WithErrorLogger specifies a structured logger for errors proxying requests
+// to upstreams. Errors are logged with the upstream's identifier, the request's
+// method and path, and the error as separate attributes. It's preferred over
+// WithErrorLog when both are given.
+func WithErrorLogger(l *slog.Logger) MountOption {
+	return func(c *mountConfig) {
+		c.errorLogger = l
+	}
+}
@@ -0,0 +1,50 @@
+//go:build go1.21
+// +build go1.21
+
+package pass
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestErrorLogger(t *testing.T) {
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal("http://127.0.0.1:1"),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	var structured, text bytes.Buffer
+	proxy, err := New(m,
+		WithErrorLogger(slog.New(slog.NewJSONHandler(&structured, nil))),
+		WithErrorLog(log.New(&text, "", 0)),
+	)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+	require.Equal(t, http.StatusBadGateway, w.Code)
+	require.Empty(t, text.String())
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(structured.Bytes(), &entry))
+	require.Equal(t, "ERROR", entry["level"])
+	require.Equal(t, "http: proxy error", entry["msg"])
+	require.Equal(t, "accounts", entry["upstream"])
+	require.Equal(t, http.MethodGet, entry["method"])
+	require.Equal(t, "/accounts", entry["path"])
+	require.Contains(t, entry["error"], "connection refused")
+}
@@ -0,0 +1,21 @@
+package pass
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// logSlowRequests logs requests to an Upstream that take longer than the
+// threshold to complete.
+func logSlowRequests(identifier string, threshold time.Duration, l *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			next.ServeHTTP(w, r)
+			if d := time.Since(start); d > threshold {
+				l.Printf("slow request: upstream %q: %s %s took %s (threshold %s)", identifier, r.Method, r.URL.Path, d, threshold)
+			}
+		})
+	}
+}
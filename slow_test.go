@@ -0,0 +1,48 @@
+package pass
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestSlowRequestLog(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/slow") {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/slow_threshold.hcl", ectx)
+	require.NoError(t, err)
+
+	var logs bytes.Buffer
+	proxy, err := New(m, WithErrorLog(log.New(&logs, "", 0)))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/reports/fast", nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Empty(t, logs.String())
+
+	r = httptest.NewRequest(http.MethodGet, "/reports/slow", nil)
+	w = httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, logs.String(), `slow request: upstream "reports": GET /reports/slow took`)
+}
@@ -0,0 +1,297 @@
+package pass
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUnknownUpstream is returned when an Upstream identifier doesn't exist in
+// the Proxy.
+var ErrUnknownUpstream = fmt.Errorf("unknown upstream")
+
+// ErrUnknownDestination is returned when a Destination identifier doesn't exist
+// in an Upstream.
+var ErrUnknownDestination = fmt.Errorf("unknown destination")
+
+// destinationProxy is a reverse-proxy for a single destination of an Upstream.
+type destinationProxy struct {
+	identifier string
+	url        string
+	target     *url.URL
+	proxy      *httputil.ReverseProxy
+	balancer   Balancer          // Balancer that picked this destination, if any
+	transport  http.RoundTripper // Reaches the destination without retries, for health checks; nil for the default
+
+	flushProxies map[time.Duration]*httputil.ReverseProxy // Copies of proxy for routes that override its FlushInterval
+	shadow       *httputil.ReverseProxy                   // Copy of proxy for shadow replays, whose errors are discarded
+}
+
+// serve proxies a request with p, which is proxy or one of its copies, and
+// tells the Upstream's Balancer when it's done.
+func (d *destinationProxy) serve(p *httputil.ReverseProxy, w http.ResponseWriter, r *http.Request) {
+	if b, ok := d.balancer.(DoneBalancer); ok {
+		defer b.Done(d.target, r)
+	}
+	p.ServeHTTP(w, r)
+}
+
+// proxyFor returns the ReverseProxy that flushes at the given interval.
+func (d *destinationProxy) proxyFor(flush time.Duration) *httputil.ReverseProxy {
+	if p, ok := d.flushProxies[flush]; ok {
+		return p
+	}
+	return d.proxy
+}
+
+// targetURL returns the URL a request for u is proxied to. It mirrors the
+// rewriting done by httputil.NewSingleHostReverseProxy's Director.
+func (d *destinationProxy) targetURL(u *url.URL) *url.URL {
+	out := *u
+	out.Scheme = d.target.Scheme
+	out.Host = d.target.Host
+	out.Path, out.RawPath = joinURLPath(d.target, u)
+	switch {
+	case d.target.RawQuery == "" || u.RawQuery == "":
+		out.RawQuery = d.target.RawQuery + u.RawQuery
+	default:
+		out.RawQuery = d.target.RawQuery + "&" + u.RawQuery
+	}
+	return &out
+}
+
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+
+	apath := a.EscapedPath()
+	bpath := b.EscapedPath()
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// picker chooses the destination a request is proxied to. It may set headers
+// on the response to influence the choice for later requests. It returns an
+// error if no destination could be chosen.
+type picker func(http.ResponseWriter, *http.Request) (*destinationProxy, error)
+
+// split distributes requests between the weighted destinations of an
+// Upstream. The weights can be adjusted while requests are being served.
+type split struct {
+	balancer Balancer           // Chooses between destinations with weight, if set
+	health   *destinationHealth // Destinations passed over while others are healthy
+	stale    bool               // Whether to pick from unhealthy destinations when there's nothing else
+
+	// Copies of destinations that don't tell the Balancer when they're done,
+	// for requests it didn't pick a destination for.
+	unbalanced []*destinationProxy
+
+	mu           sync.RWMutex
+	destinations []*destinationProxy
+	weights      []int
+	total        int
+}
+
+// add adds a destination to the split with an initial weight.
+func (s *split) add(dest *destinationProxy, weight int) {
+	dest.balancer = s.balancer
+	unbalanced := *dest
+	unbalanced.balancer = nil
+	s.destinations = append(s.destinations, dest)
+	s.unbalanced = append(s.unbalanced, &unbalanced)
+	s.weights = append(s.weights, weight)
+	s.total += weight
+}
+
+// pick selects a destination for a request.
+func (s *split) pick(r *http.Request) (*destinationProxy, error) {
+	i, err := s.pickIndex(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.destinations[i], nil
+}
+
+// pickIndex selects the index of a destination for a request with the split's
+// Balancer. See pickWith.
+func (s *split) pickIndex(r *http.Request) (int, error) {
+	return s.pickWith(s.balancer, r)
+}
+
+// pickWith selects the index of a destination for a request with a Balancer.
+// Destinations reported unhealthy are passed over while any other has weight;
+// once none does, ErrNoHealthyDestinations is returned, unless the split
+// serves stale. Without a Balancer, it's chosen at random in proportion to its
+// weight.
+func (s *split) pickWith(b Balancer, r *http.Request) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	weights, total := s.healthyWeights()
+	if total == 0 {
+		if !s.stale {
+			return 0, ErrNoHealthyDestinations
+		}
+		weights, total = s.weights, s.total
+	}
+	if b == nil {
+		return weighted(weights, rand.Intn(total)), nil
+	}
+
+	var candidates []*url.URL
+	for i, d := range s.destinations {
+		if weights[i] > 0 {
+			candidates = append(candidates, d.target)
+		}
+	}
+	picked := b.Pick(candidates, r)
+	for i, d := range s.destinations {
+		if picked != nil && d.target == picked && weights[i] > 0 {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: balancer picked %v", ErrUnknownDestination, picked)
+}
+
+// healthyWeights returns the weights of the destinations, with those reported
+// unhealthy given none, and their total. The caller must hold the lock.
+func (s *split) healthyWeights() ([]int, int) {
+	if atomic.LoadInt32(&s.health.count) == 0 {
+		return s.weights, s.total
+	}
+	weights := make([]int, len(s.weights))
+	var total int
+	for i, d := range s.destinations {
+		if s.health.healthy(d.identifier) {
+			weights[i] = s.weights[i]
+			total += s.weights[i]
+		}
+	}
+	return weights, total
+}
+
+// pickHash selects a destination in proportion to its weight using a hash, so
+// that the same hash selects the same destination while the weights don't
+// change. The Balancer isn't consulted. If that destination is reported
+// unhealthy, the hash selects another from those that aren't, so only the
+// hashes that selected it move.
+func (s *split) pickHash(h uint32) (*destinationProxy, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	i := weighted(s.weights, int(h%uint32(s.total)))
+	if s.health.healthy(s.destinations[i].identifier) {
+		return s.unbalanced[i], nil
+	}
+	weights, total := s.healthyWeights()
+	if total == 0 {
+		if !s.stale {
+			return nil, ErrNoHealthyDestinations
+		}
+		return s.unbalanced[i], nil
+	}
+	return s.unbalanced[weighted(weights, int(h%uint32(total)))], nil
+}
+
+// weighted returns the index of the destination whose share of the total
+// weight contains n.
+func weighted(weights []int, n int) int {
+	for i, w := range weights {
+		if n < w {
+			return i
+		}
+		n -= w
+	}
+	return len(weights) - 1
+}
+
+// pinned returns the destination at an index, chosen without consulting the
+// Balancer, if it exists, is receiving traffic and hasn't been reported
+// unhealthy.
+func (s *split) pinned(i int) *destinationProxy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if i < 0 || i >= len(s.destinations) || s.weights[i] == 0 {
+		return nil
+	}
+	if !s.health.healthy(s.destinations[i].identifier) {
+		return nil
+	}
+	return s.unbalanced[i]
+}
+
+// set replaces the weights of all destinations. Destinations missing from the
+// map receive no traffic.
+func (s *split) set(weights map[string]int) error {
+	if err := validateWeights(weights); err != nil {
+		return err
+	}
+
+	next := make([]int, len(s.destinations))
+	var total int
+	for id, w := range weights {
+		i := s.index(id)
+		if i < 0 {
+			return fmt.Errorf("%w: %q", ErrUnknownDestination, id)
+		}
+		next[i] = w
+		total += w
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.weights = next
+	s.total = total
+	return nil
+}
+
+func (s *split) index(identifier string) int {
+	for i, d := range s.destinations {
+		if d.identifier == identifier {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetSplit changes the share of traffic each of an Upstream's destinations
+// receives. Weights are keyed by Destination identifier and destinations
+// omitted from the map receive no traffic. It's safe to call while the Proxy is
+// serving requests.
+func (p *Proxy) SetSplit(identifier string, weights map[string]int) error {
+	rt := p.current()
+	if _, ok := rt.upstreams[identifier]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownUpstream, identifier)
+	}
+	s, ok := rt.splits[identifier]
+	if !ok {
+		return fmt.Errorf("%w: upstream %q has no destination blocks", ErrUnknownDestination, identifier)
+	}
+	return s.set(weights)
+}
@@ -0,0 +1,41 @@
+package pass
+
+import (
+	"net/http"
+	"path"
+)
+
+// staticFallback returns a handler that serves files from fs, falling back to
+// the index file for paths that don't name one, such as the client-side routes
+// of a single-page application. Only GET and HEAD requests are served.
+func staticFallback(fs http.FileSystem, index string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.NotFound(w, r)
+			return
+		}
+		if serveFile(w, r, fs, path.Clean("/"+r.URL.Path)) {
+			return
+		}
+		if !serveFile(w, r, fs, path.Clean("/"+index)) {
+			http.NotFound(w, r)
+		}
+	}
+}
+
+// serveFile serves the named file from fs. It reports false, having written
+// nothing, if there's no such file or it's a directory.
+func serveFile(w http.ResponseWriter, r *http.Request, fs http.FileSystem, name string) bool {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	return true
+}
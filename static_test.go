@@ -0,0 +1,65 @@
+package pass
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestStaticFallback(t *testing.T) {
+	destination := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("upstream"))
+	}))
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal(destination.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/basic_destination.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m, WithStaticFallback(http.Dir("testdata/static"), "index.html"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		status      int
+		body        string
+		contentType string
+	}{
+		{"existing file", http.MethodGet, "/assets/app.css", http.StatusOK, "body{}\n", "text/css; charset=utf-8"},
+		{"missing file", http.MethodGet, "/settings/profile", http.StatusOK, "<html>app</html>\n", "text/html; charset=utf-8"},
+		{"directory", http.MethodGet, "/assets", http.StatusOK, "<html>app</html>\n", "text/html; charset=utf-8"},
+		{"escaping the root", http.MethodGet, "/../pass.go", http.StatusOK, "<html>app</html>\n", "text/html; charset=utf-8"},
+		{"upstream route", http.MethodGet, "/accounts", http.StatusOK, "upstream", "text/plain; charset=utf-8"},
+		{"other methods", http.MethodPost, "/assets/app.css", http.StatusNotFound, "404 page not found\n", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			require.Equal(t, tt.status, w.Code)
+			require.Equal(t, tt.body, w.Body.String())
+			require.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+		})
+	}
+
+	t.Run("missing index", func(t *testing.T) {
+		proxy, err := New(m, WithStaticFallback(http.Dir("testdata/static"), "missing.html"))
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/settings", nil)
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,86 @@
+package pass
+
+import (
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultStickyCookie begins the name of the cookie used for sticky sessions if
+// one isn't specified. The Upstream's identifier follows it, so that each
+// Upstream has a cookie of its own.
+const DefaultStickyCookie = "pass_upstream"
+
+// StickySessions is sticky session configuration for an Upstream.
+type StickySessions struct {
+	Cookie   string // Cookie recording the client's destination. Defaults to DefaultStickyCookie, an underscore and the Upstream's identifier.
+	ClientIP bool   // Choose the destination from the client's IP address, as resolved by the ClientIPResolver, instead of a cookie
+}
+
+// newStickyPicker returns a picker that keeps clients on the same destination
+// of a split. Clients without one, or whose destination can't take requests,
+// are given one by the split's Balancer, or in turn if it has none. The
+// cookie, if used, is scoped to the path the Upstream is mounted under.
+func newStickyPicker(cfg StickySessions, s *split, identifier, prefix string, clientIP ClientIPResolver) picker {
+	if cfg.ClientIP {
+		return func(w http.ResponseWriter, r *http.Request) (*destinationProxy, error) {
+			return s.pickHash(hashClientIP(clientIP(r)))
+		}
+	}
+
+	balancer := s.balancer
+	if balancer == nil {
+		balancer = RoundRobinBalancer()
+	}
+
+	name := cfg.Cookie
+	if name == "" {
+		name = DefaultStickyCookie + "_" + cookieToken(identifier)
+	}
+	cookiePath := prefix
+	if cookiePath == "" {
+		cookiePath = "/"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) (*destinationProxy, error) {
+		if c, err := r.Cookie(name); err == nil {
+			// Only the exact values this picker sets are honored.
+			if i, err := strconv.Atoi(c.Value); err == nil && strconv.Itoa(i) == c.Value {
+				if dest := s.pinned(i); dest != nil {
+					return dest, nil
+				}
+			}
+		}
+
+		i, err := s.pickWith(balancer, r)
+		if err != nil {
+			return nil, err
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    strconv.Itoa(i),
+			Path:     cookiePath,
+			HttpOnly: true,
+		})
+		return s.destinations[i], nil
+	}
+}
+
+// hashClientIP hashes the IP address of the client.
+func hashClientIP(ip string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(ip))
+	return h.Sum32()
+}
+
+// cookieToken replaces the characters of s that can't appear in a cookie name
+// with underscores.
+func cookieToken(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > ' ' && r < 0x7f && !strings.ContainsRune("()<>@,;:\\\"/[]?={}", r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
@@ -0,0 +1,235 @@
+package pass
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestStickySessions(t *testing.T) {
+	blue := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "blue")
+	}))
+	defer blue.Close()
+	green := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "green")
+	}))
+	defer green.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"blue":  cty.StringVal(blue.URL),
+			"green": cty.StringVal(green.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/sticky.hcl", ectx)
+	require.NoError(t, err)
+
+	get := func(t *testing.T, client *http.Client, url string) string {
+		resp, err := client.Get(url + "/accounts")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("cookie", func(t *testing.T) {
+		proxy, err := New(m, WithStickySessions("accounts", StickySessions{}))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		jar, err := cookiejar.New(nil)
+		require.NoError(t, err)
+		client := &http.Client{Timeout: 1 * time.Second, Jar: jar}
+
+		first := get(t, client, server.URL)
+		for i := 0; i < 20; i++ {
+			require.Equal(t, first, get(t, client, server.URL))
+		}
+
+		// Clients move when their destination stops receiving traffic, and
+		// stay on the new one.
+		other := map[string]string{"blue": "green", "green": "blue"}[first]
+		require.NoError(t, proxy.SetSplit("accounts", map[string]int{other: 100}))
+		require.Equal(t, other, get(t, client, server.URL))
+		require.NoError(t, proxy.SetSplit("accounts", map[string]int{"blue": 50, "green": 50}))
+		for i := 0; i < 20; i++ {
+			require.Equal(t, other, get(t, client, server.URL))
+		}
+	})
+
+	t.Run("default cookie", func(t *testing.T) {
+		proxy, err := New(m, WithStickySessions("accounts", StickySessions{}))
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		proxy.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/accounts", nil))
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		require.Equal(t, "pass_upstream_accounts", cookies[0].Name)
+
+		// Values other than a destination's index are replaced.
+		for _, v := range []string{"2", "-1", "+1", "01", "blue"} {
+			r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+			r.AddCookie(&http.Cookie{Name: "pass_upstream_accounts", Value: v})
+			w := httptest.NewRecorder()
+			proxy.ServeHTTP(w, r)
+			require.Equal(t, http.StatusOK, w.Code, v)
+			cookies := w.Result().Cookies()
+			require.Len(t, cookies, 1, v)
+			require.Contains(t, []string{"0", "1"}, cookies[0].Value, v)
+		}
+	})
+
+	t.Run("custom cookie", func(t *testing.T) {
+		proxy, err := New(m, WithStickySessions("accounts", StickySessions{Cookie: "accounts_destination"}))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		resp, err := client.Get(server.URL + "/accounts")
+		require.NoError(t, err)
+		cookies := resp.Cookies()
+		require.Len(t, cookies, 1)
+		require.Equal(t, "accounts_destination", cookies[0].Name)
+		require.Contains(t, []string{"0", "1"}, cookies[0].Value)
+	})
+
+	t.Run("client ip", func(t *testing.T) {
+		proxy, err := New(m, WithStickySessions("accounts", StickySessions{ClientIP: true}))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		client := &http.Client{Timeout: 1 * time.Second}
+
+		first := get(t, client, server.URL)
+		for i := 0; i < 20; i++ {
+			require.Equal(t, first, get(t, client, server.URL))
+		}
+	})
+
+	t.Run("balancer", func(t *testing.T) {
+		for _, sticky := range []StickySessions{{}, {ClientIP: true}} {
+			b := &stickyBalancer{Balancer: RoundRobinBalancer()}
+			proxy, err := New(m,
+				WithStickySessions("accounts", sticky),
+				WithUpstreamBalancer("accounts", b),
+			)
+			require.NoError(t, err)
+			server := httptest.NewServer(proxy)
+			defer server.Close()
+
+			jar, err := cookiejar.New(nil)
+			require.NoError(t, err)
+			client := &http.Client{Timeout: 1 * time.Second, Jar: jar}
+			for i := 0; i < 5; i++ {
+				get(t, client, server.URL)
+			}
+
+			// The balancer is only told a request is done if it picked the
+			// destination, rather than the cookie or client IP.
+			require.Equal(t, atomic.LoadInt32(&b.picks), atomic.LoadInt32(&b.done))
+			if sticky.ClientIP {
+				require.Equal(t, int32(0), atomic.LoadInt32(&b.picks))
+			} else {
+				require.Equal(t, int32(1), atomic.LoadInt32(&b.picks))
+			}
+		}
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		proxy, err := New(m, WithStickySessions("accounts", StickySessions{}))
+		require.NoError(t, err)
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+
+		// Without a balancer, new clients are assigned destinations in turn.
+		var assigned []string
+		for i := 0; i < 4; i++ {
+			client := &http.Client{Timeout: 1 * time.Second}
+			assigned = append(assigned, get(t, client, server.URL))
+		}
+		require.NotEqual(t, assigned[0], assigned[1])
+		require.Equal(t, assigned[0], assigned[2])
+		require.Equal(t, assigned[1], assigned[3])
+	})
+
+	t.Run("unhealthy", func(t *testing.T) {
+		for _, sticky := range []StickySessions{{}, {ClientIP: true}} {
+			proxy, err := New(m, WithStickySessions("accounts", sticky))
+			require.NoError(t, err)
+			server := httptest.NewServer(proxy)
+			defer server.Close()
+
+			jar, err := cookiejar.New(nil)
+			require.NoError(t, err)
+			client := &http.Client{Timeout: 1 * time.Second, Jar: jar}
+
+			first := get(t, client, server.URL)
+			other := map[string]string{"blue": "green", "green": "blue"}[first]
+
+			// Clients move off a destination reported unhealthy.
+			require.NoError(t, proxy.SetDestinationHealthy("accounts", first, false))
+			for i := 0; i < 5; i++ {
+				require.Equal(t, other, get(t, client, server.URL))
+			}
+
+			// Cookie clients are pinned to their new destination; client
+			// IPs hash back to the original one once it recovers.
+			require.NoError(t, proxy.SetDestinationHealthy("accounts", first, true))
+			want := other
+			if sticky.ClientIP {
+				want = first
+			}
+			for i := 0; i < 5; i++ {
+				require.Equal(t, want, get(t, client, server.URL))
+			}
+
+			require.NoError(t, proxy.SetDestinationHealthy("accounts", "blue", false))
+			require.NoError(t, proxy.SetDestinationHealthy("accounts", "green", false))
+			resp, err := client.Get(server.URL + "/accounts")
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		}
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		_, err := New(m, WithStickySessions("doesnt-exist", StickySessions{}))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+}
+
+type stickyBalancer struct {
+	Balancer
+	picks int32 // Accessed atomically
+	done  int32 // Accessed atomically
+}
+
+func (b *stickyBalancer) Pick(destinations []*url.URL, r *http.Request) *url.URL {
+	atomic.AddInt32(&b.picks, 1)
+	return b.Balancer.Pick(destinations, r)
+}
+
+func (b *stickyBalancer) Done(*url.URL, *http.Request) { atomic.AddInt32(&b.done, 1) }
+
+func TestCookieToken(t *testing.T) {
+	require.Equal(t, "accounts", cookieToken("accounts"))
+	require.Equal(t, "billing_v2_eu", cookieToken("billing v2/eu"))
+}
@@ -0,0 +1,20 @@
+upstream "stable" {
+    destination = "${stable}"
+
+    route {
+        methods = ["GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "CONNECT", "OPTIONS", "TRACE"]
+        path = "/widgets"
+    }
+}
+
+upstream "beta" {
+    destination = "${beta}"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+        match_headers = {
+            "X-Beta" = "true"
+        }
+    }
+}
@@ -0,0 +1,37 @@
+upstream "basic" {
+    destination = "${destination}"
+
+    auth {
+        type = "basic"
+        username = "proxy"
+        password = "${password}"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/basic"
+    }
+}
+
+upstream "bearer" {
+    destination = "${destination}"
+
+    auth {
+        type = "bearer"
+        token = "${token}"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/bearer"
+    }
+}
+
+upstream "open" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/open"
+    }
+}
@@ -0,0 +1,27 @@
+upstream "widgets" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET", "POST"]
+        path = "/widgets"
+    }
+
+    route {
+        methods = ["DELETE"]
+        path = "/widgets/{id}"
+    }
+
+    route {
+        methods = ["GET", "OPTIONS"]
+        path = "/gadgets"
+    }
+}
+
+upstream "orders" {
+    destination = "${destination}"
+
+    route {
+        methods = ["PUT"]
+        path = "/widgets"
+    }
+}
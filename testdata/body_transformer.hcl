@@ -0,0 +1,14 @@
+upstream "legacy" {
+    destination = "${legacy}"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/widgets/stream"
+        flush_interval_ms = -1
+    }
+}
@@ -0,0 +1,10 @@
+prefix_path = "/api/v2"
+
+upstream "accounts" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/*"
+    }
+}
@@ -0,0 +1,13 @@
+upstream "accounts" {
+    destination = "http://accounts.local"
+
+    destination "blue" {
+        url = "http://blue.accounts.local"
+        weight = 100
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
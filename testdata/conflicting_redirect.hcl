@@ -0,0 +1,12 @@
+upstream "legacy" {
+    destination = "http://legacy.local"
+
+    redirect {
+        to = "https://widgets.example.com"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
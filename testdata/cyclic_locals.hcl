@@ -0,0 +1,13 @@
+locals {
+    a = local.b
+    b = local.a
+}
+
+upstream "accounts" {
+    destination = "http://accounts.local"
+
+    route {
+        methods = ["GET"]
+        path = local.a
+    }
+}
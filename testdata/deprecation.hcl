@@ -0,0 +1,21 @@
+upstream "widgets" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/v1/widgets"
+        deprecated = true
+        sunset = "2025-01-01"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/v1/gadgets"
+        deprecated = true
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/v2/widgets"
+    }
+}
@@ -0,0 +1,24 @@
+upstream "accounts" {
+    destination "blue" {
+        url = "${blue}"
+        weight = 50
+    }
+
+    destination "green" {
+        url = "${green}"
+        weight = 50
+    }
+
+    health {
+        url = "/healthz"
+        interval_ms = 10
+        timeout_ms = 500
+        healthy_threshold = 2
+        unhealthy_threshold = 2
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
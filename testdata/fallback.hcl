@@ -0,0 +1,17 @@
+upstream "primary" {
+    destination = "${primary}"
+
+    route {
+        methods = ["GET", "POST"]
+        path = "/widgets"
+    }
+}
+
+upstream "secondary" {
+    destination = "${secondary}"
+
+    route {
+        methods = ["GET"]
+        path = "/gadgets"
+    }
+}
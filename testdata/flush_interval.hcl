@@ -0,0 +1,40 @@
+upstream "duration" {
+    destination = "http://duration.local"
+    flush_interval = "250ms"
+
+    route {
+        methods = ["GET"]
+        path = "/duration"
+    }
+}
+
+upstream "immediate" {
+    destination = "http://immediate.local"
+    flush_interval = "-1"
+
+    route {
+        methods = ["GET"]
+        path = "/immediate"
+    }
+}
+
+upstream "milliseconds" {
+    destination = "http://milliseconds.local"
+    flush_interval_ms = 1000
+
+    route {
+        methods = ["GET"]
+        path = "/milliseconds"
+    }
+}
+
+upstream "both" {
+    destination = "http://both.local"
+    flush_interval = "2s"
+    flush_interval_ms = 1000
+
+    route {
+        methods = ["GET"]
+        path = "/both"
+    }
+}
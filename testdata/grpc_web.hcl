@@ -0,0 +1,9 @@
+upstream "greeter" {
+    destination = "${destination}"
+    protocol = "grpc-web"
+
+    route {
+        methods = ["POST"]
+        path = "/helloworld.Greeter/SayHello"
+    }
+}
@@ -0,0 +1,25 @@
+upstream "accounts" {
+    destination = "http://accounts.local"
+
+    health {
+        url = "${health}/healthz"
+        interval_ms = 10
+        timeout_ms = 500
+        healthy_threshold = 2
+        unhealthy_threshold = 2
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
+
+upstream "unchecked" {
+    destination = "http://unchecked.local"
+
+    route {
+        methods = ["GET"]
+        path = "/unchecked"
+    }
+}
@@ -0,0 +1,25 @@
+upstream "tenants" {
+    destination = "${destination}"
+    host = "{tenant}.api.example.com"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/regions"
+        host = "{tenant}.{region:(us|eu)}.api.example.com"
+    }
+}
+
+upstream "admin" {
+    destination = "${destination}"
+    host = "admin.example.com"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
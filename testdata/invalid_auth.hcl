@@ -0,0 +1,12 @@
+upstream "widgets" {
+    destination = "http://widgets.local"
+
+    auth {
+        type = "digest"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
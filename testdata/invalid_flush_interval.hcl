@@ -0,0 +1,9 @@
+upstream "accounts" {
+    destination = "http://accounts.local"
+    flush_interval = "soon"
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
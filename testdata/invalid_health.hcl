@@ -0,0 +1,12 @@
+upstream "accounts" {
+    destination = "http://accounts.local"
+
+    health {
+        url = "healthz"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
@@ -0,0 +1,9 @@
+upstream "tenants" {
+    destination = "http://tenants.local"
+    host = "{tenant.api.example.com"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
@@ -0,0 +1,8 @@
+upstream "widgets" {
+    destination = "http://widgets.local"
+
+    route {
+        methods = ["GET", "FETCH"]
+        path = "/widgets"
+    }
+}
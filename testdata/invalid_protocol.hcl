@@ -0,0 +1,9 @@
+upstream "greeter" {
+    destination = "http://greeter.local"
+    protocol = "thrift"
+
+    route {
+        methods = ["POST"]
+        path = "/helloworld.Greeter/SayHello"
+    }
+}
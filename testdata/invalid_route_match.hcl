@@ -0,0 +1,9 @@
+upstream "files" {
+    destination = "http://files.local"
+
+    route {
+        methods = ["GET"]
+        path = "/files"
+        match = "regex"
+    }
+}
@@ -0,0 +1 @@
+widgets_port = 8080
@@ -0,0 +1,27 @@
+locals {
+    accounts = "/v2/accounts"
+    account  = "${local.accounts}/{id:[0-9]+}"
+}
+
+locals {
+    destination = "${destination}"
+}
+
+upstream "accounts" {
+    destination = local.destination
+
+    route {
+        methods = ["GET"]
+        path = local.accounts
+    }
+
+    route {
+        methods = ["GET", "PUT"]
+        path = local.account
+    }
+
+    route {
+        methods = ["GET"]
+        path = "${local.account}/orders"
+    }
+}
@@ -0,0 +1,8 @@
+upstream "widgets" {
+    destination = "${widgets}"
+
+    route {
+        methods = ["get", "Post", "GET"]
+        path = "/widgets"
+    }
+}
@@ -0,0 +1,11 @@
+prefix_path = "/api"
+
+upstream "accounts" {
+    destination = "http://accounts.local"
+    owner = "Identity <team-identity@company.com>"
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
@@ -0,0 +1,9 @@
+upstream "widgets" {
+    destination = "http://widgets.local"
+    owner = "Team A <team-a@company.com>"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
@@ -0,0 +1,10 @@
+prefix_path = "/api"
+
+upstream "accounts" {
+    destination = "http://accounts.local"
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
@@ -0,0 +1,10 @@
+prefix_path = "/api/v2"
+
+upstream "widgets" {
+    destination = "http://widgets.local"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
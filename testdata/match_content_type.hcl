@@ -0,0 +1,24 @@
+upstream "api" {
+    destination = "${api}"
+
+    route {
+        methods = ["POST"]
+        path = "/documents"
+    }
+}
+
+upstream "uploads" {
+    destination = "${uploads}"
+
+    route {
+        methods = ["POST"]
+        path = "/documents"
+        match_content_type = "multipart/"
+    }
+
+    route {
+        methods = ["POST"]
+        path = "/attachments"
+        match_content_type = "multipart/form-data"
+    }
+}
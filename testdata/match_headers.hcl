@@ -0,0 +1,28 @@
+upstream "stable" {
+    destination = "${stable}"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
+
+upstream "beta" {
+    destination = "${beta}"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+        match_headers = {
+            "X-Beta" = "true"
+        }
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/previews"
+        match_headers = {
+            "X-Beta" = "true"
+        }
+    }
+}
@@ -0,0 +1,28 @@
+upstream "v1" {
+    destination = "${v1}"
+
+    route {
+        methods = ["GET"]
+        path = "/search"
+    }
+}
+
+upstream "v2" {
+    destination = "${v2}"
+
+    route {
+        methods = ["GET"]
+        path = "/search"
+        match_query = {
+            "engine" = "v2"
+        }
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/reports"
+        match_query = {
+            "engine" = "v2"
+        }
+    }
+}
@@ -0,0 +1,20 @@
+upstream "widgets" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
+
+upstream "uploads" {
+    destination = "${destination}"
+    annotations = {
+        "pass/max-header-bytes": "0"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/uploads"
+    }
+}
@@ -0,0 +1,13 @@
+upstream "widgets" {
+    destination = "${destination}"
+
+    route {
+        methods = ["POST"]
+        path = "/widgets"
+    }
+
+    route {
+        methods = ["GET", "DELETE"]
+        path = "/widgets/{id}"
+    }
+}
@@ -0,0 +1,25 @@
+upstream "accounts" {
+    destination = "http://accounts.local"
+    annotations = {
+        team = "identity"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/accounts/{id}"
+    }
+}
+
+upstream "widgets" {
+    destination = "http://widgets.local"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
@@ -0,0 +1,25 @@
+upstream "primary" {
+    destination "blue" {
+        url = "${primary}"
+        weight = 50
+    }
+
+    destination "green" {
+        url = "${primary}"
+        weight = 50
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
+
+upstream "secondary" {
+    destination = "${secondary}"
+
+    route {
+        methods = ["GET"]
+        path = "/gadgets"
+    }
+}
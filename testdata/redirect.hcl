@@ -0,0 +1,22 @@
+upstream "legacy" {
+    redirect {
+        to = "https://widgets.example.com/v2/widgets/{id}"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/widgets/{id}"
+    }
+}
+
+upstream "docs" {
+    redirect {
+        to = "https://docs.example.com/{*}"
+        status = 308
+    }
+
+    route {
+        methods = ["GET", "POST"]
+        path = "/docs/*"
+    }
+}
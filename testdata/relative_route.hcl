@@ -0,0 +1,13 @@
+upstream "widgets" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "widgets"
+    }
+
+    route {
+        methods = []
+        path = "/gadgets"
+    }
+}
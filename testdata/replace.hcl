@@ -0,0 +1,25 @@
+upstream "accounts" {
+    destination "blue" {
+        url = "${blue}"
+        weight = 100
+    }
+
+    destination "green" {
+        url = "${green}"
+        weight = 0
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
+
+upstream "widgets" {
+    destination = "${blue}"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
@@ -0,0 +1,14 @@
+upstream "widgets" {
+    destination = "${destination}"
+
+    route {
+        methods = ["POST"]
+        path = "/widgets"
+        require_headers = ["X-Api-Version", "X-Tenant"]
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
@@ -0,0 +1,8 @@
+upstream "widgets" {
+    destination = "widgets.service.consul"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
@@ -0,0 +1,21 @@
+upstream "web" {
+    destination = "${destination}"
+    response_headers = {
+        "strict-transport-security" = "max-age=63072000"
+        "X-Frame-Options" = "DENY"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/web"
+    }
+}
+
+upstream "api" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/api"
+    }
+}
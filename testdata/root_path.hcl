@@ -0,0 +1,22 @@
+prefix_path = "/api/v2"
+
+upstream "prefixed" {
+    destination = "${destination}"
+    prefix_path = "/private"
+
+    route {
+        methods = ["GET"]
+        path = "/"
+    }
+}
+
+upstream "unstripped" {
+    destination = "${destination}"
+    prefix_path = "/public"
+    strip_prefix = false
+
+    route {
+        methods = ["GET"]
+        path = "/"
+    }
+}
@@ -0,0 +1,8 @@
+upstream "root" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/"
+    }
+}
@@ -0,0 +1,14 @@
+upstream "events" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/buffered"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/stream"
+        flush_interval_ms = -1
+    }
+}
@@ -0,0 +1,15 @@
+upstream "files" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/files"
+        match = "exact"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/assets"
+        match = "prefix"
+    }
+}
@@ -0,0 +1,13 @@
+upstream "widgets" {
+    destination = secret.widgets_destination
+
+    auth {
+        type = "bearer"
+        token = env.PASS_TEST_TOKEN
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
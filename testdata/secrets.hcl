@@ -0,0 +1 @@
+widgets_destination = "http://widgets.internal:8080"
@@ -0,0 +1,17 @@
+upstream "primary" {
+    destination = "${primary}"
+
+    route {
+        methods = ["POST"]
+        path = "/widgets"
+    }
+}
+
+upstream "shadow" {
+    destination = "${shadow}"
+
+    route {
+        methods = ["POST"]
+        path = "/shadow/widgets"
+    }
+}
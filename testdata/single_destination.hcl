@@ -0,0 +1,37 @@
+upstream "single" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/single"
+    }
+}
+
+upstream "block" {
+    destination "only" {
+        url = "${destination}"
+        weight = 1
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/block"
+    }
+}
+
+upstream "split" {
+    destination "blue" {
+        url = "${destination}"
+        weight = 1
+    }
+
+    destination "green" {
+        url = "${destination}"
+        weight = 1
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/split"
+    }
+}
@@ -0,0 +1,9 @@
+upstream "reports" {
+    destination = "${destination}"
+    slow_threshold_ms = 50
+
+    route {
+        methods = ["GET"]
+        path = "/reports/{speed}"
+    }
+}
@@ -0,0 +1,18 @@
+upstream "accounts" {
+    owner = "Identity <team-identity@company.com>"
+
+    destination "blue" {
+        url = "${blue}"
+        weight = 100
+    }
+
+    destination "green" {
+        url = "${green}"
+        weight = 0
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
@@ -0,0 +1,16 @@
+upstream "accounts" {
+    destination "blue" {
+        url = "${blue}"
+        weight = 50
+    }
+
+    destination "green" {
+        url = "${green}"
+        weight = 50
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/accounts"
+    }
+}
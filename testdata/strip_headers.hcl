@@ -0,0 +1,18 @@
+upstream "partner" {
+    destination = "${destination}"
+    strip_request_headers = ["x-internal-token"]
+
+    route {
+        methods = ["GET"]
+        path = "/partner"
+    }
+}
+
+upstream "internal" {
+    destination = "${destination}"
+
+    route {
+        methods = ["GET"]
+        path = "/internal"
+    }
+}
@@ -0,0 +1,22 @@
+prefix_path = "/api"
+
+upstream "stripped" {
+    destination = "${destination}"
+    prefix_path = "/stripped"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets/{id}"
+    }
+}
+
+upstream "unstripped" {
+    destination = "${destination}"
+    prefix_path = "/unstripped"
+    strip_prefix = false
+
+    route {
+        methods = ["GET"]
+        path = "/widgets/{id}"
+    }
+}
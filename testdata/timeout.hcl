@@ -0,0 +1,31 @@
+upstream "reports" {
+    destination = "${destination}"
+    timeout_ms = 50
+
+    route {
+        methods = ["GET"]
+        path = "/reports"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/reports/export"
+        timeout_ms = 1000
+    }
+}
+
+upstream "search" {
+    destination = "${destination}"
+    timeout_ms = 1000
+
+    route {
+        methods = ["GET"]
+        path = "/search"
+    }
+
+    route {
+        methods = ["GET"]
+        path = "/search/strict"
+        timeout_ms = 20
+    }
+}
@@ -0,0 +1,11 @@
+upstream "widgets" {
+    destination = "${destination}"
+    dial_timeout_ms = 100
+    tls_handshake_timeout_ms = 100
+    response_header_timeout_ms = 100
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
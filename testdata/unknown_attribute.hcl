@@ -0,0 +1,13 @@
+upstream "widgets" {
+    destination = "http://widgets.local"
+    retry_policy = "aggressive"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+
+    circuit_breaker {
+        threshold = 5
+    }
+}
@@ -0,0 +1,12 @@
+upstream "widgets" {
+    destination = "http://widgets.local"
+
+    route {
+        methods = ["GET"]
+        path = "/widgets"
+    }
+}
+
+upstream "gadgets" {
+    destination = "http://gadgets.local"
+}
@@ -0,0 +1,53 @@
+package pass
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// DefaultBodyTransformMaxSize is the largest response body that's buffered to
+// be transformed by a BodyTransformer, unless WithBodyTransformMaxSize says
+// otherwise.
+const DefaultBodyTransformMaxSize = 1 << 20
+
+// BodyTransformer rewrites the body of a response from an Upstream. It's given
+// the response's Content-Type and its entire body, and returns the body to send
+// to the client. An error is handled like any other proxy error.
+type BodyTransformer func(contentType string, body []byte) ([]byte, error)
+
+// transformBody returns a ResponseModifier that applies a BodyTransformer.
+// Encoded bodies and bodies larger than maxBody are passed through untouched.
+func transformBody(fn BodyTransformer, maxBody int64) ResponseModifier {
+	return func(resp *http.Response) error {
+		if resp.Body == nil || resp.Body == http.NoBody || resp.Header.Get("Content-Encoding") != "" {
+			return nil
+		}
+		if resp.ContentLength > maxBody {
+			return nil
+		}
+
+		buf, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBody+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(buf)) > maxBody {
+			// Too large to transform; send what was read ahead of the rest
+			// of the body.
+			resp.Body = readCloser{io.MultiReader(bytes.NewReader(buf), resp.Body), resp.Body}
+			return nil
+		}
+		resp.Body.Close()
+
+		body, err := fn(resp.Header.Get("Content-Type"), buf)
+		if err != nil {
+			return err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		resp.ContentLength = int64(len(body))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return nil
+	}
+}
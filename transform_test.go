@@ -0,0 +1,100 @@
+package pass
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestUpstreamBodyTransformer(t *testing.T) {
+	payload := `{"widget_name":"sprocket","id":1}`
+	legacy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(len(payload)))
+		w.Write([]byte(payload))
+	}))
+	defer legacy.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"legacy": cty.StringVal(legacy.URL),
+		},
+	}
+	m, err := LoadManifest("testdata/body_transformer.hcl", ectx)
+	require.NoError(t, err)
+
+	var contentType string
+	rename := func(ct string, body []byte) ([]byte, error) {
+		contentType = ct
+		var v map[string]interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, err
+		}
+		v["name"] = v["widget_name"]
+		delete(v, "widget_name")
+		return json.Marshal(v)
+	}
+
+	get := func(t *testing.T, proxy *Proxy, path string) (*http.Response, string) {
+		server := httptest.NewServer(proxy)
+		defer server.Close()
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(b)
+	}
+
+	t.Run("transforms", func(t *testing.T) {
+		proxy, err := New(m, WithUpstreamBodyTransformer("legacy", rename))
+		require.NoError(t, err)
+
+		resp, body := get(t, proxy, "/widgets")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.JSONEq(t, `{"name":"sprocket","id":1}`, body)
+		require.Equal(t, strconv.Itoa(len(body)), resp.Header.Get("Content-Length"))
+		require.Equal(t, "application/json", contentType)
+	})
+
+	t.Run("skips streamed routes", func(t *testing.T) {
+		proxy, err := New(m, WithUpstreamBodyTransformer("legacy", rename))
+		require.NoError(t, err)
+
+		_, body := get(t, proxy, "/widgets/stream")
+		require.Equal(t, payload, body)
+	})
+
+	t.Run("skips large bodies", func(t *testing.T) {
+		proxy, err := New(m, WithUpstreamBodyTransformer("legacy", rename), WithBodyTransformMaxSize(10))
+		require.NoError(t, err)
+
+		_, body := get(t, proxy, "/widgets")
+		require.Equal(t, payload, body)
+	})
+
+	t.Run("transformer error", func(t *testing.T) {
+		fail := func(string, []byte) ([]byte, error) {
+			return nil, errors.New("malformed")
+		}
+		proxy, err := New(m, WithUpstreamBodyTransformer("legacy", fail))
+		require.NoError(t, err)
+
+		resp, _ := get(t, proxy, "/widgets")
+		require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	})
+
+	t.Run("unknown upstream", func(t *testing.T) {
+		_, err := New(m, WithUpstreamBodyTransformer("unknown", rename))
+		require.True(t, errors.Is(err, ErrUnknownUpstream))
+	})
+
+}
@@ -0,0 +1,43 @@
+package pass
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// unixHost is the Host of requests proxied to destinations on Unix domain
+// sockets, which have no host of their own.
+const unixHost = "localhost"
+
+// unixSocket returns the path of the Unix domain socket of a destination such
+// as "unix:///var/run/backend.sock", and the HTTP URL requests for it are
+// proxied to. Requests keep their own path.
+func unixSocket(dest *url.URL) (string, *url.URL, error) {
+	if dest.Path == "" {
+		return "", nil, fmt.Errorf("missing socket path: %q", dest.String())
+	}
+	return dest.Path, &url.URL{Scheme: "http", Host: unixHost}, nil
+}
+
+// unixTransport returns a copy of the base transport that connects to the
+// Unix domain socket, whatever the request's host.
+func unixTransport(u Upstream, socket string, base http.RoundTripper) (*http.Transport, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	bt, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("upstream %q has a unix socket destination, which needs an *http.Transport; got %T", u.Identifier, base)
+	}
+
+	dialer := &net.Dialer{Timeout: time.Duration(u.DialTimeoutMS) * time.Millisecond}
+	t := bt.Clone()
+	t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+	return t, nil
+}
@@ -0,0 +1,55 @@
+package pass
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestUnixSocketDestination(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pass")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "backend.sock")
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	destination := &httptest.Server{
+		Listener: listener,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(r.Host + " " + r.URL.Path))
+		})},
+	}
+	destination.Start()
+	defer destination.Close()
+
+	ectx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"destination": cty.StringVal("unix://" + socket),
+		},
+	}
+	m, err := LoadManifest("testdata/routing.hcl", ectx)
+	require.NoError(t, err)
+
+	proxy, err := New(m)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v2/private/accounts/123", nil)
+	w := httptest.NewRecorder()
+	proxy.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "localhost /accounts/123", w.Body.String())
+
+	_, err = New(m, WithTransport(roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		return nil, nil
+	})))
+	require.Error(t, err)
+}